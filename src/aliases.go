@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	aliases *AliasStore = &AliasStore{
+		Aliases: make(map[string]Alias),
+		Mutex:   &sync.RWMutex{},
+	}
+)
+
+// Alias is a friendly name mapped to the address and edition of a server.
+type Alias struct {
+	Name    string `yaml:"-" json:"name"`
+	Edition string `yaml:"edition" json:"edition"`
+	Address string `yaml:"address" json:"address"`
+}
+
+// AliasStore holds the aliases loaded from the aliases file.
+type AliasStore struct {
+	Aliases map[string]Alias
+	ModTime time.Time
+	Mutex   *sync.RWMutex
+}
+
+// Get returns the alias with the given name, if it exists.
+func (s *AliasStore) Get(name string) (Alias, bool) {
+	s.Mutex.RLock()
+
+	defer s.Mutex.RUnlock()
+
+	alias, ok := s.Aliases[strings.ToLower(name)]
+
+	return alias, ok
+}
+
+// List returns every alias, sorted by name.
+func (s *AliasStore) List() []Alias {
+	s.Mutex.RLock()
+
+	defer s.Mutex.RUnlock()
+
+	result := make([]Alias, 0, len(s.Aliases))
+
+	for _, alias := range s.Aliases {
+		result = append(result, alias)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Load reads and validates the aliases file, replacing the current aliases only if every entry is valid.
+func (s *AliasStore) Load(file string) error {
+	info, err := os.Stat(file)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		return err
+	}
+
+	var entries map[string]Alias
+
+	if err = yaml.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+
+	result := make(map[string]Alias)
+
+	for name, alias := range entries {
+		if alias.Edition != "java" && alias.Edition != "bedrock" {
+			return fmt.Errorf("alias %s: edition must be 'java' or 'bedrock'", name)
+		}
+
+		if _, _, _, err = ParseTargetAddress(strings.ToLower(alias.Address), alias.Edition); err != nil {
+			return fmt.Errorf("alias %s: %w", name, err)
+		}
+
+		alias.Name = strings.ToLower(name)
+
+		result[alias.Name] = alias
+	}
+
+	s.Mutex.Lock()
+
+	defer s.Mutex.Unlock()
+
+	s.Aliases = result
+	s.ModTime = info.ModTime()
+
+	return nil
+}
+
+// Watch reloads the aliases file whenever its modification time changes until the context is done, keeping the
+// previous aliases if the new file is invalid.
+func (s *AliasStore) Watch(ctx context.Context, file string, interval time.Duration) {
+	s.Mutex.RLock()
+	lastModTime := s.ModTime
+	s.Mutex.RUnlock()
+
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(file)
+
+		if err != nil {
+			log.Printf("Failed to check aliases file: %v\n", err)
+
+			continue
+		}
+
+		if info.ModTime().Equal(lastModTime) {
+			continue
+		}
+
+		lastModTime = info.ModTime()
+
+		if err = s.Load(file); err != nil {
+			log.Printf("Failed to reload aliases file: %v\n", err)
+
+			continue
+		}
+
+		log.Printf("Reloaded aliases file (%d aliases)\n", len(s.List()))
+	}
+}
+
+// GetAddressParam returns the address of the requested server, either resolved from an alias or from the address
+// route parameter.
+func GetAddressParam(ctx *fiber.Ctx) string {
+	if address, ok := ctx.Locals("address").(string); ok {
+		return strings.ToLower(address)
+	}
+
+	return strings.ToLower(ctx.Params("address"))
+}
+
+// AliasStatusHandler returns the status of the server that the alias parameter refers to.
+func AliasStatusHandler(ctx *fiber.Ctx) error {
+	alias, ok := aliases.Get(ctx.Params("alias"))
+
+	if !ok {
+		return ctx.Status(http.StatusNotFound).SendString("Unknown alias")
+	}
+
+	ctx.Locals("address", alias.Address)
+
+	if alias.Edition == "bedrock" {
+		return BedrockStatusHandler(ctx)
+	}
+
+	return JavaStatusHandler(ctx)
+}
+
+// ListAliasesHandler returns every configured alias.
+func ListAliasesHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(aliases.List())
+}
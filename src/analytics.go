@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// AnalyticsOutcomeOnline is the outcome of a status lookup of an online server.
+	AnalyticsOutcomeOnline = "online"
+	// AnalyticsOutcomeOffline is the outcome of a status lookup of an offline server.
+	AnalyticsOutcomeOffline = "offline"
+	// AnalyticsOutcomeSuccess is the outcome of any other successful request.
+	AnalyticsOutcomeSuccess = "success"
+	// AnalyticsOutcomeRejected is the outcome of a request refused with a client error.
+	AnalyticsOutcomeRejected = "rejected"
+	// AnalyticsOutcomeError is the outcome of a request that failed with a server error.
+	AnalyticsOutcomeError = "error"
+
+	analyticsSchema = `CREATE TABLE IF NOT EXISTS request_counts (
+	hour INTEGER NOT NULL,
+	route TEXT NOT NULL,
+	edition TEXT NOT NULL,
+	outcome TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (hour, route, edition, outcome)
+)`
+)
+
+var (
+	analytics *Analytics = &Analytics{
+		Counts: make(map[AnalyticsKey]int64),
+		Mutex:  &sync.Mutex{},
+	}
+)
+
+// AnalyticsKey is the set of dimensions that requests are counted by, within an hour.
+type AnalyticsKey struct {
+	Hour    int64
+	Route   string
+	Edition string
+	Outcome string
+}
+
+// AnalyticsRow is a single request count returned by the analytics API.
+type AnalyticsRow struct {
+	Time    int64  `json:"time"`
+	Route   string `json:"route"`
+	Edition string `json:"edition"`
+	Outcome string `json:"outcome"`
+	Count   int64  `json:"count"`
+}
+
+// Analytics counts requests in memory and periodically adds the counts to the hourly rollups stored in SQLite.
+type Analytics struct {
+	DB     *sql.DB
+	Counts map[AnalyticsKey]int64
+	Mutex  *sync.Mutex
+}
+
+// Open opens the SQLite database and creates the rollup table if it does not exist.
+func (a *Analytics) Open(ctx context.Context) error {
+	db, err := sql.Open("sqlite", config.Analytics.Database)
+
+	if err != nil {
+		return err
+	}
+
+	// SQLite only allows a single writer, so a single connection avoids lock contention between flushes and queries
+	db.SetMaxOpenConns(1)
+
+	if _, err = db.ExecContext(ctx, analyticsSchema); err != nil {
+		db.Close()
+
+		return err
+	}
+
+	a.DB = db
+
+	return nil
+}
+
+// Record counts a single request.
+func (a *Analytics) Record(route, edition, outcome string) {
+	key := AnalyticsKey{
+		Hour:    time.Now().Truncate(time.Hour).Unix(),
+		Route:   route,
+		Edition: edition,
+		Outcome: outcome,
+	}
+
+	a.Mutex.Lock()
+
+	defer a.Mutex.Unlock()
+
+	a.Counts[key]++
+}
+
+// Flush adds the counts recorded since the last flush to the rollups, and deletes the rollups older than the
+// configured retention.
+func (a *Analytics) Flush(ctx context.Context) error {
+	if a.DB == nil {
+		return nil
+	}
+
+	a.Mutex.Lock()
+	counts := a.Counts
+	a.Counts = make(map[AnalyticsKey]int64)
+	a.Mutex.Unlock()
+
+	tx, err := a.DB.BeginTx(ctx, nil)
+
+	if err != nil {
+		a.restore(counts)
+
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for key, count := range counts {
+		if _, err = tx.ExecContext(ctx, "INSERT INTO request_counts (hour, route, edition, outcome, count) VALUES (?, ?, ?, ?, ?) ON CONFLICT (hour, route, edition, outcome) DO UPDATE SET count = count + excluded.count", key.Hour, key.Route, key.Edition, key.Outcome, count); err != nil {
+			a.restore(counts)
+
+			return err
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM request_counts WHERE hour < ?", time.Now().Add(-config.Analytics.Retention).Unix()); err != nil {
+		a.restore(counts)
+
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		a.restore(counts)
+
+		return err
+	}
+
+	return nil
+}
+
+// Run flushes the recorded counts at the interval until the context is done.
+func (a *Analytics) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := a.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to flush analytics: %v\n", err)
+		}
+	}
+}
+
+// Close flushes the remaining counts and closes the database.
+func (a *Analytics) Close(ctx context.Context) error {
+	if a.DB == nil {
+		return nil
+	}
+
+	if err := a.Flush(ctx); err != nil {
+		log.Printf("Failed to flush analytics: %v\n", err)
+	}
+
+	err := a.DB.Close()
+
+	a.DB = nil
+
+	return err
+}
+
+// Query returns the request counts since the given time summed over buckets of the interval, which is a whole number
+// of hours. Empty filters match every value.
+func (a *Analytics) Query(ctx context.Context, since time.Time, interval time.Duration, route, edition, outcome string) ([]AnalyticsRow, error) {
+	bucket := int64(interval.Seconds())
+
+	query := "SELECT (hour / ?) * ? AS bucket, route, edition, outcome, SUM(count) FROM request_counts WHERE hour >= ?"
+	args := []interface{}{bucket, bucket, since.Truncate(interval).Unix()}
+
+	for column, value := range map[string]string{"route": route, "edition": edition, "outcome": outcome} {
+		if len(value) > 0 {
+			query += fmt.Sprintf(" AND %s = ?", column)
+			args = append(args, value)
+		}
+	}
+
+	rows, err := a.DB.QueryContext(ctx, query+" GROUP BY bucket, route, edition, outcome ORDER BY bucket, route, edition, outcome", args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make([]AnalyticsRow, 0)
+
+	for rows.Next() {
+		var row AnalyticsRow
+
+		if err = rows.Scan(&row.Time, &row.Route, &row.Edition, &row.Outcome, &row.Count); err != nil {
+			return nil, err
+		}
+
+		row.Time *= 1000
+
+		result = append(result, row)
+	}
+
+	return result, rows.Err()
+}
+
+// restore adds counts that could not be flushed back to the pending counts, so that they are written by the next flush.
+func (a *Analytics) restore(counts map[AnalyticsKey]int64) {
+	a.Mutex.Lock()
+
+	defer a.Mutex.Unlock()
+
+	for key, count := range counts {
+		a.Counts[key] += count
+	}
+}
+
+// RecordAnalytics is a middleware that counts every handled request by its route, the edition it concerns and its
+// outcome.
+func RecordAnalytics(ctx *fiber.Ctx) error {
+	err := ctx.Next()
+
+	route := ctx.Route().Path
+
+	edition := ""
+
+	switch {
+	case strings.Contains(route, "/java"), strings.HasPrefix(route, "/query"), strings.HasPrefix(route, "/icon"):
+		edition = "java"
+	case strings.Contains(route, "/bedrock"), strings.HasPrefix(route, "/discover"):
+		edition = "bedrock"
+	}
+
+	status := ctx.Response().StatusCode()
+
+	if err != nil {
+		var fiberError *fiber.Error
+
+		status = http.StatusInternalServerError
+
+		if errors.As(err, &fiberError) {
+			status = fiberError.Code
+		}
+	}
+
+	var outcome string
+
+	switch {
+	case status >= 500:
+		outcome = AnalyticsOutcomeError
+	case status >= 400:
+		outcome = AnalyticsOutcomeRejected
+	case string(ctx.Response().Header.Peek("X-Online")) == "true":
+		outcome = AnalyticsOutcomeOnline
+	case string(ctx.Response().Header.Peek("X-Online")) == "false":
+		outcome = AnalyticsOutcomeOffline
+	default:
+		outcome = AnalyticsOutcomeSuccess
+	}
+
+	analytics.Record(route, edition, outcome)
+
+	return err
+}
+
+// AnalyticsHandler returns the request counts of the period in the 'since' query parameter, summed over buckets of
+// the 'interval' query parameter and optionally filtered by route, edition and outcome.
+func AnalyticsHandler(ctx *fiber.Ctx) error {
+	since, err := time.ParseDuration(ctx.Query("since", "24h"))
+
+	if err != nil || since <= 0 || since > config.Analytics.Retention {
+		return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Invalid 'since' query parameter, must be between 0s and %s", config.Analytics.Retention))
+	}
+
+	interval, err := time.ParseDuration(ctx.Query("interval", "1h"))
+
+	if err != nil || interval < time.Hour || interval%time.Hour != 0 {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'interval' query parameter, must be a whole number of hours")
+	}
+
+	// Counts that have not been flushed yet are included so that the current hour is complete
+	if err = analytics.Flush(ctx.UserContext()); err != nil {
+		return err
+	}
+
+	result, err := analytics.Query(ctx.UserContext(), time.Now().Add(-since), interval, ctx.Query("route"), ctx.Query("edition"), ctx.Query("outcome"))
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(result)
+}
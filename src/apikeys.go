@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const apiKeysKey = "api-keys"
+
+var (
+	ErrAPIKeyRateLimitExceeded error = errors.New("rate limit of this API key exceeded")
+	ErrAPIKeyQuotaExceeded     error = errors.New("daily quota of this API key exceeded")
+)
+
+// APIKey is a key provisioned by the operators of this instance, with its own daily quota and rate limit.
+type APIKey struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	DailyQuota uint   `json:"daily_quota"`
+	RateLimit  uint   `json:"rate_limit"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// APIKeyUsage is an API key along with the number of requests it has made today.
+type APIKeyUsage struct {
+	APIKey
+	UsedToday int64 `json:"used_today"`
+}
+
+// CreatedAPIKey is the response of provisioning an API key, the only time the key itself is returned.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyRequest is the body accepted when provisioning an API key. Limits left empty use the configured defaults.
+type APIKeyRequest struct {
+	Name       string `json:"name"`
+	DailyQuota *uint  `json:"daily_quota"`
+	RateLimit  *uint  `json:"rate_limit"`
+}
+
+// GetAPIKey returns the provisioned API key, or nil if the key does not exist. Keys are stored by their hash only.
+func GetAPIKey(ctx context.Context, key string) (*APIKey, error) {
+	data, err := r.HashGet(ctx, apiKeysKey, SHA256(key))
+
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var result APIKey
+
+	return &result, json.Unmarshal(data, &result)
+}
+
+// CreateAPIKey provisions a new API key with the given limits.
+func CreateAPIKey(ctx context.Context, name string, dailyQuota, rateLimit uint) (*CreatedAPIKey, error) {
+	result := &CreatedAPIKey{
+		APIKey: APIKey{
+			ID:         RandomHexString(8),
+			Name:       name,
+			DailyQuota: dailyQuota,
+			RateLimit:  rateLimit,
+			CreatedAt:  time.Now().UnixMilli(),
+		},
+		Key: RandomHexString(24),
+	}
+
+	data, err := json.Marshal(result.APIKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, r.HashSet(ctx, apiKeysKey, SHA256(result.Key), data)
+}
+
+// ListAPIKeys returns every provisioned API key along with its usage today, sorted by creation time.
+func ListAPIKeys(ctx context.Context) ([]APIKeyUsage, error) {
+	values, err := r.HashGetAll(ctx, apiKeysKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]APIKeyUsage, 0, len(values))
+
+	for _, value := range values {
+		var key APIKey
+
+		if err = json.Unmarshal([]byte(value), &key); err != nil {
+			return nil, err
+		}
+
+		usage, _, err := r.Get(ctx, GetAPIKeyUsageKey(key.ID, time.Now()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		usedToday, _ := strconv.ParseInt(string(usage), 10, 64)
+
+		result = append(result, APIKeyUsage{
+			APIKey:    key,
+			UsedToday: usedToday,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt < result[j].CreatedAt
+	})
+
+	return result, nil
+}
+
+// DeleteAPIKey revokes the API key with the given ID, returning false if there is no such key.
+func DeleteAPIKey(ctx context.Context, id string) (bool, error) {
+	values, err := r.HashGetAll(ctx, apiKeysKey)
+
+	if err != nil {
+		return false, err
+	}
+
+	for hash, value := range values {
+		var key APIKey
+
+		if err = json.Unmarshal([]byte(value), &key); err != nil {
+			return false, err
+		}
+
+		if key.ID != id {
+			continue
+		}
+
+		_, err = r.HashDelete(ctx, apiKeysKey, hash)
+
+		return err == nil, err
+	}
+
+	return false, nil
+}
+
+// GetAPIKeyUsageKey returns the key of the request counter of the API key for the UTC day of the given time.
+func GetAPIKeyUsageKey(id string, t time.Time) string {
+	return fmt.Sprintf("api-key-usage:%s:%s", id, t.UTC().Format(time.DateOnly))
+}
+
+// GetAPIKeyRateKey returns the key of the request counter of the API key for the minute of the given time.
+func GetAPIKeyRateKey(id string, t time.Time) string {
+	return fmt.Sprintf("api-key-rate:%s:%d", id, t.Truncate(time.Minute).Unix())
+}
+
+// ChargeAPIKey counts an additional lookup against the rate limit and daily quota of the API key, for routes that
+// look up several servers in a single request, which CheckAPIKey only counts once.
+func ChargeAPIKey(ctx context.Context, key *APIKey) error {
+	now := time.Now().UTC()
+
+	if key.RateLimit > 0 {
+		count, err := r.IncrementWithExpiry(ctx, GetAPIKeyRateKey(key.ID, now), time.Minute*2)
+
+		if err != nil {
+			return err
+		}
+
+		if count > int64(key.RateLimit) {
+			return ErrAPIKeyRateLimitExceeded
+		}
+	}
+
+	if key.DailyQuota > 0 {
+		count, err := r.IncrementWithExpiry(ctx, GetAPIKeyUsageKey(key.ID, now), time.Hour*48)
+
+		if err != nil {
+			return err
+		}
+
+		if count > int64(key.DailyQuota) {
+			return ErrAPIKeyQuotaExceeded
+		}
+	}
+
+	return nil
+}
+
+// CheckAPIKey is a middleware that enforces the daily quota and rate limit of the API key in the X-API-Key header
+// before the status is fetched. Keys of tenant profiles are not subject to limits, and requests without a key are
+// only rejected if API keys are required.
+func CheckAPIKey(ctx *fiber.Ctx) error {
+	if !config.APIKeys.Enable {
+		return ctx.Next()
+	}
+
+	value := ctx.Get("X-API-Key")
+
+	if len(value) < 1 {
+		if config.APIKeys.Require {
+			return ctx.Status(http.StatusUnauthorized).SendString("Missing 'X-API-Key' header in request")
+		}
+
+		return ctx.Next()
+	}
+
+	key, err := GetAPIKey(ctx.UserContext(), value)
+
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		if tenant := GetTenantByAPIKey(value); tenant != nil {
+			return checkTenantRateLimit(ctx, tenant)
+		}
+
+		return ctx.Status(http.StatusUnauthorized).SendString("Invalid or revoked API key")
+	}
+
+	now := time.Now().UTC()
+
+	// Rate limit, counted in fixed one minute windows
+	if key.RateLimit > 0 {
+		window := now.Truncate(time.Minute)
+
+		count, err := r.IncrementWithExpiry(ctx.UserContext(), GetAPIKeyRateKey(key.ID, window), time.Minute*2)
+
+		if err != nil {
+			return err
+		}
+
+		ctx.Set("X-RateLimit-Limit", strconv.FormatUint(uint64(key.RateLimit), 10))
+		ctx.Set("X-RateLimit-Remaining", strconv.FormatInt(max(int64(key.RateLimit)-count, 0), 10))
+
+		if count > int64(key.RateLimit) {
+			ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(window.Add(time.Minute).Sub(now).Seconds())+1))
+
+			return ctx.Status(http.StatusTooManyRequests).SendString("Rate limit of this API key exceeded")
+		}
+	}
+
+	// Daily quota, reset at midnight UTC
+	if key.DailyQuota > 0 {
+		tomorrow := now.Truncate(time.Hour * 24).Add(time.Hour * 24)
+
+		count, err := r.IncrementWithExpiry(ctx.UserContext(), GetAPIKeyUsageKey(key.ID, now), time.Hour*48)
+
+		if err != nil {
+			return err
+		}
+
+		ctx.Set("X-Quota-Limit", strconv.FormatUint(uint64(key.DailyQuota), 10))
+		ctx.Set("X-Quota-Remaining", strconv.FormatInt(max(int64(key.DailyQuota)-count, 0), 10))
+
+		if count > int64(key.DailyQuota) {
+			ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(tomorrow.Sub(now).Seconds())+1))
+
+			return ctx.Status(http.StatusTooManyRequests).SendString("Daily quota of this API key exceeded")
+		}
+	}
+
+	ctx.Locals("api-key", key)
+
+	return ctx.Next()
+}
+
+// ListAPIKeysHandler returns every provisioned API key along with its usage today.
+func ListAPIKeysHandler(ctx *fiber.Ctx) error {
+	keys, err := ListAPIKeys(ctx.UserContext())
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(keys)
+}
+
+// CreateAPIKeyHandler provisions a new API key and returns it.
+func CreateAPIKeyHandler(ctx *fiber.Ctx) error {
+	var body APIKeyRequest
+
+	if err := ctx.BodyParser(&body); err != nil || len(body.Name) < 1 {
+		return ctx.Status(http.StatusBadRequest).SendString("Request body must be a JSON object with a non-empty 'name'")
+	}
+
+	var (
+		dailyQuota uint = config.APIKeys.DefaultDailyQuota
+		rateLimit  uint = config.APIKeys.DefaultRateLimit
+	)
+
+	if body.DailyQuota != nil {
+		dailyQuota = *body.DailyQuota
+	}
+
+	if body.RateLimit != nil {
+		rateLimit = *body.RateLimit
+	}
+
+	key, err := CreateAPIKey(ctx.UserContext(), body.Name, dailyQuota, rateLimit)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(key)
+}
+
+// DeleteAPIKeyHandler revokes the API key with the ID in the parameters.
+func DeleteAPIKeyHandler(ctx *fiber.Ctx) error {
+	ok, err := DeleteAPIKey(ctx.UserContext(), ctx.Params("id"))
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ctx.Status(http.StatusNotFound).SendString("No API key exists with this ID")
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// checkTenantRateLimit enforces the rate limit of the tenant for requests made with one of its API keys, which skip the
+// limits of provisioned API keys. When rate limiting is enabled, the limit was already enforced instead of the per-IP
+// rate limit.
+func checkTenantRateLimit(ctx *fiber.Ctx, tenant *ConfigTenant) error {
+	if tenant.RateLimit == nil || config.RateLimit.Enable {
+		return ctx.Next()
+	}
+
+	taken, retryAfter, err := TakeRequestToken(ctx.UserContext(), ctx.IP(), tenant)
+
+	if err != nil {
+		return err
+	}
+
+	if !taken {
+		return SendTooManyRequests(ctx, retryAfter)
+	}
+
+	return ctx.Next()
+}
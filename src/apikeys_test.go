@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	useTestRedis(t)
+
+	previous := config.APIKeys
+
+	config.APIKeys.Enable = true
+
+	t.Cleanup(func() {
+		config.APIKeys = previous
+	})
+
+	quotaKey, err := CreateAPIKey(context.Background(), "quota", 2, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rateKey, err := CreateAPIKey(context.Background(), "rate", 0, 2)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlimitedKey, err := CreateAPIKey(context.Background(), "unlimited", 0, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+
+	app.Get("/", CheckAPIKey, func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		Name      string
+		Key       string
+		Require   bool
+		Statuses  []int
+		Remaining string
+	}{
+		{"daily quota", quotaKey.Key, false, []int{200, 200, 429}, "0"},
+		{"rate limit", rateKey.Key, false, []int{200, 200, 429}, "0"},
+		{"unlimited", unlimitedKey.Key, false, []int{200, 200, 200}, ""},
+		{"unknown key", "unknown", false, []int{401}, ""},
+		{"optional key", "", false, []int{200}, ""},
+		{"required key", "", true, []int{401}, ""},
+	}
+
+	for _, test := range tests {
+		config.APIKeys.Require = test.Require
+
+		var remaining string
+
+		for i, status := range test.Statuses {
+			req := httptest.NewRequest("GET", "/", nil)
+
+			if len(test.Key) > 0 {
+				req.Header.Set("X-API-Key", test.Key)
+			}
+
+			resp, err := app.Test(req)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != status {
+				t.Errorf("%s: request %d returned %d, expected %d", test.Name, i+1, resp.StatusCode, status)
+			}
+
+			remaining = resp.Header.Get("X-Quota-Remaining") + resp.Header.Get("X-RateLimit-Remaining")
+		}
+
+		if remaining != test.Remaining {
+			t.Errorf("%s: %q requests remaining, expected %q", test.Name, remaining, test.Remaining)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcstatus-io/mcutil/v4/formatting"
+	"github.com/mcstatus-io/mcutil/v4/response"
+)
+
+const maxUnconnectedPongSize = 4096
+
+var (
+	raknetMagic []byte = []byte{0x00, 0xFF, 0xFF, 0x00, 0xFE, 0xFE, 0xFE, 0xFE, 0xFD, 0xFD, 0xFD, 0xFD, 0x12, 0x34, 0x56, 0x78}
+
+	ErrInvalidUnconnectedPong error = errors.New("invalid unconnected pong packet")
+)
+
+// PingBedrock retrieves the status of a Bedrock Edition server with a RakNet unconnected ping. Unlike the status of
+// mcutil, a pong with a truncated or malformed server ID is accepted, leaving the fields it lacks empty.
+func PingBedrock(ctx context.Context, hostname string, port uint16) (*response.StatusBedrock, error) {
+	conn, err := NewTargetDialer().DialContext(ctx, "udp", net.JoinHostPort(hostname, strconv.Itoa(int(port))))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	return pingBedrockConn(ctx, conn)
+}
+
+// pingBedrockConn sends the unconnected ping over the connection and waits for the first valid pong.
+func pingBedrockConn(ctx context.Context, conn net.Conn) (*response.StatusBedrock, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	// Unblock the read as soon as the context is cancelled rather than at its deadline
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	defer stop()
+
+	if _, err := conn.Write(NewUnconnectedPing()); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, maxUnconnectedPongSize)
+
+	for {
+		n, err := conn.Read(data)
+
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+
+			return nil, err
+		}
+
+		// Stray packets, such as a late answer to an earlier ping, are skipped
+		if result, err := ParseUnconnectedPong(data[:n]); err == nil {
+			return result, nil
+		}
+	}
+}
+
+// NewUnconnectedPing returns the RakNet unconnected ping packet that Bedrock Edition clients use to list servers.
+func NewUnconnectedPing() []byte {
+	buf := &bytes.Buffer{}
+
+	buf.WriteByte(0x01)
+	binary.Write(buf, binary.BigEndian, time.Now().UnixMilli())
+	buf.Write(raknetMagic)
+	binary.Write(buf, binary.BigEndian, int64(0))
+
+	return buf.Bytes()
+}
+
+// ParseUnconnectedPong parses the RakNet unconnected pong packet that Bedrock Edition servers answer pings with. The
+// server ID is parsed as far as it goes, as some servers send it truncated or with fields that are not numbers, and
+// the fields that cannot be read are left empty.
+func ParseUnconnectedPong(data []byte) (*response.StatusBedrock, error) {
+	// Packet ID, time, server GUID, magic and the length of the server ID
+	if len(data) < 35 || data[0] != 0x1C || !bytes.Equal(data[17:33], raknetMagic) {
+		return nil, ErrInvalidUnconnectedPong
+	}
+
+	serverID := data[35:]
+
+	if length := int(binary.BigEndian.Uint16(data[33:35])); length < len(serverID) {
+		serverID = serverID[:length]
+	}
+
+	result := &response.StatusBedrock{
+		ServerGUID: int64(binary.BigEndian.Uint64(data[9:17])),
+	}
+
+	var motd string
+
+	for i, value := range strings.Split(strings.TrimRight(string(serverID), "\x00"), ";") {
+		if len(strings.TrimSpace(value)) < 1 {
+			continue
+		}
+
+		switch i {
+		case 0:
+			result.Edition = PointerOf(value)
+		case 1:
+			motd = value
+		case 2:
+			if protocol, err := strconv.ParseInt(value, 10, 64); err == nil {
+				result.ProtocolVersion = &protocol
+			}
+		case 3:
+			result.Version = PointerOf(value)
+		case 4:
+			if online, err := strconv.ParseInt(value, 10, 64); err == nil {
+				result.OnlinePlayers = &online
+			}
+		case 5:
+			if max, err := strconv.ParseInt(value, 10, 64); err == nil {
+				result.MaxPlayers = &max
+			}
+		case 6:
+			result.ServerID = PointerOf(value)
+		case 7:
+			motd += "\n" + value
+		case 8:
+			result.Gamemode = PointerOf(value)
+		case 9:
+			if gamemodeID, err := strconv.ParseInt(value, 10, 64); err == nil {
+				result.GamemodeID = &gamemodeID
+			}
+		case 10:
+			if port, err := strconv.ParseUint(value, 10, 16); err == nil {
+				result.PortIPv4 = PointerOf(uint16(port))
+			}
+		case 11:
+			if port, err := strconv.ParseUint(value, 10, 16); err == nil {
+				result.PortIPv6 = PointerOf(uint16(port))
+			}
+		}
+	}
+
+	if len(motd) > 0 {
+		parsedMOTD, err := formatting.Parse(motd)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidUnconnectedPong, err)
+		}
+
+		result.MOTD = parsedMOTD
+	}
+
+	return result, nil
+}
+
+// GetMissingBedrockFields returns the names of the status properties that the server left out of its pong.
+func GetMissingBedrockFields(status *response.StatusBedrock) []string {
+	result := make([]string, 0)
+
+	fields := []struct {
+		Name    string
+		Missing bool
+	}{
+		{"edition", status.Edition == nil},
+		{"motd", status.MOTD == nil},
+		{"version.protocol", status.ProtocolVersion == nil},
+		{"version.name", status.Version == nil},
+		{"players.online", status.OnlinePlayers == nil},
+		{"players.max", status.MaxPlayers == nil},
+		{"server_id", status.ServerID == nil},
+		{"gamemode", status.Gamemode == nil},
+	}
+
+	for _, field := range fields {
+		if field.Missing {
+			result = append(result, field.Name)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	localBlocklistKey      = "local-blocklist"
+	localBlocklistAuditKey = "local-blocklist-audit"
+	localBlocklistAuditMax = 1000
+)
+
+var (
+	localBlocklist *LocalBlocklist = &LocalBlocklist{
+		Entries: make(map[string]LocalBlocklistEntry),
+		Mutex:   &sync.RWMutex{},
+	}
+	blocklistHostRegEx *regexp.Regexp = regexp.MustCompile(`^(\*\.)?[a-z0-9-_]+(\.[a-z0-9-_]+)+$`)
+
+	ErrInvalidBlocklistEntry error = errors.New("entries must be a hostname, a wildcard hostname such as '*.example.com', an IP address or a CIDR range")
+)
+
+// LocalBlocklistEntry is a host or network blocked by the operators of this instance, in addition to Mojang's list.
+type LocalBlocklistEntry struct {
+	Entry   string `json:"entry"`
+	Reason  string `json:"reason"`
+	AddedBy string `json:"added_by"`
+	AddedAt int64  `json:"added_at"`
+}
+
+// LocalBlocklistAuditEvent is a single change made to the local blocklist.
+type LocalBlocklistAuditEvent struct {
+	Action string `json:"action"`
+	Entry  string `json:"entry"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+	Time   int64  `json:"time"`
+}
+
+// BlocklistExplanation is the public explanation of why a host is or is not flagged as blocked.
+type BlocklistExplanation struct {
+	Host    string          `json:"host"`
+	Blocked bool            `json:"blocked"`
+	Match   *BlocklistMatch `json:"match"`
+}
+
+// LocalBlocklistRequest is the body accepted when adding or removing local blocklist entries.
+type LocalBlocklistRequest struct {
+	Entries []string `json:"entries"`
+	Reason  string   `json:"reason"`
+}
+
+// LocalBlocklist is the in-memory copy of the local blocklist stored in Redis, checked by IsBlockedAddress.
+type LocalBlocklist struct {
+	Entries     map[string]LocalBlocklistEntry
+	Networks    []*net.IPNet
+	RefreshedAt time.Time
+	Mutex       *sync.RWMutex
+}
+
+// Replace swaps the contents of the blocklist with the given entries.
+func (b *LocalBlocklist) Replace(entries map[string]LocalBlocklistEntry) {
+	networks := make([]*net.IPNet, 0)
+
+	for entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+		}
+	}
+
+	b.Mutex.Lock()
+
+	defer b.Mutex.Unlock()
+
+	b.Entries = entries
+	b.Networks = networks
+	b.RefreshedAt = time.Now()
+}
+
+// HasHost checks if the exact host or wildcard entry is in the blocklist.
+func (b *LocalBlocklist) HasHost(host string) bool {
+	b.Mutex.RLock()
+
+	defer b.Mutex.RUnlock()
+
+	_, ok := b.Entries[host]
+
+	return ok
+}
+
+// HasIP checks if the IP address is contained by any network in the blocklist.
+func (b *LocalBlocklist) HasIP(ip net.IP) bool {
+	return b.MatchIP(ip) != nil
+}
+
+// MatchIP returns the first network in the blocklist that contains the IP address, or nil if there is none.
+func (b *LocalBlocklist) MatchIP(ip net.IP) *net.IPNet {
+	b.Mutex.RLock()
+
+	defer b.Mutex.RUnlock()
+
+	for _, network := range b.Networks {
+		if network.Contains(ip) {
+			return network
+		}
+	}
+
+	return nil
+}
+
+// List returns every entry in the blocklist, sorted by entry.
+func (b *LocalBlocklist) List() []LocalBlocklistEntry {
+	b.Mutex.RLock()
+
+	defer b.Mutex.RUnlock()
+
+	result := make([]LocalBlocklistEntry, 0, len(b.Entries))
+
+	for _, entry := range b.Entries {
+		result = append(result, entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Entry < result[j].Entry
+	})
+
+	return result
+}
+
+// NormalizeBlocklistEntry validates a blocklist entry and returns its canonical form. IP addresses are stored as
+// single address CIDR ranges so that they are matched the same way as networks.
+func NormalizeBlocklistEntry(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network.String(), nil
+	}
+
+	if ip := net.ParseIP(value); ip != nil {
+		if ip.To4() != nil {
+			return fmt.Sprintf("%s/32", ip.String()), nil
+		}
+
+		return fmt.Sprintf("%s/128", ip.String()), nil
+	}
+
+	if blocklistHostRegEx.MatchString(value) {
+		return value, nil
+	}
+
+	return "", ErrInvalidBlocklistEntry
+}
+
+// IsLocallyBlockedAddress checks if the given address is in the local blocklist, either directly, through a wildcard
+// entry of a parent domain, or through a network containing the IP address.
+func IsLocallyBlockedAddress(address string) bool {
+	return MatchLocallyBlockedAddress(address) != nil
+}
+
+// MatchLocallyBlockedAddress returns the local blocklist entry that the address matches, or nil if it is not blocked.
+func MatchLocallyBlockedAddress(address string) *BlocklistMatch {
+	address = strings.ToLower(address)
+
+	if ip := net.ParseIP(address); ip != nil {
+		if network := localBlocklist.MatchIP(ip); network != nil {
+			return &BlocklistMatch{
+				Source:  BlocklistSourceLocal,
+				Pattern: network.String(),
+				Type:    BlocklistMatchNetwork,
+			}
+		}
+
+		return nil
+	}
+
+	if localBlocklist.HasHost(address) {
+		return &BlocklistMatch{
+			Source:  BlocklistSourceLocal,
+			Pattern: address,
+			Type:    BlocklistMatchExact,
+		}
+	}
+
+	addressSegments := strings.Split(address, ".")
+
+	for i := 1; i < len(addressSegments); i++ {
+		pattern := fmt.Sprintf("*.%s", strings.Join(addressSegments[i:], "."))
+
+		if localBlocklist.HasHost(pattern) {
+			return &BlocklistMatch{
+				Source:  BlocklistSourceLocal,
+				Pattern: pattern,
+				Type:    BlocklistMatchWildcard,
+			}
+		}
+	}
+
+	return nil
+}
+
+// RefreshLocalBlocklist reloads the local blocklist from Redis.
+func RefreshLocalBlocklist(ctx context.Context) error {
+	values, err := r.HashGetAll(ctx, localBlocklistKey)
+
+	if err != nil {
+		return err
+	}
+
+	entries := make(map[string]LocalBlocklistEntry)
+
+	for key, value := range values {
+		var entry LocalBlocklistEntry
+
+		if err = json.Unmarshal([]byte(value), &entry); err != nil {
+			return err
+		}
+
+		entries[key] = entry
+	}
+
+	localBlocklist.Replace(entries)
+
+	return nil
+}
+
+// SyncLocalBlocklist periodically reloads the local blocklist so that changes made through other instances are seen,
+// until the context is done.
+func SyncLocalBlocklist(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := RefreshLocalBlocklist(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to refresh local blocklist: %v\n", err)
+		}
+	}
+}
+
+// AddLocalBlocklistEntries adds the entries to the local blocklist and records the change in the audit log.
+func AddLocalBlocklistEntries(ctx context.Context, entries []string, reason, actor string) ([]LocalBlocklistEntry, error) {
+	result := make([]LocalBlocklistEntry, 0, len(entries))
+
+	for _, value := range entries {
+		normalized, err := NormalizeBlocklistEntry(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", value, err)
+		}
+
+		result = append(result, LocalBlocklistEntry{
+			Entry:   normalized,
+			Reason:  reason,
+			AddedBy: actor,
+			AddedAt: time.Now().UnixMilli(),
+		})
+	}
+
+	for _, entry := range result {
+		data, err := json.Marshal(entry)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = r.HashSet(ctx, localBlocklistKey, entry.Entry, data); err != nil {
+			return nil, err
+		}
+
+		if err = RecordBlocklistAudit(ctx, "add", entry.Entry, reason, actor); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, RefreshLocalBlocklist(ctx)
+}
+
+// RemoveLocalBlocklistEntries removes the entries from the local blocklist and records the change in the audit log,
+// returning the entries that were actually removed.
+func RemoveLocalBlocklistEntries(ctx context.Context, entries []string, reason, actor string) ([]string, error) {
+	result := make([]string, 0, len(entries))
+
+	for _, value := range entries {
+		normalized, err := NormalizeBlocklistEntry(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", value, err)
+		}
+
+		removed, err := r.HashDelete(ctx, localBlocklistKey, normalized)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if removed < 1 {
+			continue
+		}
+
+		if err = RecordBlocklistAudit(ctx, "remove", normalized, reason, actor); err != nil {
+			return nil, err
+		}
+
+		result = append(result, normalized)
+	}
+
+	return result, RefreshLocalBlocklist(ctx)
+}
+
+// RecordBlocklistAudit writes a change to the local blocklist to the log and to the audit trail stored in Redis.
+func RecordBlocklistAudit(ctx context.Context, action, entry, reason, actor string) error {
+	log.Printf("Local blocklist: %s %s by %s (%s)\n", action, entry, actor, reason)
+
+	data, err := json.Marshal(LocalBlocklistAuditEvent{
+		Action: action,
+		Entry:  entry,
+		Reason: reason,
+		Actor:  actor,
+		Time:   time.Now().UnixMilli(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return r.ListPush(ctx, localBlocklistAuditKey, data, localBlocklistAuditMax)
+}
+
+// GetBlocklistAudit returns the most recent changes made to the local blocklist, newest first.
+func GetBlocklistAudit(ctx context.Context, limit int64) ([]LocalBlocklistAuditEvent, error) {
+	values, err := r.ListRange(ctx, localBlocklistAuditKey, 0, limit-1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]LocalBlocklistAuditEvent, 0, len(values))
+
+	for _, value := range values {
+		var event LocalBlocklistAuditEvent
+
+		if err = json.Unmarshal([]byte(value), &event); err != nil {
+			return nil, err
+		}
+
+		result = append(result, event)
+	}
+
+	return result, nil
+}
+
+// ListBlocklistHandler returns every entry in the local blocklist.
+func ListBlocklistHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(localBlocklist.List())
+}
+
+// AddBlocklistHandler adds hosts or networks to the local blocklist.
+func AddBlocklistHandler(ctx *fiber.Ctx) error {
+	var body LocalBlocklistRequest
+
+	if err := ctx.BodyParser(&body); err != nil || len(body.Entries) < 1 {
+		return ctx.Status(http.StatusBadRequest).SendString("Request body must be a JSON object with a non-empty 'entries' array")
+	}
+
+	entries, err := AddLocalBlocklistEntries(ctx.UserContext(), body.Entries, body.Reason, ctx.IP())
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidBlocklistEntry) {
+			return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(entries)
+}
+
+// RemoveBlocklistHandler removes hosts or networks from the local blocklist.
+func RemoveBlocklistHandler(ctx *fiber.Ctx) error {
+	var body LocalBlocklistRequest
+
+	if err := ctx.BodyParser(&body); err != nil || len(body.Entries) < 1 {
+		return ctx.Status(http.StatusBadRequest).SendString("Request body must be a JSON object with a non-empty 'entries' array")
+	}
+
+	entries, err := RemoveLocalBlocklistEntries(ctx.UserContext(), body.Entries, body.Reason, ctx.IP())
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidBlocklistEntry) {
+			return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+
+		return err
+	}
+
+	return ctx.JSON(entries)
+}
+
+// ExportBlocklistHandler returns the local blocklist as plain text with one entry per line, in the same format that
+// is accepted when adding entries, so that it can be shared with and imported by other instances.
+func ExportBlocklistHandler(ctx *fiber.Ctx) error {
+	entries := localBlocklist.List()
+
+	lines := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		lines = append(lines, entry.Entry)
+	}
+
+	ctx.Set("Content-Disposition", `attachment; filename="blocklist.txt"`)
+
+	return ctx.Type("txt").SendString(strings.Join(lines, "\n"))
+}
+
+// BlocklistAuditHandler returns the most recent changes made to the local blocklist.
+func BlocklistAuditHandler(ctx *fiber.Ctx) error {
+	limit := ctx.QueryInt("limit", 100)
+
+	if limit < 1 || limit > localBlocklistAuditMax {
+		return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Invalid 'limit' query parameter, must be between 1 and %d", localBlocklistAuditMax))
+	}
+
+	events, err := GetBlocklistAudit(ctx.UserContext(), int64(limit))
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(events)
+}
+
+// ExplainBlockedHandler returns the single blocklist pattern that the host matches, so that server owners can see why
+// their server is flagged as blocked without exposing any other blocklist entries.
+func ExplainBlockedHandler(ctx *fiber.Ctx) error {
+	host, _, err := ParseAddress(ctx.Params("host"), 0)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid host value")
+	}
+
+	match := MatchBlockedAddress(host)
+
+	return ctx.JSON(BlocklistExplanation{
+		Host:    strings.ToLower(host),
+		Blocked: match != nil,
+		Match:   match,
+	})
+}
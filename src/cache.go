@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+const (
+	// CacheBackendRedis stores cached responses in Redis.
+	CacheBackendRedis = "redis"
+	// CacheBackendMemcached stores cached responses in Memcached.
+	CacheBackendMemcached = "memcached"
+
+	// memcachedMaxRelativeExpiration is the longest expiration that Memcached accepts in seconds, longer ones are
+	// interpreted as a Unix timestamp.
+	memcachedMaxRelativeExpiration = 60 * 60 * 24 * 30
+	memcachedLockDuration          = time.Second * 10
+	memcachedLockInterval          = time.Millisecond * 50
+)
+
+var (
+	cacheStore Cache      = r
+	mc         *Memcached = &Memcached{}
+)
+
+// Cache stores cached responses, such as statuses, icons and translations. Redis is used unless Memcached is selected
+// in the configuration. Other state, such as owner tokens, debug sessions and the probe queue, is always kept in Redis.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, time.Duration, error)
+	GetOrSet(ctx context.Context, key string, fetch func() ([]byte, error), ttl time.Duration, validate CacheValidator) ([]byte, CacheResult, error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	TTLs(ctx context.Context, keys ...string) ([]time.Duration, error)
+}
+
+// Memcached is a wrapper around the Memcached client. Values are prefixed with their expiration time, as Memcached
+// does not report the remaining TTL of a key.
+type Memcached struct {
+	Client *memcache.Client
+}
+
+// Connect creates the client for the configured Memcached servers and checks that they can be reached.
+func (m *Memcached) Connect() error {
+	if len(config.Memcached) < 1 {
+		return errors.New("missing Memcached configuration")
+	}
+
+	m.Client = memcache.New(config.Memcached...)
+	m.Client.Timeout = defaultTimeout
+
+	return m.Client.Ping()
+}
+
+// Get retrieves the value and TTL for a given key.
+func (m *Memcached) Get(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	if m.Client == nil {
+		return nil, 0, nil
+	}
+
+	item, err := m.Client.Get(key)
+
+	if err != nil {
+		if err == memcache.ErrCacheMiss {
+			return nil, 0, nil
+		}
+
+		return nil, 0, err
+	}
+
+	data, ttl, ok := decodeMemcachedValue(item.Value)
+
+	if !ok {
+		return nil, 0, nil
+	}
+
+	return data, ttl, nil
+}
+
+// GetOrSet returns the cached value of the key, or calls fetch and caches its result for the TTL on a miss, with the
+// same semantics as the Redis implementation. Concurrent misses are serialized with a lock key when locks are enabled.
+func (m *Memcached) GetOrSet(ctx context.Context, key string, fetch func() ([]byte, error), ttl time.Duration, validate CacheValidator) ([]byte, CacheResult, error) {
+	if m.Client == nil {
+		data, err := fetch()
+
+		return data, CacheResult{Hit: false, TTL: ttl}, err
+	}
+
+	lookup := func() ([]byte, CacheResult, bool, error) {
+		data, remaining, err := m.Get(ctx, key)
+
+		if err != nil || data == nil {
+			return nil, CacheResult{}, false, err
+		}
+
+		if validate == nil {
+			return data, CacheResult{Hit: true, TTL: remaining}, true, nil
+		}
+
+		remaining, ok := validate(data, remaining)
+
+		return data, CacheResult{Hit: true, TTL: remaining}, ok, nil
+	}
+
+	if data, result, ok, err := lookup(); err != nil || ok {
+		return data, result, err
+	}
+
+	// Wait for any other processes to finish fetching the same value, then check whether they cached it
+	if config.Cache.EnableLocks {
+		unlock, err := m.lock(ctx, fmt.Sprintf("lock:%s", key))
+
+		if err != nil {
+			return nil, CacheResult{}, err
+		}
+
+		defer unlock()
+
+		if data, result, ok, err := lookup(); err != nil || ok {
+			return data, result, err
+		}
+	}
+
+	data, err := fetch()
+
+	if err != nil {
+		return nil, CacheResult{}, err
+	}
+
+	// A stale value rejected by the validator is overwritten, anything else written in the meantime is kept
+	if validate != nil {
+		return data, CacheResult{Hit: false, TTL: ttl}, m.Set(ctx, key, data, ttl)
+	}
+
+	err = m.Client.Add(newMemcachedItem(key, data, ttl))
+
+	if err == memcache.ErrNotStored {
+		if stored, remaining, err := m.Get(ctx, key); err != nil || stored != nil {
+			return stored, CacheResult{Hit: true, TTL: remaining}, err
+		}
+
+		return data, CacheResult{Hit: false, TTL: ttl}, m.Set(ctx, key, data, ttl)
+	}
+
+	return data, CacheResult{Hit: false, TTL: ttl}, err
+}
+
+// Set sets the value and TTL for a given key. A TTL of zero never expires.
+func (m *Memcached) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if m.Client == nil {
+		return nil
+	}
+
+	var data []byte
+
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		data = []byte(fmt.Sprint(v))
+	}
+
+	return m.Client.Set(newMemcachedItem(key, data, ttl))
+}
+
+// Delete deletes the given keys, ignoring keys that do not exist.
+func (m *Memcached) Delete(ctx context.Context, keys ...string) error {
+	if m.Client == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := m.Client.Delete(key); err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TTLs returns the remaining TTL of each of the given keys, which is -2 for keys that do not exist and -1 for keys
+// that never expire, matching Redis.
+func (m *Memcached) TTLs(ctx context.Context, keys ...string) ([]time.Duration, error) {
+	result := make([]time.Duration, len(keys))
+
+	if m.Client == nil {
+		return result, nil
+	}
+
+	items, err := m.Client.GetMulti(keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		item, ok := items[key]
+
+		if !ok {
+			result[i] = -2
+
+			continue
+		}
+
+		_, ttl, ok := decodeMemcachedValue(item.Value)
+
+		switch {
+		case !ok:
+			result[i] = -2
+		case ttl == 0:
+			result[i] = -1
+		default:
+			result[i] = ttl
+		}
+	}
+
+	return result, nil
+}
+
+// Close closes the idle connections of the Memcached client.
+func (m *Memcached) Close() error {
+	if m.Client == nil {
+		return nil
+	}
+
+	return m.Client.Close()
+}
+
+// lock acquires the lock key, waiting for as long as another process holds it, and returns the function releasing it.
+// Locks expire on their own in case the process holding them goes away.
+func (m *Memcached) lock(ctx context.Context, key string) (func(), error) {
+	for {
+		err := m.Client.Add(&memcache.Item{
+			Key:        key,
+			Value:      []byte{1},
+			Expiration: int32(memcachedLockDuration.Seconds()),
+		})
+
+		if err == nil {
+			return func() { m.Client.Delete(key) }, nil
+		}
+
+		if err != memcache.ErrNotStored {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(memcachedLockInterval):
+		}
+	}
+}
+
+func newMemcachedItem(key string, data []byte, ttl time.Duration) *memcache.Item {
+	var (
+		expiresAt  int64 = 0
+		expiration int32 = 0
+	)
+
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixMilli()
+		expiration = int32(math.Ceil(ttl.Seconds()))
+
+		if expiration > memcachedMaxRelativeExpiration {
+			expiration = int32(time.Now().Add(ttl).Unix())
+		}
+	}
+
+	value := make([]byte, 8, 8+len(data))
+
+	binary.BigEndian.PutUint64(value, uint64(expiresAt))
+
+	return &memcache.Item{
+		Key:        key,
+		Value:      append(value, data...),
+		Expiration: expiration,
+	}
+}
+
+// decodeMemcachedValue returns the data of a stored value and its remaining TTL, which is zero if it never expires,
+// or false if the value is malformed or already expired.
+func decodeMemcachedValue(value []byte) ([]byte, time.Duration, bool) {
+	if len(value) < 8 {
+		return nil, 0, false
+	}
+
+	expiresAt := int64(binary.BigEndian.Uint64(value))
+
+	if expiresAt == 0 {
+		return value[8:], 0, true
+	}
+
+	ttl := time.Until(time.UnixMilli(expiresAt))
+
+	if ttl <= 0 {
+		return nil, 0, false
+	}
+
+	return value[8:], ttl, true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetSurrogateKey returns the surrogate key shared by every response about the given hostname.
+func GetSurrogateKey(hostname string) string {
+	return fmt.Sprintf("host:%s", hostname)
+}
+
+// SetSurrogateKey tags the response with the surrogate key of the hostname so edge caches can purge it.
+func SetSurrogateKey(ctx *fiber.Ctx, hostname string) {
+	key := GetSurrogateKey(hostname)
+
+	ctx.Set("Surrogate-Key", key)
+
+	if config.CDN.Cloudflare != nil {
+		ctx.Set("Cache-Tag", key)
+	}
+}
+
+// PurgeSurrogateKey requests every configured CDN to purge all responses tagged with the surrogate key.
+func PurgeSurrogateKey(ctx context.Context, key string) error {
+	if config.CDN.Fastly != nil {
+		if err := purgeFastly(ctx, key); err != nil {
+			return fmt.Errorf("fastly: %w", err)
+		}
+	}
+
+	if config.CDN.Cloudflare != nil {
+		if err := purgeCloudflare(ctx, key); err != nil {
+			return fmt.Errorf("cloudflare: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func purgeFastly(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("https://api.fastly.com/service/%s/purge/%s", url.PathEscape(config.CDN.Fastly.ServiceID), url.PathEscape(key)), nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Fastly-Key", config.CDN.Fastly.APIToken)
+
+	return sendPurgeRequest(req)
+}
+
+func purgeCloudflare(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	body, err := json.Marshal(map[string][]string{"tags": {key}})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", url.PathEscape(config.CDN.Cloudflare.ZoneID)), bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.CDN.Cloudflare.APIToken))
+	req.Header.Set("Content-Type", "application/json")
+
+	return sendPurgeRequest(req)
+}
+
+func sendPurgeRequest(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -2,49 +2,619 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+const redactedConfigValue = "REDACTED"
+
 var (
 	// DefaultConfig is the default configuration values used by the application.
 	DefaultConfig *Config = &Config{
-		Environment: "production",
-		Host:        "127.0.0.1",
-		Port:        3001,
-		MongoDB:     nil,
-		Redis:       nil,
+		Environment:   "production",
+		Host:          "127.0.0.1",
+		Port:          3001,
+		MongoDB:       nil,
+		Redis:         nil,
+		Memcached:     []string{},
+		AdminToken:    nil,
+		CanonicalJSON: false,
+		RedisCluster:  []string{},
+		RedisSentinel: ConfigRedisSentinel{
+			MasterName: nil,
+			Addresses:  []string{},
+			Password:   nil,
+		},
 		Cache: ConfigCache{
+			Backend:               CacheBackendRedis,
 			EnableLocks:           true,
 			JavaStatusDuration:    time.Minute,
 			BedrockStatusDuration: time.Minute,
 			IconDuration:          time.Minute * 15,
+			IconFromStatus:        true,
+			QueryDuration:         time.Minute,
+		},
+		Lookup: ConfigLookup{
+			ReverseDNS:             false,
+			ReverseDNSTimeout:      time.Second,
+			JavaPortOverrides:      map[string]uint16{},
+			BedrockPortOverrides:   map[string]uint16{},
+			OfflineReprobes:        0,
+			OfflineReprobeDelay:    time.Millisecond * 250,
+			OfflineQuorum:          2,
+			RecentlyOnlineDuration: time.Hour,
+			MinProbeInterval:       0,
+			FrontingDetection:      false,
+			FrontingTimeout:        time.Millisecond * 500,
+			QueryTimeout:           time.Second * 5,
+			MaxRawSize:             65536,
+		},
+		Shadow: ConfigShadow{
+			SampleRate: 0,
+			Candidates: map[string]string{
+				"java":    "mcutil-raw",
+				"bedrock": "mcutil",
+			},
+		},
+		SignedURLs: ConfigSignedURLs{
+			Secret:           nil,
+			Keys:             []ConfigSigningKey{},
+			TTL:              time.Hour,
+			RequireForImages: false,
+		},
+		CDN: ConfigCDN{
+			Fastly:     nil,
+			Cloudflare: nil,
+		},
+		Fixtures: ConfigFixtures{
+			Directory:    "fixtures",
+			EnableReplay: false,
+		},
+		Storage: ConfigStorage{
+			Backend:   StorageBackendLocal,
+			Directory: "artifacts",
+			S3:        nil,
+			URLTTL:    time.Minute * 15,
+		},
+		Tenants: []ConfigTenant{},
+		Limits: ConfigLimits{
+			MaxRequestSize:    1024 * 128,
+			RouteRequestSizes: map[string]uint{},
+		},
+		Metrics: ConfigMetrics{
+			Enable:           false,
+			LargestCacheKeys: 100,
+		},
+		Aliases: ConfigAliases{
+			File:           nil,
+			ReloadInterval: time.Second * 10,
+		},
+		Deprecations: []ConfigDeprecation{},
+		AccessControl: ConfigAccessControl{
+			Enable:         false,
+			AllowedOrigins: []string{"*"},
+			MaxAge:         time.Minute * 10,
+			AllowJSONP:     false,
+		},
+		Compression: ConfigCompression{
+			Enable: false,
+			Level:  1,
+		},
+		Features:    map[string]ConfigFeature{},
+		Experiments: map[string]ConfigExperiment{},
+		TargetProtection: ConfigTargetProtection{
+			Enable:          true,
+			AllowedNetworks: []string{},
+			BlockedNetworks: []string{},
+		},
+		RateLimit: ConfigRateLimit{
+			Enable:            false,
+			RequestsPerMinute: 120,
+			Burst:             30,
+			Exclude:           []string{"/ping", "/health", "/ready", "/metrics"},
+			ProxyHeader:       nil,
+			TrustedProxies:    []string{},
+		},
+		APIKeys: ConfigAPIKeys{
+			Enable:            false,
+			Require:           false,
+			DefaultDailyQuota: 10000,
+			DefaultRateLimit:  60,
+		},
+		Formatting: ConfigFormatting{
+			Palette: map[string]string{},
+		},
+		Subscriptions: ConfigSubscriptions{
+			Enable:              false,
+			RefreshInterval:     time.Second * 5,
+			MaxPerConnection:    25,
+			MaxConnections:      10000,
+			MaxConnectionsPerIP: 16,
+		},
+		HotRefresh: ConfigHotRefresh{
+			Enable:        false,
+			Window:        time.Minute * 10,
+			MinRequests:   10,
+			MaxTargets:    100,
+			RefreshBefore: time.Second * 10,
+			Interval:      time.Second * 5,
+			Workers:       8,
+		},
+		Analytics: ConfigAnalytics{
+			Enable:        false,
+			Database:      "analytics.db",
+			FlushInterval: time.Second * 10,
+			Retention:     time.Hour * 24 * 90,
+		},
+		Events: ConfigEvents{
+			Enable:        false,
+			Backend:       EventBackendKafka,
+			Brokers:       []string{},
+			Topic:         "ping-server.{edition}.{type}",
+			Serialization: EventSerializationJSON,
+			QueueSize:     10000,
+			BatchSize:     100,
+			StateExpiry:   time.Hour * 24,
+		},
+		GraphQL: ConfigGraphQL{
+			Enable:     false,
+			MaxLookups: 10,
+		},
+		LANDiscovery: ConfigLANDiscovery{
+			Enable:             false,
+			BroadcastAddresses: []string{"255.255.255.255"},
+			Ports:              []uint16{19132, 19133},
+			Interval:           time.Second * 15,
+			Expiry:             time.Minute,
+		},
+		Translation: ConfigTranslation{
+			LibreTranslate: nil,
+			Languages:      []string{},
+			Timeout:        time.Second * 2,
+			CacheDuration:  time.Hour * 24,
+		},
+		Performance: ConfigPerformance{
+			Profile:       PerformanceProfileDefault,
+			GCPercent:     nil,
+			MemoryLimit:   nil,
+			MaxPlayerList: 0,
+		},
+		Prober: ConfigProber{
+			Workers:        16,
+			QueueTimeout:   time.Second * 5,
+			MaxQueueLength: 10000,
+		},
+		Tarpit: ConfigTarpit{
+			Enable:        false,
+			MinThroughput: 256,
+			Window:        time.Second,
+			Cooldown:      time.Minute * 15,
+		},
+		Tracing: ConfigTracing{
+			ForcedSamplesPerHour: 10,
+			Retention:            time.Hour * 24,
+		},
+		Diagnostics: ConfigDiagnostics{
+			ProfileDirectory:        "profiles",
+			MaxProfileDuration:      time.Minute,
+			MaxDebugSessionDuration: time.Hour,
+			ICMPCheck:               false,
+			ICMPTimeout:             time.Second,
 		},
 	}
 )
 
 // Config represents the application configuration.
 type Config struct {
-	Environment string      `yaml:"environment"`
-	Host        string      `yaml:"host"`
-	Port        uint16      `yaml:"port"`
-	MongoDB     *string     `yaml:"mongodb"`
-	Redis       *string     `yaml:"redis"`
-	Cache       ConfigCache `yaml:"cache"`
+	Environment      string                      `yaml:"environment"`
+	Host             string                      `yaml:"host"`
+	Port             uint16                      `yaml:"port"`
+	MongoDB          *string                     `yaml:"mongodb"`
+	Redis            *string                     `yaml:"redis"`
+	RedisCluster     []string                    `yaml:"redis_cluster"`
+	RedisSentinel    ConfigRedisSentinel         `yaml:"redis_sentinel"`
+	Memcached        []string                    `yaml:"memcached"`
+	AdminToken       *string                     `yaml:"admin_token"`
+	CanonicalJSON    bool                        `yaml:"canonical_json"`
+	Cache            ConfigCache                 `yaml:"cache"`
+	Lookup           ConfigLookup                `yaml:"lookup"`
+	Shadow           ConfigShadow                `yaml:"shadow"`
+	SignedURLs       ConfigSignedURLs            `yaml:"signed_urls"`
+	CDN              ConfigCDN                   `yaml:"cdn"`
+	Fixtures         ConfigFixtures              `yaml:"fixtures"`
+	Storage          ConfigStorage               `yaml:"storage"`
+	Tenants          []ConfigTenant              `yaml:"tenants"`
+	Limits           ConfigLimits                `yaml:"limits"`
+	Metrics          ConfigMetrics               `yaml:"metrics"`
+	Diagnostics      ConfigDiagnostics           `yaml:"diagnostics"`
+	Tracing          ConfigTracing               `yaml:"tracing"`
+	Aliases          ConfigAliases               `yaml:"aliases"`
+	Performance      ConfigPerformance           `yaml:"performance"`
+	Prober           ConfigProber                `yaml:"prober"`
+	Tarpit           ConfigTarpit                `yaml:"tarpit"`
+	Deprecations     []ConfigDeprecation         `yaml:"deprecations"`
+	Translation      ConfigTranslation           `yaml:"translation"`
+	AccessControl    ConfigAccessControl         `yaml:"access_control"`
+	Compression      ConfigCompression           `yaml:"compression"`
+	Subscriptions    ConfigSubscriptions         `yaml:"subscriptions"`
+	Events           ConfigEvents                `yaml:"events"`
+	GraphQL          ConfigGraphQL               `yaml:"graphql"`
+	LANDiscovery     ConfigLANDiscovery          `yaml:"lan_discovery"`
+	Analytics        ConfigAnalytics             `yaml:"analytics"`
+	HotRefresh       ConfigHotRefresh            `yaml:"hot_refresh"`
+	Formatting       ConfigFormatting            `yaml:"formatting"`
+	APIKeys          ConfigAPIKeys               `yaml:"api_keys"`
+	RateLimit        ConfigRateLimit             `yaml:"rate_limit"`
+	TargetProtection ConfigTargetProtection      `yaml:"target_protection"`
+	Features         map[string]ConfigFeature    `yaml:"features"`
+	Experiments      map[string]ConfigExperiment `yaml:"experiments"`
+}
+
+// ConfigFeature represents the rollout of a feature flag, which applies to the requests made with one of its API keys
+// and to the given percentage of all other requests.
+type ConfigFeature struct {
+	Percentage float64  `yaml:"percentage" json:"percentage"`
+	APIKeys    []string `yaml:"api_keys" json:"api_keys"`
+}
+
+// ConfigExperiment represents an experiment that splits the servers into buckets by weight, each looked up with the
+// tunables of its variant, so that the effect of the tunables can be compared through the metrics.
+type ConfigExperiment struct {
+	Enable   bool                               `yaml:"enable"`
+	Variants map[string]ConfigExperimentVariant `yaml:"variants"`
+}
+
+// ConfigExperimentVariant represents a single variant of an experiment. Tunables that are left empty use the global
+// configuration, which makes a variant without any tunable the control group.
+type ConfigExperimentVariant struct {
+	Weight         uint                     `yaml:"weight"`
+	CacheDurations map[string]time.Duration `yaml:"cache_durations"`
+}
+
+// ConfigRedisSentinel represents the Sentinel deployment used to find the current Redis master, which lets the server
+// follow a failover without being restarted.
+type ConfigRedisSentinel struct {
+	MasterName *string  `yaml:"master_name"`
+	Addresses  []string `yaml:"addresses"`
+	Password   *string  `yaml:"password"`
+}
+
+// ConfigTargetProtection represents the restrictions on the addresses that status lookups may connect to, which keep
+// the service from being used to probe internal networks.
+type ConfigTargetProtection struct {
+	Enable          bool     `yaml:"enable"`
+	AllowedNetworks []string `yaml:"allowed_networks"`
+	BlockedNetworks []string `yaml:"blocked_networks"`
+}
+
+// ConfigRateLimit represents the settings of the per-IP rate limiting shared by every instance through Redis.
+type ConfigRateLimit struct {
+	Enable            bool     `yaml:"enable"`
+	RequestsPerMinute uint     `yaml:"requests_per_minute"`
+	Burst             uint     `yaml:"burst"`
+	Exclude           []string `yaml:"exclude"`
+	ProxyHeader       *string  `yaml:"proxy_header"`
+	TrustedProxies    []string `yaml:"trusted_proxies"`
+}
+
+// ConfigAPIKeys represents the settings of the API keys provisioned through the admin API.
+type ConfigAPIKeys struct {
+	Enable            bool `yaml:"enable"`
+	Require           bool `yaml:"require"`
+	DefaultDailyQuota uint `yaml:"default_daily_quota"`
+	DefaultRateLimit  uint `yaml:"default_rate_limit"`
+}
+
+// ConfigFormatting represents the settings of the HTML output of formatted text such as MOTDs.
+type ConfigFormatting struct {
+	Palette map[string]string `yaml:"palette"`
+}
+
+// ConfigSubscriptions represents the settings of the WebSocket status subscriptions at /ws.
+type ConfigSubscriptions struct {
+	Enable              bool          `yaml:"enable"`
+	RefreshInterval     time.Duration `yaml:"refresh_interval"`
+	MaxPerConnection    uint          `yaml:"max_per_connection"`
+	MaxConnections      uint          `yaml:"max_connections"`
+	MaxConnectionsPerIP uint          `yaml:"max_connections_per_ip"`
+}
+
+// ConfigLANDiscovery represents the settings used to find Bedrock Edition servers on the local network, which are
+// listed at /discover/lan.
+type ConfigLANDiscovery struct {
+	Enable             bool          `yaml:"enable"`
+	BroadcastAddresses []string      `yaml:"broadcast_addresses"`
+	Ports              []uint16      `yaml:"ports"`
+	Interval           time.Duration `yaml:"interval"`
+	Expiry             time.Duration `yaml:"expiry"`
+}
+
+// ConfigHotRefresh represents the settings of the background refresh of frequently requested servers.
+type ConfigHotRefresh struct {
+	Enable        bool          `yaml:"enable"`
+	Window        time.Duration `yaml:"window"`
+	MinRequests   uint          `yaml:"min_requests"`
+	MaxTargets    uint          `yaml:"max_targets"`
+	RefreshBefore time.Duration `yaml:"refresh_before"`
+	Interval      time.Duration `yaml:"interval"`
+	Workers       uint          `yaml:"workers"`
+}
+
+// ConfigAnalytics represents the settings of the request analytics stored in an embedded SQLite database.
+type ConfigAnalytics struct {
+	Enable        bool          `yaml:"enable"`
+	Database      string        `yaml:"database"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	Retention     time.Duration `yaml:"retention"`
+}
+
+// ConfigEvents represents the publisher that streams status refreshes and state changes to a Kafka or NATS cluster.
+type ConfigEvents struct {
+	Enable        bool          `yaml:"enable"`
+	Backend       string        `yaml:"backend"`
+	Brokers       []string      `yaml:"brokers"`
+	Topic         string        `yaml:"topic"`
+	Serialization string        `yaml:"serialization"`
+	QueueSize     uint          `yaml:"queue_size"`
+	BatchSize     uint          `yaml:"batch_size"`
+	StateExpiry   time.Duration `yaml:"state_expiry"`
+}
+
+// ConfigGraphQL represents the GraphQL route, which looks up several servers in a single request.
+type ConfigGraphQL struct {
+	Enable     bool `yaml:"enable"`
+	MaxLookups uint `yaml:"max_lookups"`
+}
+
+// ConfigAccessControl represents the cross-origin resource sharing settings used by browser clients.
+type ConfigAccessControl struct {
+	Enable         bool          `yaml:"enable"`
+	AllowedOrigins []string      `yaml:"allowed_origins"`
+	MaxAge         time.Duration `yaml:"max_age"`
+	AllowJSONP     bool          `yaml:"allow_jsonp"`
+}
+
+// ConfigCompression represents the compression of response bodies, negotiated with the Accept-Encoding header of
+// each request.
+type ConfigCompression struct {
+	Enable bool `yaml:"enable"`
+	Level  int  `yaml:"level"`
 }
 
 // ConfigCache represents the caching durations of various responses.
 type ConfigCache struct {
+	Backend               string        `yaml:"backend"`
 	EnableLocks           bool          `yaml:"enable_locks"`
 	JavaStatusDuration    time.Duration `yaml:"java_status_duration"`
 	BedrockStatusDuration time.Duration `yaml:"bedrock_status_duration"`
 	IconDuration          time.Duration `yaml:"icon_duration"`
+	IconFromStatus        bool          `yaml:"icon_from_status"`
+	QueryDuration         time.Duration `yaml:"query_duration"`
+}
+
+// ConfigShadow represents the shadow lookups that compare the status retrieved by a candidate implementation of a
+// protocol with the one retrieved by the current implementation.
+type ConfigShadow struct {
+	SampleRate float64           `yaml:"sample_rate"`
+	Candidates map[string]string `yaml:"candidates"`
+}
+
+// ConfigLookup represents the optional enrichment steps performed while fetching a status.
+type ConfigLookup struct {
+	ReverseDNS             bool              `yaml:"reverse_dns"`
+	ReverseDNSTimeout      time.Duration     `yaml:"reverse_dns_timeout"`
+	JavaPortOverrides      map[string]uint16 `yaml:"java_port_overrides"`
+	BedrockPortOverrides   map[string]uint16 `yaml:"bedrock_port_overrides"`
+	OfflineReprobes        uint              `yaml:"offline_reprobes"`
+	OfflineReprobeDelay    time.Duration     `yaml:"offline_reprobe_delay"`
+	OfflineQuorum          uint              `yaml:"offline_quorum"`
+	RecentlyOnlineDuration time.Duration     `yaml:"recently_online_duration"`
+	MinProbeInterval       time.Duration     `yaml:"min_probe_interval"`
+	FrontingDetection      bool              `yaml:"fronting_detection"`
+	FrontingTimeout        time.Duration     `yaml:"fronting_timeout"`
+	QueryTimeout           time.Duration     `yaml:"query_timeout"`
+	MaxRawSize             int               `yaml:"max_raw_size"`
+}
+
+// ConfigSignedURLs represents the settings used to sign and verify time-limited image URLs.
+type ConfigSignedURLs struct {
+	Secret           *string            `yaml:"secret"`
+	Keys             []ConfigSigningKey `yaml:"keys"`
+	TTL              time.Duration      `yaml:"ttl"`
+	RequireForImages bool               `yaml:"require_for_images"`
+}
+
+// ConfigSigningKey represents a key that signs and verifies URLs within its validity window. The window of the next key
+// should start before the window of the previous key ends, so that the URLs signed by either key stay valid.
+type ConfigSigningKey struct {
+	ID        string     `yaml:"id" json:"id"`
+	Secret    string     `yaml:"secret" json:"secret"`
+	NotBefore *time.Time `yaml:"not_before" json:"not_before"`
+	NotAfter  *time.Time `yaml:"not_after" json:"not_after"`
+}
+
+// ConfigCDN represents the edge caches that are purged alongside the origin cache.
+type ConfigCDN struct {
+	Fastly     *ConfigFastly     `yaml:"fastly"`
+	Cloudflare *ConfigCloudflare `yaml:"cloudflare"`
+}
+
+// ConfigFastly represents the credentials used to purge Fastly surrogate keys.
+type ConfigFastly struct {
+	ServiceID string `yaml:"service_id"`
+	APIToken  string `yaml:"api_token"`
+}
+
+// ConfigCloudflare represents the credentials used to purge Cloudflare cache tags.
+type ConfigCloudflare struct {
+	ZoneID   string `yaml:"zone_id"`
+	APIToken string `yaml:"api_token"`
+}
+
+// ConfigFixtures represents the storage and replay settings of recorded protocol fixtures.
+type ConfigFixtures struct {
+	Directory    string `yaml:"directory"`
+	EnableReplay bool   `yaml:"enable_replay"`
+}
+
+// ConfigStorage represents the storage of large artifacts, such as icon overrides and support bundles, which are
+// delivered through signed URLs.
+type ConfigStorage struct {
+	Backend   string        `yaml:"backend"`
+	Directory string        `yaml:"directory"`
+	S3        *ConfigS3     `yaml:"s3"`
+	URLTTL    time.Duration `yaml:"url_ttl"`
+}
+
+// ConfigS3 represents the bucket of an S3-compatible object storage service that artifacts are stored in.
+type ConfigS3 struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	Prefix          string `yaml:"prefix"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	UseSSL          bool   `yaml:"use_ssl"`
+	PathStyle       bool   `yaml:"path_style"`
+}
+
+// ConfigTenant represents a named profile with its own policies, selected by API key or Host header.
+type ConfigTenant struct {
+	Name           string                 `yaml:"name"`
+	Hosts          []string               `yaml:"hosts"`
+	APIKeys        []string               `yaml:"api_keys"`
+	AllowedTargets []string               `yaml:"allowed_targets"`
+	Cache          *ConfigCache           `yaml:"cache"`
+	RateLimit      *ConfigTenantRateLimit `yaml:"rate_limit"`
+}
+
+// ConfigTenantRateLimit represents the rate limit shared by every request of a tenant, which replaces the per-IP rate
+// limit for those requests.
+type ConfigTenantRateLimit struct {
+	RequestsPerMinute uint `yaml:"requests_per_minute"`
+	Burst             uint `yaml:"burst"`
+}
+
+// ConfigLimits represents the maximum sizes of request bodies, in bytes.
+type ConfigLimits struct {
+	MaxRequestSize    uint            `yaml:"max_request_size"`
+	RouteRequestSizes map[string]uint `yaml:"route_request_sizes"`
+}
+
+// ConfigMetrics represents the settings of the Prometheus metrics endpoint.
+type ConfigMetrics struct {
+	Enable           bool `yaml:"enable"`
+	LargestCacheKeys uint `yaml:"largest_cache_keys"`
+}
+
+// ConfigDiagnostics represents the settings of the runtime diagnostics exposed under /admin/debug.
+type ConfigDiagnostics struct {
+	ProfileDirectory        string        `yaml:"profile_directory"`
+	MaxProfileDuration      time.Duration `yaml:"max_profile_duration"`
+	MaxDebugSessionDuration time.Duration `yaml:"max_debug_session_duration"`
+	ICMPCheck               bool          `yaml:"icmp_check"`
+	ICMPTimeout             time.Duration `yaml:"icmp_timeout"`
+}
+
+// ConfigTracing represents the settings of the request tracing that clients can force for single requests.
+type ConfigTracing struct {
+	ForcedSamplesPerHour uint          `yaml:"forced_samples_per_hour"`
+	Retention            time.Duration `yaml:"retention"`
+}
+
+// ConfigAliases represents the location of the aliases file and how often it is checked for changes.
+type ConfigAliases struct {
+	File           *string       `yaml:"file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// ConfigPerformance represents the tuning of the process for the hardware it runs on. The profile lowers the limits of
+// the other sections and provides the defaults of the garbage collector settings, which are left to the runtime if
+// unset or if the GOGC and GOMEMLIMIT environment variables are defined.
+type ConfigPerformance struct {
+	Profile       string `yaml:"profile"`
+	GCPercent     *int   `yaml:"gc_percent"`
+	MemoryLimit   *int64 `yaml:"memory_limit"`
+	MaxPlayerList uint   `yaml:"max_player_list"`
+}
+
+// ConfigProber represents the probe queue shared by processes started with the api and prober roles.
+type ConfigProber struct {
+	Workers        uint          `yaml:"workers"`
+	QueueTimeout   time.Duration `yaml:"queue_timeout"`
+	MaxQueueLength uint          `yaml:"max_queue_length"`
+}
+
+// ConfigTarpit represents the detection of hostile servers that accept connections but send their responses too slowly
+// to ever finish, tying up a probe for its whole timeout.
+type ConfigTarpit struct {
+	Enable        bool          `yaml:"enable"`
+	MinThroughput uint          `yaml:"min_throughput"`
+	Window        time.Duration `yaml:"window"`
+	Cooldown      time.Duration `yaml:"cooldown"`
+}
+
+// ConfigDeprecation represents a deprecated group of routes, matched by path prefix.
+type ConfigDeprecation struct {
+	Path         string     `yaml:"path"`
+	DeprecatedAt time.Time  `yaml:"deprecated_at"`
+	SunsetAt     *time.Time `yaml:"sunset_at"`
+	Link         string     `yaml:"link"`
+	Hint         string     `yaml:"hint"`
+}
+
+// ConfigTranslation represents the provider used to translate MOTDs into the language requested by clients.
+type ConfigTranslation struct {
+	LibreTranslate *ConfigLibreTranslate `yaml:"libretranslate"`
+	Languages      []string              `yaml:"languages"`
+	Timeout        time.Duration         `yaml:"timeout"`
+	CacheDuration  time.Duration         `yaml:"cache_duration"`
+}
+
+// ConfigLibreTranslate represents the LibreTranslate instance used to translate MOTDs.
+type ConfigLibreTranslate struct {
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+}
+
+// Load reads the configuration in layers, each taking precedence over the previous ones: the base file, the overlay
+// of the environment next to it (e.g. `config.production.yml`), the secrets file and finally the environment
+// variables. The overlay and the secrets file are optional.
+func (c *Config) Load(file string) error {
+	if err := c.ReadFile(file); err != nil {
+		return err
+	}
+
+	environment := c.Environment
+
+	if value := os.Getenv("ENVIRONMENT"); value != "" {
+		environment = value
+	}
+
+	secretsFile := GetConfigLayerFile(file, "secrets")
+
+	if value := os.Getenv("CONFIG_SECRETS_FILE"); value != "" {
+		secretsFile = value
+	}
+
+	for _, layer := range []string{GetConfigLayerFile(file, environment), secretsFile} {
+		if err := c.ReadFile(layer); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s: %w", layer, err)
+		}
+	}
+
+	return c.overrideWithEnvVars()
 }
 
-// ReadFile reads the configuration from the given file and overrides values using environment variables.
+// ReadFile reads the configuration from the given file. Only the values present in the file are replaced, so that it
+// can be layered over previously read values. Lists are replaced as a whole.
 func (c *Config) ReadFile(file string) error {
 	data, err := os.ReadFile(file)
 
@@ -52,11 +622,96 @@ func (c *Config) ReadFile(file string) error {
 		return err
 	}
 
-	if err := yaml.Unmarshal(data, c); err != nil {
-		return err
+	return yaml.Unmarshal(data, c)
+}
+
+// Redacted returns a copy of the configuration with every secret and the credentials of every connection URL
+// replaced, so that it can be printed or shared.
+func (c *Config) Redacted() (*Config, error) {
+	data, err := yaml.Marshal(c)
+
+	if err != nil {
+		return nil, err
 	}
 
-	return c.overrideWithEnvVars()
+	result := &Config{}
+
+	if err = yaml.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+
+	redact := func(value *string) {
+		if value != nil && len(*value) > 0 {
+			*value = redactedConfigValue
+		}
+	}
+
+	redactURL := func(value *string) {
+		if value == nil {
+			return
+		}
+
+		if parsed, err := url.Parse(*value); err == nil {
+			*value = parsed.Redacted()
+		} else {
+			*value = redactedConfigValue
+		}
+	}
+
+	redactURL(result.Redis)
+	redactURL(result.MongoDB)
+	redact(result.AdminToken)
+	redact(result.RedisSentinel.Password)
+	redact(result.SignedURLs.Secret)
+
+	for i := range result.SignedURLs.Keys {
+		redact(&result.SignedURLs.Keys[i].Secret)
+	}
+
+	if result.CDN.Fastly != nil {
+		redact(&result.CDN.Fastly.APIToken)
+	}
+
+	if result.CDN.Cloudflare != nil {
+		redact(&result.CDN.Cloudflare.APIToken)
+	}
+
+	if result.Storage.S3 != nil {
+		redact(&result.Storage.S3.SecretAccessKey)
+	}
+
+	if result.Translation.LibreTranslate != nil {
+		redact(&result.Translation.LibreTranslate.APIKey)
+	}
+
+	// Kafka brokers are plain addresses, so only the brokers given as URLs with credentials are redacted
+	for i, broker := range result.Events.Brokers {
+		if parsed, err := url.Parse(broker); err == nil && parsed.User != nil {
+			result.Events.Brokers[i] = parsed.Redacted()
+		}
+	}
+
+	for _, tenant := range result.Tenants {
+		for i := range tenant.APIKeys {
+			redact(&tenant.APIKeys[i])
+		}
+	}
+
+	for _, feature := range result.Features {
+		for i := range feature.APIKeys {
+			redact(&feature.APIKeys[i])
+		}
+	}
+
+	return result, nil
+}
+
+// GetConfigLayerFile returns the path of a layer of the configuration file, named after the base file with the name
+// of the layer before its extension.
+func GetConfigLayerFile(file, layer string) string {
+	extension := filepath.Ext(file)
+
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(file, extension), layer, extension)
 }
 
 // WriteFile writes the configuration values to a file.
@@ -93,9 +748,78 @@ func (c *Config) overrideWithEnvVars() error {
 		c.Redis = &value
 	}
 
+	if value := os.Getenv("REDIS_CLUSTER_ADDRESSES"); value != "" {
+		c.RedisCluster = strings.Split(value, ",")
+	}
+
+	if value := os.Getenv("REDIS_SENTINEL_MASTER"); value != "" {
+		c.RedisSentinel.MasterName = &value
+	}
+
+	if value := os.Getenv("REDIS_SENTINEL_ADDRESSES"); value != "" {
+		c.RedisSentinel.Addresses = strings.Split(value, ",")
+	}
+
+	if value := os.Getenv("REDIS_SENTINEL_PASSWORD"); value != "" {
+		c.RedisSentinel.Password = &value
+	}
+
+	if value := os.Getenv("MEMCACHED_SERVERS"); value != "" {
+		c.Memcached = strings.Split(value, ",")
+	}
+
 	if value := os.Getenv("MONGO_URL"); value != "" {
 		c.MongoDB = &value
 	}
 
+	if value := os.Getenv("ADMIN_TOKEN"); value != "" {
+		c.AdminToken = &value
+	}
+
+	if value := os.Getenv("SIGNED_URL_SECRET"); value != "" {
+		c.SignedURLs.Secret = &value
+	}
+
+	// Keys are given as comma-separated `id:secret` pairs, and their secrets replace the secrets of the configured keys
+	// with the same ID, so that the validity windows can stay in the configuration file
+	if value := os.Getenv("SIGNED_URL_KEYS"); value != "" {
+		for _, pair := range strings.Split(value, ",") {
+			id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+
+			if !ok || len(id) < 1 || len(secret) < 1 {
+				return errors.New("invalid signing key in environment variable, must be formatted as 'id:secret'")
+			}
+
+			found := false
+
+			for i, key := range c.SignedURLs.Keys {
+				if key.ID == id {
+					c.SignedURLs.Keys[i].Secret = secret
+
+					found = true
+				}
+			}
+
+			if !found {
+				c.SignedURLs.Keys = append(c.SignedURLs.Keys, ConfigSigningKey{
+					ID:     id,
+					Secret: secret,
+				})
+			}
+		}
+	}
+
+	if value := os.Getenv("S3_ACCESS_KEY_ID"); value != "" && c.Storage.S3 != nil {
+		c.Storage.S3.AccessKeyID = value
+	}
+
+	if value := os.Getenv("S3_SECRET_ACCESS_KEY"); value != "" && c.Storage.S3 != nil {
+		c.Storage.S3.SecretAccessKey = value
+	}
+
+	if value := os.Getenv("LIBRETRANSLATE_API_KEY"); value != "" && c.Translation.LibreTranslate != nil {
+		c.Translation.LibreTranslate.APIKey = value
+	}
+
 	return nil
 }
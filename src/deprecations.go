@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DeprecationNotice is included in responses of deprecated routes to tell clients how to migrate.
+type DeprecationNotice struct {
+	DeprecatedAt int64  `json:"deprecated_at"`
+	SunsetAt     *int64 `json:"sunset_at"`
+	Link         string `json:"link"`
+	Hint         string `json:"hint"`
+}
+
+// GetDeprecation returns the configured deprecation matching the path, using the longest matching prefix if any.
+func GetDeprecation(path string) *ConfigDeprecation {
+	var result *ConfigDeprecation = nil
+
+	for i, deprecation := range config.Deprecations {
+		if !strings.HasPrefix(path, deprecation.Path) {
+			continue
+		}
+
+		if result == nil || len(deprecation.Path) > len(result.Path) {
+			result = &config.Deprecations[i]
+		}
+	}
+
+	return result
+}
+
+// DeprecationHeaders is a middleware that sets the Deprecation, Sunset and Link headers on deprecated routes, and
+// makes the migration hint available to handlers through GetDeprecationNotice.
+func DeprecationHeaders(ctx *fiber.Ctx) error {
+	deprecation := GetDeprecation(ctx.Path())
+
+	if deprecation == nil {
+		return ctx.Next()
+	}
+
+	ctx.Set("Deprecation", fmt.Sprintf("@%d", deprecation.DeprecatedAt.Unix()))
+
+	notice := &DeprecationNotice{
+		DeprecatedAt: deprecation.DeprecatedAt.UnixMilli(),
+		SunsetAt:     nil,
+		Link:         deprecation.Link,
+		Hint:         deprecation.Hint,
+	}
+
+	if deprecation.SunsetAt != nil {
+		ctx.Set("Sunset", deprecation.SunsetAt.UTC().Format(http.TimeFormat))
+
+		notice.SunsetAt = PointerOf(deprecation.SunsetAt.UnixMilli())
+	}
+
+	if len(deprecation.Link) > 0 {
+		ctx.Append("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, deprecation.Link))
+
+		if deprecation.SunsetAt != nil {
+			ctx.Append("Link", fmt.Sprintf(`<%s>; rel="sunset"`, deprecation.Link))
+		}
+	}
+
+	ctx.Locals("deprecation", notice)
+
+	return ctx.Next()
+}
+
+// GetDeprecationNotice returns the deprecation notice of the requested route, or nil if it is not deprecated.
+func GetDeprecationNotice(ctx *fiber.Ctx) *DeprecationNotice {
+	notice, _ := ctx.Locals("deprecation").(*DeprecationNotice)
+
+	return notice
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	cpuProfileMutex *sync.Mutex = &sync.Mutex{}
+
+	ErrProfileInProgress error = errors.New("a CPU profile is already being recorded")
+)
+
+// RuntimeStats is a snapshot of the Go runtime statistics of this process.
+type RuntimeStats struct {
+	Uptime        string        `json:"uptime"`
+	GoVersion     string        `json:"go_version"`
+	Goroutines    int           `json:"goroutines"`
+	CPUs          int           `json:"cpus"`
+	HeapAlloc     uint64        `json:"heap_alloc"`
+	HeapInuse     uint64        `json:"heap_inuse"`
+	HeapObjects   uint64        `json:"heap_objects"`
+	StackInuse    uint64        `json:"stack_inuse"`
+	Sys           uint64        `json:"sys"`
+	TotalAlloc    uint64        `json:"total_alloc"`
+	NumGC         uint32        `json:"num_gc"`
+	LastGC        *time.Time    `json:"last_gc"`
+	PauseTotal    time.Duration `json:"pause_total_ns"`
+	GCCPUFraction float64       `json:"gc_cpu_fraction"`
+}
+
+// CPUProfile is the file an on-demand CPU profile is being written to.
+type CPUProfile struct {
+	File        string    `json:"file"`
+	Duration    string    `json:"duration"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletesAt time.Time `json:"completes_at"`
+}
+
+// GetRuntimeStats returns the current Go runtime statistics.
+func GetRuntimeStats() RuntimeStats {
+	var memStats runtime.MemStats
+
+	runtime.ReadMemStats(&memStats)
+
+	result := RuntimeStats{
+		Uptime:        time.Since(startedAt).Round(time.Second).String(),
+		GoVersion:     runtime.Version(),
+		Goroutines:    runtime.NumGoroutine(),
+		CPUs:          runtime.NumCPU(),
+		HeapAlloc:     memStats.HeapAlloc,
+		HeapInuse:     memStats.HeapInuse,
+		HeapObjects:   memStats.HeapObjects,
+		StackInuse:    memStats.StackInuse,
+		Sys:           memStats.Sys,
+		TotalAlloc:    memStats.TotalAlloc,
+		NumGC:         memStats.NumGC,
+		LastGC:        nil,
+		PauseTotal:    time.Duration(memStats.PauseTotalNs),
+		GCCPUFraction: memStats.GCCPUFraction,
+	}
+
+	if memStats.LastGC > 0 {
+		result.LastGC = PointerOf(time.Unix(0, int64(memStats.LastGC)))
+	}
+
+	return result
+}
+
+// StartCPUProfile starts a CPU profile of the given duration in the background, writing it to the profile directory.
+func StartCPUProfile(duration time.Duration) (*CPUProfile, error) {
+	if !cpuProfileMutex.TryLock() {
+		return nil, ErrProfileInProgress
+	}
+
+	if err := os.MkdirAll(config.Diagnostics.ProfileDirectory, 0755); err != nil {
+		cpuProfileMutex.Unlock()
+
+		return nil, err
+	}
+
+	now := time.Now()
+
+	file, err := os.Create(filepath.Join(config.Diagnostics.ProfileDirectory, fmt.Sprintf("cpu-%d-%s.pprof", instanceID, now.UTC().Format("20060102-150405"))))
+
+	if err != nil {
+		cpuProfileMutex.Unlock()
+
+		return nil, err
+	}
+
+	if err = pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		cpuProfileMutex.Unlock()
+
+		return nil, err
+	}
+
+	go func() {
+		defer cpuProfileMutex.Unlock()
+
+		time.Sleep(duration)
+
+		pprof.StopCPUProfile()
+
+		if err := file.Close(); err != nil {
+			log.Printf("Failed to write CPU profile: %v\n", err)
+
+			return
+		}
+
+		log.Printf("Wrote CPU profile to %s\n", file.Name())
+	}()
+
+	return &CPUProfile{
+		File:        file.Name(),
+		Duration:    duration.String(),
+		StartedAt:   now,
+		CompletesAt: now.Add(duration),
+	}, nil
+}
+
+// RuntimeStatsHandler returns the current Go runtime statistics, forcing a garbage collection first if requested.
+func RuntimeStatsHandler(ctx *fiber.Ctx) error {
+	if ctx.QueryBool("gc", false) {
+		debug.FreeOSMemory()
+	}
+
+	return ctx.JSON(GetRuntimeStats())
+}
+
+// GoroutineDumpHandler returns the stack traces of every goroutine as plain text.
+func GoroutineDumpHandler(ctx *fiber.Ctx) error {
+	buf := &bytes.Buffer{}
+
+	if err := pprof.Lookup("goroutine").WriteTo(buf, 2); err != nil {
+		return err
+	}
+
+	return ctx.Type("txt").Send(buf.Bytes())
+}
+
+// CPUProfileHandler starts an on-demand CPU profile written to the configured profile directory.
+func CPUProfileHandler(ctx *fiber.Ctx) error {
+	duration := time.Second * 30
+
+	if value := ctx.Query("duration"); len(value) > 0 {
+		parsedValue, err := time.ParseDuration(value)
+
+		if err != nil || parsedValue <= 0 || parsedValue > config.Diagnostics.MaxProfileDuration {
+			return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Invalid 'duration' query parameter, must be between 0s and %s", config.Diagnostics.MaxProfileDuration))
+		}
+
+		duration = parsedValue
+	}
+
+	profile, err := StartCPUProfile(min(duration, config.Diagnostics.MaxProfileDuration))
+
+	if err != nil {
+		if errors.Is(err, ErrProfileInProgress) {
+			return ctx.Status(http.StatusConflict).SendString(err.Error())
+		}
+
+		return err
+	}
+
+	return ctx.Status(http.StatusAccepted).JSON(profile)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClientDisconnected error = errors.New("client closed the connection")
+)
+
+// ClientListener is a listener whose connections can be watched for the client closing them while a request is being
+// handled. The HTTP server only reads from a connection between requests, so it would not notice it any earlier.
+type ClientListener struct {
+	net.Listener
+}
+
+// ClientConn is a client connection that can be watched for the client closing it. The data read while watching is
+// kept and returned by the next reads, so that the HTTP server does not miss any of it.
+type ClientConn struct {
+	net.Conn
+	Buffered     []byte
+	ReadDeadline time.Time
+	Mutex        *sync.Mutex
+}
+
+// Accept waits for the next connection to the listener.
+func (l *ClientListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientConn{
+		Conn:  conn,
+		Mutex: &sync.Mutex{},
+	}, nil
+}
+
+// Read reads the data kept while watching the connection, or otherwise reads data from the connection.
+func (c *ClientConn) Read(b []byte) (int, error) {
+	c.Mutex.Lock()
+
+	if len(c.Buffered) > 0 {
+		n := copy(b, c.Buffered)
+
+		c.Buffered = c.Buffered[n:]
+
+		c.Mutex.Unlock()
+
+		return n, nil
+	}
+
+	c.Mutex.Unlock()
+
+	return c.Conn.Read(b)
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *ClientConn) SetDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection.
+func (c *ClientConn) SetReadDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Watch calls the function as soon as the client closes the connection, until the returned function is called, which
+// must happen before the connection is read from again. Watching stops early if the client sends more data, such as a
+// pipelined request, as it is still connected.
+func (c *ClientConn) Watch(disconnected func()) func() {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, 512)
+
+		n, err := c.Conn.Read(buf)
+
+		if n > 0 {
+			c.Mutex.Lock()
+
+			c.Buffered = append(c.Buffered, buf[:n]...)
+
+			c.Mutex.Unlock()
+
+			return
+		}
+
+		// The read is interrupted with a deadline once watching stops, which does not mean that the client went away
+		if err != nil && !IsTimeoutError(err) {
+			disconnected()
+		}
+	}()
+
+	return func() {
+		c.Conn.SetReadDeadline(time.Now())
+
+		<-done
+
+		c.Mutex.Lock()
+
+		defer c.Mutex.Unlock()
+
+		c.Conn.SetReadDeadline(c.ReadDeadline)
+	}
+}
+
+func (c *ClientConn) setReadDeadline(t time.Time) {
+	c.Mutex.Lock()
+
+	defer c.Mutex.Unlock()
+
+	c.ReadDeadline = t
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newClientConnPair returns a connection accepted by a client listener along with the client side of it.
+func newClientConnPair(t *testing.T) (*ClientConn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := (&ClientListener{Listener: listener}).Accept()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		conn.Close()
+	})
+
+	return conn.(*ClientConn), client
+}
+
+func TestClientConnWatchDisconnect(t *testing.T) {
+	conn, client := newClientConnPair(t)
+
+	disconnected := make(chan struct{})
+
+	stop := conn.Watch(func() {
+		close(disconnected)
+	})
+
+	defer stop()
+
+	client.Close()
+
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the disconnect to be noticed")
+	}
+}
+
+func TestClientConnWatchKeepsData(t *testing.T) {
+	conn, client := newClientConnPair(t)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+
+	stop := conn.Watch(func() {
+		t.Error("unexpected disconnect")
+	})
+
+	// The pipelined request is read while watching, and must still reach the next read
+	client.Write([]byte("GET / HTTP/1.1\r\n"))
+
+	time.Sleep(time.Millisecond * 50)
+
+	stop()
+
+	client.Write([]byte("\r\n"))
+
+	data := make([]byte, 18)
+
+	if _, err := io.ReadFull(conn, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "GET / HTTP/1.1\r\n\r\n" {
+		t.Errorf("unexpected data %q", data)
+	}
+}
+
+func TestClientConnWatchStop(t *testing.T) {
+	conn, client := newClientConnPair(t)
+
+	stop := conn.Watch(func() {
+		t.Error("unexpected disconnect")
+	})
+
+	stop()
+
+	// The deadline that interrupted the watch must not apply to the reads that come after
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+
+		client.Write([]byte("ping"))
+	}()
+
+	data := make([]byte, 4)
+
+	if _, err := io.ReadFull(conn, data); err != nil {
+		t.Fatal(err)
+	}
+}
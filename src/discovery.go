@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mcstatus-io/mcutil/v4/response"
+)
+
+var (
+	lanDiscovery *LANDiscovery = &LANDiscovery{
+		Servers: make(map[string]*LANServer),
+		Mutex:   &sync.RWMutex{},
+	}
+)
+
+// LANServer is a Bedrock Edition server found on the local network.
+type LANServer struct {
+	Host        string `json:"host"`
+	Port        uint16 `json:"port"`
+	FirstSeenAt int64  `json:"first_seen_at"`
+	LastSeenAt  int64  `json:"last_seen_at"`
+	*BedrockStatus
+}
+
+// LANDiscovery finds Bedrock Edition servers on the local network by broadcasting the unconnected pings that the game
+// sends to list LAN worlds, and keeps the servers that answered recently.
+type LANDiscovery struct {
+	Conn    *net.UDPConn
+	Servers map[string]*LANServer
+	Mutex   *sync.RWMutex
+}
+
+// Listen opens the socket used to broadcast pings and receive the answers.
+func (d *LANDiscovery) Listen() error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+
+	if err != nil {
+		return err
+	}
+
+	d.Conn = conn
+
+	return nil
+}
+
+// Close closes the socket, which stops the discovery.
+func (d *LANDiscovery) Close() error {
+	if d.Conn == nil {
+		return nil
+	}
+
+	return d.Conn.Close()
+}
+
+// Run broadcasts a ping at the interval and records the servers that answer, until the context is done.
+func (d *LANDiscovery) Run(ctx context.Context, interval time.Duration) {
+	go d.receive(ctx)
+
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		if err := d.broadcast(); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to broadcast LAN discovery ping: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// List returns the servers that answered within the configured expiry, sorted by address.
+func (d *LANDiscovery) List() []*LANServer {
+	d.Mutex.RLock()
+
+	defer d.Mutex.RUnlock()
+
+	result := make([]*LANServer, 0, len(d.Servers))
+	cutoff := time.Now().Add(-config.LANDiscovery.Expiry).UnixMilli()
+
+	for _, server := range d.Servers {
+		if server.LastSeenAt < cutoff {
+			continue
+		}
+
+		result = append(result, server)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+
+		return result[i].Port < result[j].Port
+	})
+
+	return result
+}
+
+func (d *LANDiscovery) broadcast() error {
+	ping := NewUnconnectedPing()
+
+	for _, address := range config.LANDiscovery.BroadcastAddresses {
+		ip := net.ParseIP(address)
+
+		if ip == nil {
+			return fmt.Errorf("invalid broadcast address: %s", address)
+		}
+
+		for _, port := range config.LANDiscovery.Ports {
+			if _, err := d.Conn.WriteToUDP(ping, &net.UDPAddr{IP: ip, Port: int(port)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *LANDiscovery) receive(ctx context.Context) {
+	data := make([]byte, 1500)
+
+	for {
+		n, addr, err := d.Conn.ReadFromUDP(data)
+
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Failed to receive LAN discovery pong: %v\n", err)
+			}
+
+			return
+		}
+
+		status, err := ParseUnconnectedPong(data[:n])
+
+		if err != nil {
+			continue
+		}
+
+		d.record(addr, status)
+	}
+}
+
+func (d *LANDiscovery) record(addr *net.UDPAddr, status *response.StatusBedrock) {
+	host := addr.IP.String()
+	port := uint16(addr.Port)
+
+	if status.PortIPv4 != nil {
+		port = *status.PortIPv4
+	}
+
+	result, err := BuildBedrockResponse(host, port, status, &host)
+
+	if err != nil {
+		return
+	}
+
+	key := fmt.Sprintf("%s:%d", host, port)
+	now := time.Now().UnixMilli()
+
+	d.Mutex.Lock()
+
+	defer d.Mutex.Unlock()
+
+	server, ok := d.Servers[key]
+
+	if !ok {
+		server = &LANServer{
+			Host:        host,
+			Port:        port,
+			FirstSeenAt: now,
+		}
+
+		d.Servers[key] = server
+	}
+
+	server.LastSeenAt = now
+	server.BedrockStatus = result.BedrockStatus
+}
+
+// LANServersHandler returns the Bedrock Edition servers recently found on the local network.
+func LANServersHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(lanDiscovery.List())
+}
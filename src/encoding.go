@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// MIMEApplicationMsgpack is the media type of responses encoded with MessagePack.
+	MIMEApplicationMsgpack = "application/msgpack"
+	// MIMEApplicationCBOR is the media type of responses encoded with CBOR.
+	MIMEApplicationCBOR = "application/cbor"
+
+	// mimeApplicationXMsgpack is the unregistered media type that some MessagePack clients still request.
+	mimeApplicationXMsgpack = "application/x-msgpack"
+	// mimeApplicationJavaScript is the media type of JSONP responses.
+	mimeApplicationJavaScript = "application/javascript; charset=utf-8"
+)
+
+var (
+	cborEncoder cbor.EncMode      = mustCBOREncoder()
+	formats     map[string]string = map[string]string{
+		"json":    fiber.MIMEApplicationJSON,
+		"msgpack": MIMEApplicationMsgpack,
+		"cbor":    MIMEApplicationCBOR,
+		"xml":     fiber.MIMEApplicationXML,
+	}
+	jsonpCallbackRegEx *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+	ErrInvalidFormat   error = errors.New("invalid response format")
+	ErrInvalidCallback error = errors.New("invalid JSONP callback")
+)
+
+// RawJSON is a JSON document that is embedded as is in JSON responses. The binary encodings would encode it as a byte
+// string, so they encode the value that it holds instead.
+type RawJSON json.RawMessage
+
+// MarshalJSON returns the JSON document.
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	return json.RawMessage(r).MarshalJSON()
+}
+
+// EncodeMsgpack encodes the value of the JSON document with MessagePack.
+func (r RawJSON) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	value, err := r.value()
+
+	if err != nil {
+		return err
+	}
+
+	return encoder.Encode(value)
+}
+
+// MarshalCBOR encodes the value of the JSON document with CBOR.
+func (r RawJSON) MarshalCBOR() ([]byte, error) {
+	value, err := r.value()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cborEncoder.Marshal(value)
+}
+
+// NegotiateMediaType returns the media type that the response is encoded with, chosen from the 'format' query
+// parameter or otherwise the Accept header of the request. JSON is used unless the client prefers another encoding.
+func NegotiateMediaType(ctx *fiber.Ctx) (string, error) {
+	if format := ctx.Query("format"); len(format) > 0 {
+		mediaType, ok := formats[strings.ToLower(format)]
+
+		if !ok {
+			return "", ErrInvalidFormat
+		}
+
+		return mediaType, nil
+	}
+
+	ctx.Vary(fiber.HeaderAccept)
+
+	offers := []string{fiber.MIMEApplicationJSON, MIMEApplicationMsgpack, mimeApplicationXMsgpack, MIMEApplicationCBOR}
+
+	// Browsers prefer XML over the wildcard when navigating, so XML is only offered to clients that do not accept HTML
+	if !strings.Contains(ctx.Get(fiber.HeaderAccept), fiber.MIMETextHTML) {
+		offers = append(offers, fiber.MIMEApplicationXML, fiber.MIMETextXML)
+	}
+
+	switch ctx.Accepts(offers...) {
+	case MIMEApplicationMsgpack, mimeApplicationXMsgpack:
+		return MIMEApplicationMsgpack, nil
+	case MIMEApplicationCBOR:
+		return MIMEApplicationCBOR, nil
+	case fiber.MIMEApplicationXML, fiber.MIMETextXML:
+		return fiber.MIMEApplicationXML, nil
+	default:
+		return fiber.MIMEApplicationJSON, nil
+	}
+}
+
+// ParseJSONPCallback returns the function name of the 'callback' query parameter, or an empty string if the response
+// is not JSONP. Only dotted JavaScript identifiers are accepted, so that the callback cannot inject any other script.
+func ParseJSONPCallback(ctx *fiber.Ctx) (string, error) {
+	callback := ctx.Query("callback")
+
+	if len(callback) < 1 || !config.AccessControl.AllowJSONP {
+		return "", nil
+	}
+
+	if len(callback) > 128 || !jsonpCallbackRegEx.MatchString(callback) {
+		return "", ErrInvalidCallback
+	}
+
+	return callback, nil
+}
+
+// WrapJSONP wraps the JSON document in a call to the callback. The leading comment prevents the response from being
+// interpreted as a Flash file.
+func WrapJSONP(data []byte, callback string) []byte {
+	result := make([]byte, 0, len(data)+len(callback)+8)
+	result = append(result, "/**/"...)
+	result = append(result, callback...)
+	result = append(result, '(')
+	result = append(result, data...)
+
+	return append(result, ");"...)
+}
+
+// EncodeResponse encodes the value with the media type. Structs are encoded directly in every format, using the names
+// and options of their JSON tags, and the encodings are deterministic so that equal values produce identical bytes.
+func EncodeResponse(v interface{}, mediaType string) ([]byte, error) {
+	switch mediaType {
+	case fiber.MIMEApplicationJSON:
+		return app.Config().JSONEncoder(v)
+	case MIMEApplicationMsgpack:
+		buf := &bytes.Buffer{}
+
+		encoder := msgpack.NewEncoder(buf)
+		encoder.SetCustomStructTag("json")
+		encoder.SetSortMapKeys(true)
+		encoder.UseCompactInts(true)
+
+		if err := encoder.Encode(v); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	case MIMEApplicationCBOR:
+		return cborEncoder.Marshal(v)
+	case fiber.MIMEApplicationXML:
+		data, err := json.Marshal(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return EncodeXML(data, "status")
+	default:
+		return nil, fmt.Errorf("unsupported media type: %s", mediaType)
+	}
+}
+
+// EncodeXML converts the JSON document to XML under a root element of the given name, keeping the order of its fields.
+// Every field becomes an element of the same name, the elements of arrays are named 'item', null values are empty
+// elements and fields whose names are not valid element names become 'entry' elements with a 'key' attribute.
+func EncodeXML(data []byte, root string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(buf)
+
+	if err := encodeXMLValue(encoder, decoder, root); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the JSON document")
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// encodeXMLValue reads the next JSON value from the decoder and writes it as an element of the given name.
+func encodeXMLValue(encoder *xml.Encoder, decoder *json.Decoder, name string) error {
+	token, err := decoder.Token()
+
+	if err != nil {
+		return err
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+
+	if !isXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "entry"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+
+	if err = encoder.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		for decoder.More() {
+			childName := "item"
+
+			if value == '{' {
+				key, err := decoder.Token()
+
+				if err != nil {
+					return err
+				}
+
+				childName = key.(string)
+			}
+
+			if err = encodeXMLValue(encoder, decoder, childName); err != nil {
+				return err
+			}
+		}
+
+		// Consume the closing delimiter of the object or array
+		if _, err = decoder.Token(); err != nil {
+			return err
+		}
+	case string:
+		err = encoder.EncodeToken(xml.CharData(value))
+	case json.Number:
+		err = encoder.EncodeToken(xml.CharData(value.String()))
+	case bool:
+		err = encoder.EncodeToken(xml.CharData(fmt.Sprint(value)))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return encoder.EncodeToken(start.End())
+}
+
+// isXMLName returns whether the value can be used as the name of an XML element without a namespace.
+func isXMLName(value string) bool {
+	if len(value) < 1 || strings.HasPrefix(strings.ToLower(value), "xml") {
+		return false
+	}
+
+	for i, c := range value {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case i > 0 && (c == '-' || c == '.' || c >= '0' && c <= '9'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustCBOREncoder() cbor.EncMode {
+	result, err := cbor.CoreDetEncOptions().EncMode()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return result
+}
+
+// value decodes the JSON document, keeping its integers as integers.
+func (r RawJSON) value() (interface{}, error) {
+	if len(r) < 1 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(r))
+	decoder.UseNumber()
+
+	var result interface{}
+
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return normalizeNumbers(result), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestEncodeResponseWithRawJSON(t *testing.T) {
+	response := &JavaStatusResponse{
+		Raw: RawJSON(`{"version":{"name":"1.21","protocol":767},"enforcesSecureChat":true}`),
+	}
+
+	expected := map[string]interface{}{
+		"version": map[string]interface{}{
+			"name":     "1.21",
+			"protocol": uint64(767),
+		},
+		"enforcesSecureChat": true,
+	}
+
+	decoders := map[string]func(data []byte, v interface{}) error{
+		MIMEApplicationMsgpack: msgpack.Unmarshal,
+		MIMEApplicationCBOR:    cbor.Unmarshal,
+	}
+
+	for mediaType, decode := range decoders {
+		data, err := EncodeResponse(response, mediaType)
+
+		if err != nil {
+			t.Fatalf("%s: %v", mediaType, err)
+		}
+
+		var result struct {
+			Raw interface{} `json:"raw" msgpack:"raw" cbor:"raw"`
+		}
+
+		if err = decode(data, &result); err != nil {
+			t.Fatalf("%s: %v", mediaType, err)
+		}
+
+		if !reflect.DeepEqual(normalizeTestNumbers(result.Raw), expected) {
+			t.Errorf("%s: raw status decoded as %#v, expected %#v", mediaType, result.Raw, expected)
+		}
+	}
+}
+
+// normalizeTestNumbers converts the decoded integers and maps to the types that the expected values are built with,
+// as each decoder picks its own.
+func normalizeTestNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case int8, int16, int32, int64, uint8, uint16, uint32:
+		return reflect.ValueOf(value).Convert(reflect.TypeOf(uint64(0))).Interface()
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{})
+
+		for key, element := range value {
+			result[key.(string)] = normalizeTestNumbers(element)
+		}
+
+		return result
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = normalizeTestNumbers(element)
+		}
+	}
+
+	return value
+}
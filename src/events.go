@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// EventBackendKafka publishes events to the topics of a Kafka cluster.
+	EventBackendKafka = "kafka"
+	// EventBackendNATS publishes events to the subjects of a NATS server.
+	EventBackendNATS = "nats"
+
+	// EventSerializationJSON encodes events as JSON objects.
+	EventSerializationJSON = "json"
+	// EventSerializationProtobuf encodes events as StatusEvent protobuf messages.
+	EventSerializationProtobuf = "protobuf"
+
+	// EventTypeRefresh is published every time a fresh status of a server is retrieved.
+	EventTypeRefresh = "refresh"
+	// EventTypeStateChange is published when a server goes online or offline.
+	EventTypeStateChange = "state_change"
+)
+
+var (
+	events *EventPublisher = &EventPublisher{}
+)
+
+// StatusEvent is a status refresh or state change published to the event broker. The protobuf serialization uses the
+// following schema, where the status is the JSON document returned by the status routes:
+//
+//	message StatusEvent {
+//	  string type = 1;
+//	  string edition = 2;
+//	  string hostname = 3;
+//	  uint32 port = 4;
+//	  bool online = 5;
+//	  optional bool previously_online = 6;
+//	  int64 time = 7;
+//	  bytes status = 8;
+//	}
+type StatusEvent struct {
+	Type             string          `json:"type"`
+	Edition          string          `json:"edition"`
+	Hostname         string          `json:"hostname"`
+	Port             uint16          `json:"port"`
+	Online           bool            `json:"online"`
+	PreviouslyOnline *bool           `json:"previously_online"`
+	Time             int64           `json:"time"`
+	Status           json.RawMessage `json:"status"`
+}
+
+// EventMessage is an encoded event along with the topic it is published to and the key that orders it.
+type EventMessage struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// EventBroker is a message broker that events can be published to.
+type EventBroker interface {
+	Publish(ctx context.Context, messages []EventMessage) error
+	Close() error
+}
+
+// EventPublisher queues status events and publishes them to the event broker in batches, so that lookups are never
+// slowed down by the broker.
+type EventPublisher struct {
+	Broker EventBroker
+	Queue  chan StatusEvent
+}
+
+// Connect connects to the configured event broker.
+func (p *EventPublisher) Connect() error {
+	if serialization := config.Events.Serialization; serialization != EventSerializationJSON && serialization != EventSerializationProtobuf {
+		return fmt.Errorf("invalid event serialization: %s", serialization)
+	}
+
+	if len(config.Events.Brokers) < 1 {
+		return fmt.Errorf("no event brokers are configured")
+	}
+
+	switch config.Events.Backend {
+	case EventBackendKafka:
+		p.Broker = &KafkaBroker{
+			Writer: &kafka.Writer{
+				Addr:                   kafka.TCP(config.Events.Brokers...),
+				Balancer:               &kafka.Hash{},
+				BatchSize:              int(config.Events.BatchSize),
+				BatchTimeout:           time.Millisecond * 10,
+				RequiredAcks:           kafka.RequireOne,
+				AllowAutoTopicCreation: true,
+			},
+		}
+	case EventBackendNATS:
+		conn, err := nats.Connect(strings.Join(config.Events.Brokers, ","), nats.Name("ping-server"))
+
+		if err != nil {
+			return err
+		}
+
+		p.Broker = &NATSBroker{
+			Conn: conn,
+		}
+	default:
+		return fmt.Errorf("invalid event backend: %s", config.Events.Backend)
+	}
+
+	p.Queue = make(chan StatusEvent, config.Events.QueueSize)
+
+	return nil
+}
+
+// Enqueue adds the event to the queue of events to publish, dropping it if the queue is full.
+func (p *EventPublisher) Enqueue(event StatusEvent) {
+	if p.Queue == nil {
+		return
+	}
+
+	select {
+	case p.Queue <- event:
+	default:
+		droppedEvents.WithLabelValues("queue_full").Inc()
+	}
+}
+
+// Run publishes the queued events until the context is done, then publishes the events still in the queue.
+func (p *EventPublisher) Run(ctx context.Context) {
+	batch := make([]StatusEvent, 0, config.Events.BatchSize)
+
+	for {
+		select {
+		case <-ctx.Done():
+			for batch = p.fill(batch[:0]); len(batch) > 0; batch = p.fill(batch[:0]) {
+				p.publish(context.Background(), batch)
+			}
+
+			return
+		case event := <-p.Queue:
+			p.publish(ctx, p.fill(append(batch[:0], event)))
+		}
+	}
+}
+
+// Close closes the connection to the event broker.
+func (p *EventPublisher) Close() error {
+	if p.Broker == nil {
+		return nil
+	}
+
+	return p.Broker.Close()
+}
+
+// fill adds the queued events to the batch without waiting, until it is full or the queue is empty.
+func (p *EventPublisher) fill(batch []StatusEvent) []StatusEvent {
+	for uint(len(batch)) < max(config.Events.BatchSize, 1) {
+		select {
+		case event := <-p.Queue:
+			batch = append(batch, event)
+		default:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+func (p *EventPublisher) publish(ctx context.Context, batch []StatusEvent) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+
+	defer cancel()
+
+	messages := make([]EventMessage, 0, len(batch))
+
+	for _, event := range batch {
+		value, err := EncodeStatusEvent(event, config.Events.Serialization)
+
+		if err != nil {
+			log.Printf("Failed to encode %s event of %s:%d: %v\n", event.Type, event.Hostname, event.Port, err)
+
+			droppedEvents.WithLabelValues("encoding_failed").Inc()
+
+			continue
+		}
+
+		topic := strings.NewReplacer("{edition}", event.Edition, "{type}", event.Type).Replace(config.Events.Topic)
+
+		messages = append(messages, EventMessage{
+			Topic: topic,
+			Key:   []byte(fmt.Sprintf("%s:%d", event.Hostname, event.Port)),
+			Value: value,
+		})
+	}
+
+	if err := p.Broker.Publish(ctx, messages); err != nil {
+		log.Printf("Failed to publish %d events: %v\n", len(messages), err)
+
+		droppedEvents.WithLabelValues("publish_failed").Add(float64(len(messages)))
+	}
+}
+
+// KafkaBroker publishes events to a Kafka cluster, keyed by server so that the events of a server stay in order.
+type KafkaBroker struct {
+	Writer *kafka.Writer
+}
+
+// Publish writes the messages to their topics.
+func (b *KafkaBroker) Publish(ctx context.Context, messages []EventMessage) error {
+	return b.Writer.WriteMessages(ctx, Map(messages, func(v EventMessage) kafka.Message {
+		return kafka.Message{
+			Topic: v.Topic,
+			Key:   v.Key,
+			Value: v.Value,
+		}
+	})...)
+}
+
+// Close flushes the pending messages and closes the connections to the brokers.
+func (b *KafkaBroker) Close() error {
+	return b.Writer.Close()
+}
+
+// NATSBroker publishes events to a NATS server.
+type NATSBroker struct {
+	Conn *nats.Conn
+}
+
+// Publish publishes the messages to their subjects and waits for the server to receive them.
+func (b *NATSBroker) Publish(ctx context.Context, messages []EventMessage) error {
+	for _, message := range messages {
+		if err := b.Conn.Publish(message.Topic, message.Value); err != nil {
+			return err
+		}
+	}
+
+	return b.Conn.FlushWithContext(ctx)
+}
+
+// Close publishes the pending messages and closes the connection.
+func (b *NATSBroker) Close() error {
+	return b.Conn.Drain()
+}
+
+// EncodeStatusEvent encodes the event with the given serialization.
+func EncodeStatusEvent(event StatusEvent, serialization string) ([]byte, error) {
+	if serialization == EventSerializationJSON {
+		return json.Marshal(event)
+	}
+
+	var result []byte
+
+	result = protowire.AppendTag(result, 1, protowire.BytesType)
+	result = protowire.AppendString(result, event.Type)
+	result = protowire.AppendTag(result, 2, protowire.BytesType)
+	result = protowire.AppendString(result, event.Edition)
+	result = protowire.AppendTag(result, 3, protowire.BytesType)
+	result = protowire.AppendString(result, event.Hostname)
+	result = protowire.AppendTag(result, 4, protowire.VarintType)
+	result = protowire.AppendVarint(result, uint64(event.Port))
+	result = protowire.AppendTag(result, 5, protowire.VarintType)
+	result = protowire.AppendVarint(result, protowire.EncodeBool(event.Online))
+
+	if event.PreviouslyOnline != nil {
+		result = protowire.AppendTag(result, 6, protowire.VarintType)
+		result = protowire.AppendVarint(result, protowire.EncodeBool(*event.PreviouslyOnline))
+	}
+
+	result = protowire.AppendTag(result, 7, protowire.VarintType)
+	result = protowire.AppendVarint(result, uint64(event.Time))
+	result = protowire.AppendTag(result, 8, protowire.BytesType)
+	result = protowire.AppendBytes(result, event.Status)
+
+	return result, nil
+}
+
+// PublishStatusEvents queues a refresh event for the freshly retrieved status, along with a state change event if the
+// server went online or offline since its previous refresh. The previous state is kept in Redis, so state changes are
+// only detected if it is configured.
+func PublishStatusEvents[T interface{ Base() *BaseStatus }](ctx context.Context, edition, hostname string, port uint16, status T) {
+	if events.Queue == nil {
+		return
+	}
+
+	data, err := json.Marshal(status)
+
+	if err != nil {
+		log.Printf("Failed to encode status event of %s:%d: %v\n", hostname, port, err)
+
+		return
+	}
+
+	event := StatusEvent{
+		Type:             EventTypeRefresh,
+		Edition:          edition,
+		Hostname:         hostname,
+		Port:             port,
+		Online:           status.Base().Online,
+		PreviouslyOnline: nil,
+		Time:             time.Now().UnixMilli(),
+		Status:           data,
+	}
+
+	stateKey := fmt.Sprintf("%s-state:%s", edition, GetCacheKey(hostname, port, nil))
+
+	previous, err := r.Swap(ctx, stateKey, strconv.FormatBool(event.Online), config.Events.StateExpiry)
+
+	if err != nil {
+		log.Printf("Failed to record the state of %s:%d: %v\n", hostname, port, err)
+	} else if previous != nil {
+		event.PreviouslyOnline = PointerOf(string(previous) == "true")
+	}
+
+	events.Enqueue(event)
+
+	if event.PreviouslyOnline != nil && *event.PreviouslyOnline != event.Online {
+		change := event
+		change.Type = EventTypeStateChange
+
+		events.Enqueue(change)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	// experimentResources are the resources that the cache durations of experiment variants can be set for.
+	experimentResources []string = []string{"java", "bedrock", "icon", "query"}
+)
+
+// ExperimentAssignment is the variant of an experiment that a server is assigned to.
+type ExperimentAssignment struct {
+	Experiment string
+	Variant    string
+	Config     ConfigExperimentVariant
+}
+
+// ValidateExperiments checks that every enabled experiment has a variant with a weight, and that the tunables of its
+// variants are valid.
+func ValidateExperiments() error {
+	for name, experiment := range config.Experiments {
+		if !experiment.Enable {
+			continue
+		}
+
+		var totalWeight uint = 0
+
+		for variantName, variant := range experiment.Variants {
+			totalWeight += variant.Weight
+
+			for resource, duration := range variant.CacheDurations {
+				if !Contains(experimentResources, resource) {
+					return fmt.Errorf("invalid cache resource of experiment %s variant %s: %s", name, variantName, resource)
+				}
+
+				if duration <= 0 {
+					return fmt.Errorf("invalid cache duration of experiment %s variant %s: %s", name, variantName, duration)
+				}
+			}
+		}
+
+		if totalWeight < 1 {
+			return fmt.Errorf("experiment %s has no variant with a weight", name)
+		}
+	}
+
+	return nil
+}
+
+// GetExperimentAssignments returns the variant of every enabled experiment that the server is assigned to, sorted by
+// experiment name. The assignment is derived from a hash of the experiment name and the server, so that a server is
+// always assigned to the same variant, and the variants of different experiments are independent of each other.
+func GetExperimentAssignments(hostname string, port uint16) []ExperimentAssignment {
+	result := make([]ExperimentAssignment, 0, len(config.Experiments))
+
+	for name, experiment := range config.Experiments {
+		if !experiment.Enable {
+			continue
+		}
+
+		variants := make([]string, 0, len(experiment.Variants))
+
+		var totalWeight uint = 0
+
+		for variant, variantConfig := range experiment.Variants {
+			variants = append(variants, variant)
+
+			totalWeight += variantConfig.Weight
+		}
+
+		if totalWeight < 1 {
+			continue
+		}
+
+		sort.Strings(variants)
+
+		hash := fnv.New32a()
+		hash.Write([]byte(name))
+		hash.Write([]byte{0})
+		hash.Write([]byte(hostname + ":" + strconv.FormatUint(uint64(port), 10)))
+
+		bucket := uint(hash.Sum32()) % totalWeight
+
+		for _, variant := range variants {
+			if weight := experiment.Variants[variant].Weight; bucket >= weight {
+				bucket -= weight
+
+				continue
+			}
+
+			result = append(result, ExperimentAssignment{
+				Experiment: name,
+				Variant:    variant,
+				Config:     experiment.Variants[variant],
+			})
+
+			break
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Experiment < result[j].Experiment
+	})
+
+	return result
+}
+
+// TargetCacheDuration returns the cache duration of the resource of the server. The cache durations of the tenant of
+// the request take precedence, followed by the first experiment that assigned the server to a variant with a cache
+// duration for the resource, and finally the global cache configuration.
+func (o *StatusOptions) TargetCacheDuration(resource, hostname string, port uint16) time.Duration {
+	if o.Tenant != nil && o.Tenant.Cache != nil {
+		return o.CacheDuration(resource)
+	}
+
+	for _, assignment := range GetExperimentAssignments(hostname, port) {
+		if duration, ok := assignment.Config.CacheDurations[resource]; ok {
+			return duration
+		}
+	}
+
+	return o.CacheDuration(resource)
+}
+
+// RecordExperimentLookup counts a lookup of the resource of the server for every experiment variant that the server is
+// assigned to, by whether it was served from cache.
+func RecordExperimentLookup(resource, hostname string, port uint16, cache CacheResult) {
+	if len(config.Experiments) < 1 {
+		return
+	}
+
+	result := "miss"
+
+	if cache.Hit {
+		result = "hit"
+	}
+
+	for _, assignment := range GetExperimentAssignments(hostname, port) {
+		experimentLookups.WithLabelValues(assignment.Experiment, assignment.Variant, resource, result).Inc()
+	}
+}
+
+// RecordExperimentProbe counts an upstream probe for the resource of the server for every experiment variant that the
+// server is assigned to.
+func RecordExperimentProbe(resource, hostname string, port uint16) {
+	if len(config.Experiments) < 1 {
+		return
+	}
+
+	for _, assignment := range GetExperimentAssignments(hostname, port) {
+		experimentProbes.WithLabelValues(assignment.Experiment, assignment.Variant, resource).Inc()
+	}
+}
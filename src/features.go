@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const featureOverridesKey = "feature-overrides"
+
+var (
+	features *FeatureFlags = &FeatureFlags{
+		Overrides: make(map[string]ConfigFeature),
+		Mutex:     &sync.RWMutex{},
+	}
+)
+
+// FeatureFlagState is the effective rollout of a feature flag as reported by the admin API.
+type FeatureFlagState struct {
+	Name string `json:"name"`
+	ConfigFeature
+	Overridden bool `json:"overridden"`
+}
+
+// FeatureFlags holds the in-memory copy of the feature flag overrides stored in Redis, which take precedence over the
+// rollouts in the configuration.
+type FeatureFlags struct {
+	Overrides map[string]ConfigFeature
+	Mutex     *sync.RWMutex
+}
+
+// Get returns the rollout of the feature flag, and false if the flag is neither configured nor overridden.
+func (f *FeatureFlags) Get(name string) (ConfigFeature, bool) {
+	f.Mutex.RLock()
+
+	defer f.Mutex.RUnlock()
+
+	if feature, ok := f.Overrides[name]; ok {
+		return feature, true
+	}
+
+	feature, ok := config.Features[name]
+
+	return feature, ok
+}
+
+// Replace swaps the overrides with the given ones.
+func (f *FeatureFlags) Replace(overrides map[string]ConfigFeature) {
+	f.Mutex.Lock()
+
+	defer f.Mutex.Unlock()
+
+	f.Overrides = overrides
+}
+
+// List returns the effective rollout of every configured or overridden feature flag, sorted by name.
+func (f *FeatureFlags) List() []FeatureFlagState {
+	f.Mutex.RLock()
+
+	defer f.Mutex.RUnlock()
+
+	result := make([]FeatureFlagState, 0, len(config.Features)+len(f.Overrides))
+
+	for name, feature := range f.Overrides {
+		result = append(result, FeatureFlagState{
+			Name:          name,
+			ConfigFeature: feature,
+			Overridden:    true,
+		})
+	}
+
+	for name, feature := range config.Features {
+		if _, ok := f.Overrides[name]; ok {
+			continue
+		}
+
+		result = append(result, FeatureFlagState{
+			Name:          name,
+			ConfigFeature: feature,
+			Overridden:    false,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// IsFeatureEnabled checks whether the feature flag applies to the request, either because the request was made with
+// one of the API keys of the flag, or because it falls within the rolled out percentage of requests. The percentage is
+// based on the request ID, so that every check of the same flag within a request has the same result.
+func IsFeatureEnabled(ctx *fiber.Ctx, name string) bool {
+	feature, ok := features.Get(name)
+
+	if !ok {
+		return false
+	}
+
+	if apiKey := ctx.Get("X-API-Key"); len(apiKey) > 0 && Contains(feature.APIKeys, apiKey) {
+		return true
+	}
+
+	if feature.Percentage <= 0 {
+		return false
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	hash.Write([]byte(ctx.GetRespHeader(fiber.HeaderXRequestID)))
+
+	return float64(hash.Sum32()%10000) < feature.Percentage*100
+}
+
+// RefreshFeatureFlags reloads the feature flag overrides from Redis.
+func RefreshFeatureFlags(ctx context.Context) error {
+	values, err := r.HashGetAll(ctx, featureOverridesKey)
+
+	if err != nil {
+		return err
+	}
+
+	overrides := make(map[string]ConfigFeature)
+
+	for name, value := range values {
+		var feature ConfigFeature
+
+		if err = json.Unmarshal([]byte(value), &feature); err != nil {
+			return err
+		}
+
+		overrides[name] = feature
+	}
+
+	features.Replace(overrides)
+
+	return nil
+}
+
+// SyncFeatureFlags periodically reloads the feature flag overrides so that changes made through other instances are
+// seen, until the context is done.
+func SyncFeatureFlags(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := RefreshFeatureFlags(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to refresh feature flags: %v\n", err)
+		}
+	}
+}
+
+// ListFeatureFlagsHandler returns the effective rollout of every feature flag.
+func ListFeatureFlagsHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(features.List())
+}
+
+// SetFeatureFlagHandler overrides the rollout of the feature flag in the parameters for every instance.
+func SetFeatureFlagHandler(ctx *fiber.Ctx) error {
+	var body ConfigFeature
+
+	if err := ctx.BodyParser(&body); err != nil || body.Percentage < 0 || body.Percentage > 100 {
+		return ctx.Status(http.StatusBadRequest).SendString("Request body must be a JSON object with a 'percentage' between 0 and 100")
+	}
+
+	if body.APIKeys == nil {
+		body.APIKeys = make([]string, 0)
+	}
+
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		return err
+	}
+
+	if err = r.HashSet(ctx.UserContext(), featureOverridesKey, ctx.Params("name"), data); err != nil {
+		return err
+	}
+
+	if err = RefreshFeatureFlags(ctx.UserContext()); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// DeleteFeatureFlagHandler removes the override of the feature flag in the parameters, reverting it to the rollout in
+// the configuration.
+func DeleteFeatureFlagHandler(ctx *fiber.Ctx) error {
+	removed, err := r.HashDelete(ctx.UserContext(), featureOverridesKey, ctx.Params("name"))
+
+	if err != nil {
+		return err
+	}
+
+	if removed < 1 {
+		return ctx.Status(http.StatusNotFound).SendString("Feature flag is not overridden")
+	}
+
+	if err = RefreshFeatureFlags(ctx.UserContext()); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const maxFields = 64
+
+var (
+	ErrInvalidFields error = errors.New("invalid field paths")
+)
+
+// ParseFields parses the comma-separated list of dot-separated field paths of the 'fields' query parameter. Nil is
+// returned if the list is empty, which selects every field.
+func ParseFields(value string) ([][]string, error) {
+	if len(value) < 1 {
+		return nil, nil
+	}
+
+	values := strings.Split(value, ",")
+
+	if len(values) > maxFields {
+		return nil, ErrInvalidFields
+	}
+
+	result := make([][]string, 0, len(values))
+
+	for _, field := range values {
+		path := strings.Split(strings.TrimSpace(field), ".")
+
+		for _, key := range path {
+			if len(key) < 1 {
+				return nil, ErrInvalidFields
+			}
+		}
+
+		result = append(result, path)
+	}
+
+	return result, nil
+}
+
+// SelectFields returns the value with only the selected fields of its JSON document, or the value itself if no field
+// is selected. Fields that select into an array apply to each of its objects, and fields that do not exist are ignored.
+func SelectFields(v interface{}, fields [][]string) (interface{}, error) {
+	if len(fields) < 1 {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document map[string]interface{}
+
+	if err = decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+
+	if document == nil {
+		return nil, errors.New("fields can only be selected from a JSON object")
+	}
+
+	result := make(map[string]interface{})
+
+	for _, path := range fields {
+		selectField(result, document, path)
+	}
+
+	return normalizeNumbers(result), nil
+}
+
+// selectField copies the value at the path from the source object to the destination object, creating the objects
+// and arrays on the way to it.
+func selectField(dst, src map[string]interface{}, path []string) {
+	value, ok := src[path[0]]
+
+	if !ok {
+		return
+	}
+
+	if len(path) == 1 {
+		dst[path[0]] = value
+
+		return
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		child, ok := dst[path[0]].(map[string]interface{})
+
+		if !ok {
+			child = make(map[string]interface{})
+
+			dst[path[0]] = child
+		}
+
+		selectField(child, value, path[1:])
+	case []interface{}:
+		children, ok := dst[path[0]].([]interface{})
+
+		if !ok {
+			children = make([]interface{}, len(value))
+
+			for i := range children {
+				children[i] = make(map[string]interface{})
+			}
+
+			dst[path[0]] = children
+		}
+
+		for i, element := range value {
+			element, ok := element.(map[string]interface{})
+
+			if !ok {
+				continue
+			}
+
+			if child, ok := children[i].(map[string]interface{}); ok {
+				selectField(child, element, path[1:])
+			}
+		}
+	}
+}
+
+// normalizeNumbers replaces the numbers decoded from JSON with integers where possible and floats otherwise, as the
+// binary encodings would otherwise encode them as strings.
+func normalizeNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if result, err := value.Int64(); err == nil {
+			return result
+		}
+
+		result, _ := value.Float64()
+
+		return result
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = normalizeNumbers(element)
+		}
+	case []interface{}:
+		for i, element := range value {
+			value[i] = normalizeNumbers(element)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mcstatus-io/mcutil/v4/response"
+)
+
+var (
+	fixtureNameRegEx *regexp.Regexp = regexp.MustCompile(`^[a-z0-9-_]{1,64}$`)
+
+	ErrInvalidFixtureName error = errors.New("fixture names may only contain lowercase letters, digits, '-' and '_'")
+)
+
+// Fixture is a recorded set of raw responses of a server that can be replayed through the parsers and response
+// builders. Java Edition fixtures hold the bytes read from the status connection, and Bedrock Edition fixtures hold
+// every datagram received in response to the unconnected ping.
+type Fixture struct {
+	Name           string    `json:"name"`
+	Edition        string    `json:"edition"`
+	Host           string    `json:"host"`
+	Port           uint16    `json:"port"`
+	RecordedAt     time.Time `json:"recorded_at"`
+	JavaResponse   []byte    `json:"java_response,omitempty"`
+	BedrockPackets [][]byte  `json:"bedrock_packets,omitempty"`
+}
+
+// RecordFixture pings the server and writes the raw responses to the fixtures directory. Responses that fail to parse
+// are recorded as well, as reproducing those is the purpose of fixtures.
+func RecordFixture(ctx context.Context, name, edition, hostname string, port uint16, opts *StatusOptions) (*Fixture, error) {
+	if !fixtureNameRegEx.MatchString(name) {
+		return nil, ErrInvalidFixtureName
+	}
+
+	fixture := &Fixture{
+		Name:       name,
+		Edition:    edition,
+		Host:       hostname,
+		Port:       port,
+		RecordedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+
+	defer cancel()
+
+	var (
+		network string
+		address string
+	)
+
+	switch edition {
+	case "java":
+		network, address = "tcp", LookupJavaAddress(ctx, hostname, port)
+	case "bedrock":
+		network, address = "udp", net.JoinHostPort(hostname, strconv.Itoa(int(port)))
+	default:
+		return nil, fmt.Errorf("unknown edition: %s", edition)
+	}
+
+	dialed, err := NewTargetDialer().DialContext(ctx, network, address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &recordingConn{Conn: dialed}
+
+	defer conn.Close()
+
+	if edition == "java" {
+		_, _, err = pingJavaConn(ctx, conn, hostname, port)
+
+		fixture.JavaResponse = bytes.Join(conn.Reads, nil)
+	} else {
+		_, err = pingBedrockConn(ctx, conn)
+
+		fixture.BedrockPackets = conn.Reads
+	}
+
+	if len(conn.Reads) < 1 {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(fixture, "", "\t")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(config.Fixtures.Directory, 0755); err != nil {
+		return nil, err
+	}
+
+	return fixture, os.WriteFile(filepath.Join(config.Fixtures.Directory, name+".json"), data, 0644)
+}
+
+// LoadFixture reads a previously recorded fixture from the fixtures directory.
+func LoadFixture(name string) (*Fixture, error) {
+	if !fixtureNameRegEx.MatchString(name) {
+		return nil, ErrInvalidFixtureName
+	}
+
+	data, err := os.ReadFile(filepath.Join(config.Fixtures.Directory, name+".json"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+
+	if err = json.Unmarshal(data, &fixture); err != nil {
+		return nil, err
+	}
+
+	return &fixture, nil
+}
+
+// Replay parses the recorded responses and builds the status response exactly as it would have been built from them.
+func (f *Fixture) Replay() (interface{}, error) {
+	switch f.Edition {
+	case "java":
+		packet, err := ReadJavaPacket(bytes.NewReader(f.JavaResponse))
+
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := ParseJavaStatusPacket(packet)
+
+		if err != nil {
+			return nil, err
+		}
+
+		status, err := ParseJavaStatus(raw)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return BuildJavaResponse(f.Host, f.Port, status, nil, nil, nil, nil)
+	case "bedrock":
+		err := fmt.Errorf("fixture '%s' does not contain any packets", f.Name)
+
+		// Stray packets are skipped as they are during a ping, so the first valid pong is used
+		for _, packet := range f.BedrockPackets {
+			var status *response.StatusBedrock
+
+			if status, err = ParseUnconnectedPong(packet); err == nil {
+				return BuildBedrockResponse(f.Host, f.Port, status, nil)
+			}
+		}
+
+		return nil, err
+	default:
+		return nil, fmt.Errorf("unknown edition: %s", f.Edition)
+	}
+}
+
+// recordingConn is a connection that keeps a copy of the data returned by every read.
+type recordingConn struct {
+	net.Conn
+	Reads [][]byte
+}
+
+// Read reads data from the connection and records it.
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+
+	if n > 0 {
+		c.Reads = append(c.Reads, bytes.Clone(b[:n]))
+	}
+
+	return n, err
+}
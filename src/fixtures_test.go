@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useFixturesDirectory records the fixtures of the test in a temporary directory, and replays them with an empty
+// blocked servers list in place of the one fetched at startup.
+func useFixturesDirectory(tb testing.TB) {
+	previousDirectory, previousBlockedServers := config.Fixtures.Directory, blockedServers
+
+	config.Fixtures.Directory = tb.TempDir()
+	blockedServers = &MutexArray[string]{
+		List:  []string{},
+		Mutex: &sync.Mutex{},
+	}
+
+	tb.Cleanup(func() {
+		config.Fixtures.Directory, blockedServers = previousDirectory, previousBlockedServers
+	})
+}
+
+// recordAndReplay records the fixture of the server and replays it from the fixtures directory.
+func recordAndReplay(t *testing.T, name, edition string, port uint16) (interface{}, error) {
+	if _, err := RecordFixture(context.Background(), name, edition, "127.0.0.1", port, &StatusOptions{Timeout: time.Second}); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	fixture, err := LoadFixture(name)
+
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	return fixture.Replay()
+}
+
+func TestReplayJavaFixture(t *testing.T) {
+	allowLoopbackTargets(t)
+	useFixturesDirectory(t)
+
+	responses := make(chan []byte, 2)
+
+	responses <- newJavaStatusPacket(t, `{"version":{"name":"1.21","protocol":767},"players":{"max":20,"online":1},"description":"A Minecraft Server"}`)
+	responses <- newJavaStatusPacket(t, `{"version":{"name":"1.21","protocol":767},"players":`)
+
+	port := serveTCP(t, readJavaStatusRequest, responses)
+
+	result, err := recordAndReplay(t, "java", "java", port)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := result.(*JavaStatusResponse); !status.Online || status.Version.Protocol != 767 || status.MOTD.Clean != "A Minecraft Server" {
+		t.Errorf("unexpected replayed status: %+v", status)
+	}
+
+	// A status that fails to parse is recorded, and fails the same way when replayed
+	if _, err = recordAndReplay(t, "java-malformed", "java", port); err == nil {
+		t.Error("expected the malformed status to fail to parse")
+	}
+}
+
+func TestReplayBedrockFixture(t *testing.T) {
+	allowLoopbackTargets(t)
+	useFixturesDirectory(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1500)
+
+		for {
+			_, address, err := conn.ReadFrom(buf)
+
+			if err != nil {
+				return
+			}
+
+			// A stray packet comes before the pong, as a late answer to an earlier ping would
+			conn.WriteTo([]byte{0x1C, 0x00}, address)
+			conn.WriteTo(newUnconnectedPong("MCPE;Bedrock;712;1.21.2;3;10;123456;Second line;Survival;1;19132;19133;"), address)
+		}
+	}()
+
+	result, err := recordAndReplay(t, "bedrock", "bedrock", uint16(conn.LocalAddr().(*net.UDPAddr).Port))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := result.(*BedrockStatusResponse); !status.Online || *status.Players.Online != 3 || *status.Edition != "MCPE" {
+		t.Errorf("unexpected replayed status: %+v", status)
+	}
+}
+
+func TestRecordFixtureHandlerWithUnknownEdition(t *testing.T) {
+	app := fiber.New()
+
+	app.Post("/fixtures/:edition/:address", RecordFixtureHandler)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/fixtures/console/example.com?name=test", nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mcstatus-io/mcutil/v4/formatting/colors"
+)
+
+var (
+	colorPalette  *strings.Replacer = nil
+	hexColorRegEx *regexp.Regexp    = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// LoadColorPalette prepares the hex colors that replace the vanilla colors of the given color codes in HTML output.
+// The palette is keyed by either the color code, such as 'a', or the color name, such as 'green'.
+func LoadColorPalette(palette map[string]string) error {
+	if len(palette) < 1 {
+		colorPalette = nil
+
+		return nil
+	}
+
+	replacements := make([]string, 0, len(palette)*2)
+
+	for key, value := range palette {
+		color, ok := colors.Parse(strings.ToLower(key))
+
+		if !ok {
+			return fmt.Errorf("unknown color code or name in palette: %s", key)
+		}
+
+		if !hexColorRegEx.MatchString(value) {
+			return fmt.Errorf("invalid hex color for '%s' in palette, expected a value like #55ff55: %s", key, value)
+		}
+
+		replacements = append(replacements, fmt.Sprintf("color: %s;", color.ToHex()), fmt.Sprintf("color: %s;", strings.ToLower(value)))
+	}
+
+	colorPalette = strings.NewReplacer(replacements...)
+
+	return nil
+}
+
+// ApplyColorPalette replaces the vanilla colors in HTML formatted text with the colors of the configured palette.
+func ApplyColorPalette(html string) string {
+	if colorPalette == nil {
+		return html
+	}
+
+	return colorPalette.Replace(html)
+}
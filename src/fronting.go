@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	// frontingFingerprints maps substrings of certificate issuer and subject organizations to the technology that is
+	// known to present them when answering TLS on a Minecraft port.
+	frontingFingerprints map[string]string = map[string]string{
+		"cloudflare": "cloudflare",
+		"tcpshield":  "tcpshield",
+		"neoprotect": "neoprotect",
+	}
+)
+
+// Fronting is the result of probing a Minecraft port for a TLS terminating proxy in front of the server.
+type Fronting struct {
+	TLS          bool    `json:"tls"`
+	Technology   *string `json:"technology"`
+	Issuer       *string `json:"issuer"`
+	Subject      *string `json:"subject"`
+	Protocol     *string `json:"protocol"`
+	TLSVersion   string  `json:"tls_version"`
+	HandshakeRTT int64   `json:"handshake_rtt"`
+}
+
+// DetectFronting sends a TLS client hello to the host and reports on anything that answers it. Minecraft servers
+// never speak TLS themselves, so any completed handshake means a proxy is fronting the server.
+func DetectFronting(ctx context.Context, hostname, connectHostname string, port uint16) *Fronting {
+	if !config.Lookup.FrontingDetection {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Lookup.FrontingTimeout)
+
+	defer cancel()
+
+	dialer := &tls.Dialer{
+		NetDialer: NewTargetDialer(),
+		Config: &tls.Config{
+			ServerName:         hostname,
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2", "http/1.1"},
+		},
+	}
+
+	start := time.Now()
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(connectHostname, fmt.Sprint(port)))
+
+	if err != nil {
+		return nil
+	}
+
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+
+	result := &Fronting{
+		TLS:          true,
+		TLSVersion:   tls.VersionName(state.Version),
+		HandshakeRTT: time.Since(start).Milliseconds(),
+	}
+
+	if len(state.NegotiatedProtocol) > 0 {
+		result.Protocol = PointerOf(state.NegotiatedProtocol)
+	}
+
+	if len(state.PeerCertificates) > 0 {
+		certificate := state.PeerCertificates[0]
+
+		result.Issuer = PointerOf(certificate.Issuer.String())
+		result.Subject = PointerOf(certificate.Subject.String())
+
+		organizations := strings.ToLower(strings.Join(append(certificate.Issuer.Organization, certificate.Subject.Organization...), " "))
+
+		for fingerprint, technology := range frontingFingerprints {
+			if strings.Contains(organizations, fingerprint) {
+				result.Technology = PointerOf(technology)
+
+				break
+			}
+		}
+	}
+
+	return result
+}
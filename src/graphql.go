@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/src/assets"
+	"math"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/graphql-go/graphql"
+)
+
+var (
+	graphQLSchema graphql.Schema = mustGraphQLSchema()
+)
+
+type graphQLContextKey struct{}
+
+// GraphQLRequest is the state shared by the resolvers of a single GraphQL request.
+type GraphQLRequest struct {
+	Options *StatusOptions
+	Lookups *atomic.Int32
+	APIKey  *APIKey
+	IP      string
+}
+
+// GraphQLRequestBody is the body accepted by the GraphQL route.
+type GraphQLRequestBody struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphQLLookup retrieves a value of the server for a resolver, once the address has been checked.
+type graphQLLookup func(ctx context.Context, opts *StatusOptions, hostname string, port uint16, portSource string) (interface{}, error)
+
+// GraphQLHandler executes a GraphQL query of the status of any number of servers, up to the configured limit. Every
+// server is looked up concurrently.
+func GraphQLHandler(ctx *fiber.Ctx) error {
+	var body GraphQLRequestBody
+
+	if ctx.Method() == fiber.MethodGet {
+		body.Query = ctx.Query("query")
+		body.OperationName = ctx.Query("operationName")
+
+		if variables := ctx.Query("variables"); len(variables) > 0 {
+			if err := json.Unmarshal([]byte(variables), &body.Variables); err != nil {
+				return ctx.Status(http.StatusBadRequest).SendString("Invalid 'variables' query parameter, must be a JSON object")
+			}
+		}
+	} else if err := ctx.BodyParser(&body); err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Request body must be a JSON object with a 'query'")
+	}
+
+	if len(body.Query) < 1 {
+		return ctx.Status(http.StatusBadRequest).SendString("Missing GraphQL 'query'")
+	}
+
+	opts, err := GetStatusOptions(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	authorized, err := Authenticate(ctx)
+
+	if err != nil || !authorized {
+		return err
+	}
+
+	apiKey, _ := ctx.Locals("api-key").(*APIKey)
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphQLSchema,
+		RequestString:  body.Query,
+		VariableValues: body.Variables,
+		OperationName:  body.OperationName,
+		Context: context.WithValue(ctx.UserContext(), graphQLContextKey{}, &GraphQLRequest{
+			Options: opts,
+			Lookups: &atomic.Int32{},
+			APIKey:  apiKey,
+			IP:      ctx.IP(),
+		}),
+	})
+
+	return ctx.JSON(result)
+}
+
+// resolveGraphQLLookup checks the address argument of the field the same way as the status routes and looks the server
+// up in the background, returning a thunk that lets the executor resolve every field of the query concurrently. The
+// optedOut value is resolved for servers whose owner opted out of public lookups, which are an error if it is nil.
+func resolveGraphQLLookup(p graphql.ResolveParams, edition string, lookup graphQLLookup, optedOut interface{}) (interface{}, error) {
+	request := p.Context.Value(graphQLContextKey{}).(*GraphQLRequest)
+
+	lookups := request.Lookups.Add(1)
+
+	if lookups > int32(config.GraphQL.MaxLookups) {
+		return nil, fmt.Errorf("a request may only look up %d servers", config.GraphQL.MaxLookups)
+	}
+
+	// The request itself was counted as the first lookup, every other one counts as a request of its own
+	if lookups > 1 {
+		if err := chargeGraphQLLookup(p.Context, request); err != nil {
+			return nil, err
+		}
+	}
+
+	opts := *request.Options
+
+	if query, ok := p.Args["query"].(bool); ok {
+		opts.Query = query
+	}
+
+	if timeout, ok := p.Args["timeout"].(float64); ok {
+		opts.Timeout = time.Duration(math.Max(float64(time.Second)*timeout, float64(time.Millisecond*500)))
+	}
+
+	address, _ := p.Args["address"].(string)
+
+	type result struct {
+		Value interface{}
+		Err   error
+	}
+
+	results := make(chan result, 1)
+
+	go func() {
+		value, err := func() (interface{}, error) {
+			hostname, port, portSource, err := ParseTargetAddress(strings.ToLower(address), edition)
+
+			if err != nil {
+				return nil, errors.New("invalid address value")
+			}
+
+			err = CheckTarget(p.Context, &opts, edition, hostname, port, edition == "java")
+
+			if errors.Is(err, ErrTargetOptedOut) && optedOut != nil {
+				return optedOut, nil
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			return lookup(p.Context, &opts, hostname, port, portSource)
+		}()
+
+		results <- result{value, err}
+	}()
+
+	return func() (interface{}, error) {
+		result := <-results
+
+		return result.Value, result.Err
+	}, nil
+}
+
+// lookupGraphQLStatus returns the status of the server as a generic document with the same fields as the JSON
+// response of the status routes.
+func lookupGraphQLStatus(edition string) graphQLLookup {
+	return func(ctx context.Context, opts *StatusOptions, hostname string, port uint16, portSource string) (interface{}, error) {
+		err := CountTargetLookup(ctx, opts, edition, hostname, port)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var response interface{ Base() *BaseStatus }
+
+		switch edition {
+		case "java":
+			javaResponse, cache, err := GetJavaStatus(ctx, hostname, port, opts)
+
+			if err != nil {
+				return nil, err
+			}
+
+			javaResponse.SetPortSource(portSource)
+			javaResponse.SetCacheResult(cache)
+
+			response = javaResponse
+		case "bedrock":
+			bedrockResponse, cache, err := GetBedrockStatus(ctx, hostname, port, opts)
+
+			if err != nil {
+				return nil, err
+			}
+
+			bedrockResponse.PortSource = portSource
+			bedrockResponse.SetCacheResult(cache)
+
+			response = bedrockResponse
+		}
+
+		base := response.Base()
+
+		if base.Meta, err = GetServerMeta(ctx, edition, hostname, port); err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(response)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var result map[string]interface{}
+
+		return result, json.Unmarshal(data, &result)
+	}
+}
+
+// lookupGraphQLIcon returns the icon of the Java Edition server as a data URI, with the same overrides as the icon
+// route.
+func lookupGraphQLIcon(ctx context.Context, opts *StatusOptions, hostname string, port uint16, portSource string) (interface{}, error) {
+	icon, err := func() ([]byte, error) {
+		override, err := GetIconOverride(ctx, hostname, port)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if override != nil && override.Mode == "replace" {
+			return override.Data, nil
+		}
+
+		opts.Trigger = "icon"
+
+		icon, _, err := GetServerIcon(ctx, hostname, port, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if override != nil && bytes.Equal(icon, assets.DefaultIcon) {
+			return override.Data, nil
+		}
+
+		return icon, nil
+	}()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return getGraphQLIconURI(icon), nil
+}
+
+// getGraphQLIconURI returns the icon as a data URI.
+func getGraphQLIconURI(icon []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(icon)
+}
+
+// resolveGraphQLBlocked returns whether the host is blocked by Mojang's list or the local blocklist.
+func resolveGraphQLBlocked(p graphql.ResolveParams) (interface{}, error) {
+	value, _ := p.Args["host"].(string)
+
+	host, _, err := ParseAddress(value, 0)
+
+	if err != nil {
+		return nil, errors.New("invalid host value")
+	}
+
+	match := MatchBlockedAddress(host)
+
+	return BlocklistExplanation{
+		Host:    strings.ToLower(host),
+		Blocked: match != nil,
+		Match:   match,
+	}, nil
+}
+
+func mustGraphQLSchema() graphql.Schema {
+	motdType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "MOTD",
+		Fields: graphql.Fields{
+			"raw":        &graphql.Field{Type: graphql.String},
+			"clean":      &graphql.Field{Type: graphql.String},
+			"html":       &graphql.Field{Type: graphql.String},
+			"translated": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	metaType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ServerMeta",
+		Fields: graphql.Fields{
+			"website":     &graphql.Field{Type: graphql.String},
+			"discord":     &graphql.Field{Type: graphql.String},
+			"description": &graphql.Field{Type: graphql.String},
+			"tags":        &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"updated_at":  &graphql.Field{Type: graphql.Float},
+		},
+	})
+
+	// Timestamps in milliseconds do not fit the 32-bit GraphQL Int, so they are exposed as Float
+	baseFields := func(extra graphql.Fields) graphql.Fields {
+		result := graphql.Fields{
+			"online":       &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"host":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"port":         &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"port_source":  &graphql.Field{Type: graphql.String},
+			"ip_address":   &graphql.Field{Type: graphql.String},
+			"reverse_dns":  &graphql.Field{Type: graphql.String},
+			"eula_blocked": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"confidence":   &graphql.Field{Type: graphql.Float},
+			"retrieved_at": &graphql.Field{Type: graphql.Float},
+			"expires_at":   &graphql.Field{Type: graphql.Float},
+			"cache_hit":    &graphql.Field{Type: graphql.Boolean},
+			"meta":         &graphql.Field{Type: metaType},
+			"motd":         &graphql.Field{Type: motdType},
+		}
+
+		for name, field := range extra {
+			result[name] = field
+		}
+
+		return result
+	}
+
+	javaStatusType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "JavaStatus",
+		Fields: baseFields(graphql.Fields{
+			"srv_record": &graphql.Field{Type: graphql.NewObject(graphql.ObjectConfig{
+				Name: "SRVRecord",
+				Fields: graphql.Fields{
+					"host": &graphql.Field{Type: graphql.String},
+					"port": &graphql.Field{Type: graphql.Int},
+					"ttl":  &graphql.Field{Type: graphql.Int},
+				},
+			})},
+			"version": &graphql.Field{Type: graphql.NewObject(graphql.ObjectConfig{
+				Name: "JavaVersion",
+				Fields: graphql.Fields{
+					"name_raw":   &graphql.Field{Type: graphql.String},
+					"name_clean": &graphql.Field{Type: graphql.String},
+					"name_html":  &graphql.Field{Type: graphql.String},
+					"protocol":   &graphql.Field{Type: graphql.Int},
+				},
+			})},
+			"players": &graphql.Field{Type: graphql.NewObject(graphql.ObjectConfig{
+				Name: "JavaPlayers",
+				Fields: graphql.Fields{
+					"online": &graphql.Field{Type: graphql.Int},
+					"max":    &graphql.Field{Type: graphql.Int},
+					"list": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+						Name: "Player",
+						Fields: graphql.Fields{
+							"uuid":       &graphql.Field{Type: graphql.String},
+							"name_raw":   &graphql.Field{Type: graphql.String},
+							"name_clean": &graphql.Field{Type: graphql.String},
+							"name_html":  &graphql.Field{Type: graphql.String},
+						},
+					}))},
+					"list_hidden": &graphql.Field{Type: graphql.Boolean},
+				},
+			})},
+			"icon": &graphql.Field{Type: graphql.String},
+			"mods": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+				Name: "Mod",
+				Fields: graphql.Fields{
+					"name":    &graphql.Field{Type: graphql.String},
+					"version": &graphql.Field{Type: graphql.String},
+				},
+			}))},
+			"software": &graphql.Field{Type: graphql.String},
+			"plugins": &graphql.Field{Type: graphql.NewList(graphql.NewObject(graphql.ObjectConfig{
+				Name: "Plugin",
+				Fields: graphql.Fields{
+					"name":    &graphql.Field{Type: graphql.String},
+					"version": &graphql.Field{Type: graphql.String},
+				},
+			}))},
+		}),
+	})
+
+	bedrockStatusType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BedrockStatus",
+		Fields: baseFields(graphql.Fields{
+			"version": &graphql.Field{Type: graphql.NewObject(graphql.ObjectConfig{
+				Name: "BedrockVersion",
+				Fields: graphql.Fields{
+					"name":     &graphql.Field{Type: graphql.String},
+					"protocol": &graphql.Field{Type: graphql.Int},
+				},
+			})},
+			"players": &graphql.Field{Type: graphql.NewObject(graphql.ObjectConfig{
+				Name: "BedrockPlayers",
+				Fields: graphql.Fields{
+					"online": &graphql.Field{Type: graphql.Int},
+					"max":    &graphql.Field{Type: graphql.Int},
+				},
+			})},
+			"gamemode":       &graphql.Field{Type: graphql.String},
+			"server_id":      &graphql.Field{Type: graphql.String},
+			"edition":        &graphql.Field{Type: graphql.String},
+			"fields_missing": &graphql.Field{Type: graphql.NewList(graphql.String)},
+		}),
+	})
+
+	blockedType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "BlocklistExplanation",
+		Fields: graphql.Fields{
+			"host":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"blocked": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"match": &graphql.Field{Type: graphql.NewObject(graphql.ObjectConfig{
+				Name: "BlocklistMatch",
+				Fields: graphql.Fields{
+					"source":  &graphql.Field{Type: graphql.String},
+					"pattern": &graphql.Field{Type: graphql.String},
+					"type":    &graphql.Field{Type: graphql.String},
+				},
+			})},
+		},
+	})
+
+	address := &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}
+	timeout := &graphql.ArgumentConfig{Type: graphql.Float, Description: "Timeout of the lookup in seconds"}
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"java": &graphql.Field{
+					Type:        javaStatusType,
+					Description: "Status of a Java Edition server",
+					Args: graphql.FieldConfigArgument{
+						"address": address,
+						"query":   &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Whether to also use the query protocol"},
+						"timeout": timeout,
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return resolveGraphQLLookup(p, "java", lookupGraphQLStatus("java"), nil)
+					},
+				},
+				"bedrock": &graphql.Field{
+					Type:        bedrockStatusType,
+					Description: "Status of a Bedrock Edition server",
+					Args: graphql.FieldConfigArgument{
+						"address": address,
+						"timeout": timeout,
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return resolveGraphQLLookup(p, "bedrock", lookupGraphQLStatus("bedrock"), nil)
+					},
+				},
+				"icon": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Icon of a Java Edition server as a PNG data URI",
+					Args: graphql.FieldConfigArgument{
+						"address": address,
+						"timeout": timeout,
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return resolveGraphQLLookup(p, "java", lookupGraphQLIcon, getGraphQLIconURI(assets.DefaultIcon))
+					},
+				},
+				"blocked": &graphql.Field{
+					Type:        blockedType,
+					Description: "Whether a host is blocked by Mojang or by this instance",
+					Args: graphql.FieldConfigArgument{
+						"host": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					},
+					Resolve: resolveGraphQLBlocked,
+				},
+			},
+		}),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return schema
+}
+
+// chargeGraphQLLookup counts a lookup of the request against the rate limit of its client IP address and the limits of
+// its API key.
+func chargeGraphQLLookup(ctx context.Context, request *GraphQLRequest) error {
+	tenant := request.Options.Tenant
+
+	// Tenants with a rate limit of their own are limited even when rate limiting is disabled, as CheckAPIKey does
+	if config.RateLimit.Enable || (config.APIKeys.Enable && tenant != nil && tenant.RateLimit != nil) {
+		taken, _, err := TakeRequestToken(ctx, request.IP, tenant)
+
+		if err != nil {
+			return err
+		}
+
+		if !taken {
+			return ErrRateLimitExceeded
+		}
+	}
+
+	if config.APIKeys.Enable && request.APIKey != nil {
+		return ChargeAPIKey(ctx, request.APIKey)
+	}
+
+	return nil
+}
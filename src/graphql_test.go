@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGraphQLLookupsChargeAPIKey(t *testing.T) {
+	useTestRedis(t)
+
+	previous := config.APIKeys
+
+	config.APIKeys.Enable = true
+
+	t.Cleanup(func() {
+		config.APIKeys = previous
+	})
+
+	key, err := CreateAPIKey(context.Background(), "graphql", 0, 3)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+
+	app.Get("/graphql", CheckAPIKey, GraphQLHandler)
+
+	// Every lookup is rejected as a restricted target once it has been counted, so that no server is probed
+	query := `{
+		a: bedrock(address: "10.0.0.1") { online }
+		b: bedrock(address: "10.0.0.2") { online }
+		c: bedrock(address: "10.0.0.3") { online }
+		d: bedrock(address: "10.0.0.4") { online }
+		e: bedrock(address: "10.0.0.5") { online }
+	}`
+
+	req := httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape(query), nil)
+
+	req.Header.Set("X-API-Key", key.Key)
+
+	resp, err := app.Test(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	limited := 0
+
+	for _, err := range result.Errors {
+		if err.Message == ErrAPIKeyRateLimitExceeded.Error() {
+			limited++
+		}
+	}
+
+	// The request counts as the first lookup, which leaves two more within the rate limit of three
+	if limited != 2 {
+		t.Errorf("expected 2 lookups over the rate limit, got %d: %+v", limited, result.Errors)
+	}
+}
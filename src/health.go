@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Readiness is the result of the checks that decide whether this instance can serve requests.
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []SelfTestResult `json:"checks"`
+}
+
+// GetReadiness checks that Redis can be reached if it is configured and that Mojang's list of blocked servers has been
+// retrieved, without which lookups of blocked servers would be answered.
+func GetReadiness(ctx context.Context) Readiness {
+	checks := RunSelfTests(ctx, []SelfTest{
+		{"redis", config.Redis != nil, r.Ping},
+		{"blocked-servers", true, selfTestBlockedServers},
+	})
+
+	result := Readiness{
+		Ready:  true,
+		Checks: checks,
+	}
+
+	for _, check := range checks {
+		result.Ready = result.Ready && check.OK
+	}
+
+	return result
+}
+
+// HealthHandler responds with a 200 OK status as long as the process is alive, for liveness probes.
+func HealthHandler(ctx *fiber.Ctx) error {
+	return ctx.SendStatus(http.StatusOK)
+}
+
+// ReadyHandler responds with a 200 OK status if this instance can serve requests, or a 503 Service Unavailable status
+// otherwise, for readiness probes and load balancer health checks. The result of every check is returned in the body.
+func ReadyHandler(ctx *fiber.Ctx) error {
+	readiness := GetReadiness(ctx.UserContext())
+
+	if !readiness.Ready {
+		ctx.Status(http.StatusServiceUnavailable)
+	}
+
+	return ctx.JSON(readiness)
+}
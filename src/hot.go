@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// HotTarget is a frequently requested server, along with the options that select its cached status.
+type HotTarget struct {
+	Edition  string `json:"edition"`
+	Hostname string `json:"hostname"`
+	Port     uint16 `json:"port"`
+	Query    bool   `json:"query"`
+}
+
+// GetHotTargetsKey returns the key of the sorted set counting the requests made to each server during the window
+// that the time falls in.
+func GetHotTargetsKey(t time.Time) string {
+	return fmt.Sprintf("hot-targets:%d", t.Truncate(config.HotRefresh.Window).Unix())
+}
+
+// TrackHotTarget counts a request for the status of the server, which is refreshed in the background once it has
+// been requested often enough.
+func TrackHotTarget(ctx context.Context, edition, hostname string, port uint16, opts *StatusOptions) error {
+	if !config.HotRefresh.Enable {
+		return nil
+	}
+
+	member, err := json.Marshal(HotTarget{
+		Edition:  edition,
+		Hostname: hostname,
+		Port:     port,
+		Query:    edition == "java" && opts.Query,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return r.SortedSetIncrement(ctx, GetHotTargetsKey(time.Now()), string(member), config.HotRefresh.Window*2)
+}
+
+// GetHotTargets returns the servers requested at least the minimum number of times during the current and the previous
+// window, most requested first.
+func GetHotTargets(ctx context.Context) ([]HotTarget, error) {
+	now := time.Now()
+	scores := make(map[string]float64)
+
+	for _, key := range []string{GetHotTargetsKey(now), GetHotTargetsKey(now.Add(-config.HotRefresh.Window))} {
+		entries, err := r.SortedSetTop(ctx, key, int64(config.HotRefresh.MaxTargets)*2)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			scores[entry.Member] += entry.Score
+		}
+	}
+
+	members := make([]string, 0, len(scores))
+
+	for member, score := range scores {
+		if score >= float64(config.HotRefresh.MinRequests) {
+			members = append(members, member)
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return scores[members[i]] > scores[members[j]]
+	})
+
+	if len(members) > int(config.HotRefresh.MaxTargets) {
+		members = members[:config.HotRefresh.MaxTargets]
+	}
+
+	result := make([]HotTarget, 0, len(members))
+
+	for _, member := range members {
+		var target HotTarget
+
+		if err := json.Unmarshal([]byte(member), &target); err != nil {
+			return nil, err
+		}
+
+		result = append(result, target)
+	}
+
+	return result, nil
+}
+
+// RefreshHotTargets fetches a fresh status of every hot server whose cached status is about to expire or has already
+// expired. Statuses refreshed in the meantime by another instance are left as they are.
+func RefreshHotTargets(ctx context.Context) error {
+	targets, err := GetHotTargets(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	var group errgroup.Group
+
+	group.SetLimit(int(max(config.HotRefresh.Workers, 1)))
+
+	for _, target := range targets {
+		group.Go(func() error {
+			opts := &StatusOptions{
+				Query:         target.Query,
+				Timeout:       time.Second * 5,
+				Trigger:       "hot-refresh",
+				RefreshBefore: config.HotRefresh.RefreshBefore,
+			}
+
+			var err error
+
+			switch target.Edition {
+			case "java":
+				_, _, err = GetJavaStatus(ctx, target.Hostname, target.Port, opts)
+			case "bedrock":
+				_, _, err = GetBedrockStatus(ctx, target.Hostname, target.Port, opts)
+			}
+
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Failed to refresh hot %s server %s:%d: %v\n", target.Edition, target.Hostname, target.Port, err)
+			}
+
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// SyncHotTargets refreshes the hot servers at the given interval until the context is done.
+func SyncHotTargets(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := RefreshHotTargets(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to refresh hot servers: %v\n", err)
+		}
+	}
+}
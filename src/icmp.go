@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	icmpProtocolIPv4 = 1
+	icmpProtocolIPv6 = 58
+)
+
+var (
+	icmpPayload []byte = []byte("ping-server")
+
+	ErrICMPNotPermitted error = errors.New("sending ICMP echo requests is not permitted")
+)
+
+// PingICMP sends an ICMP echo request to the IP address and reports whether a reply was received before the timeout.
+// Unprivileged ICMP sockets are used where the kernel allows them, falling back to raw sockets, which require elevated
+// privileges. ErrICMPNotPermitted is returned if neither can be opened.
+func PingICMP(ctx context.Context, address string, timeout time.Duration) (bool, error) {
+	ip := net.ParseIP(address)
+
+	if ip == nil {
+		return false, fmt.Errorf("invalid IP address: %s", address)
+	}
+
+	var (
+		networks    []string  = []string{"udp4", "ip4:icmp"}
+		protocol    int       = icmpProtocolIPv4
+		requestType icmp.Type = ipv4.ICMPTypeEcho
+		replyType   icmp.Type = ipv4.ICMPTypeEchoReply
+		conn        *icmp.PacketConn
+		err         error
+	)
+
+	if ip.To4() == nil {
+		networks, protocol, requestType, replyType = []string{"udp6", "ip6:ipv6-icmp"}, icmpProtocolIPv6, ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	var destination net.Addr
+
+	for _, network := range networks {
+		if conn, err = icmp.ListenPacket(network, ""); err != nil {
+			continue
+		}
+
+		// Unprivileged ICMP sockets are datagram sockets, which are addressed by UDP addresses
+		if network == networks[0] {
+			destination = &net.UDPAddr{IP: ip}
+		} else {
+			destination = &net.IPAddr{IP: ip}
+		}
+
+		break
+	}
+
+	if conn == nil {
+		return false, fmt.Errorf("%w: %v", ErrICMPNotPermitted, err)
+	}
+
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	if err = conn.SetDeadline(deadline); err != nil {
+		return false, err
+	}
+
+	// The kernel replaces the identifier of unprivileged echo requests, so replies are matched by their sequence number
+	// and payload instead
+	sequence := rand.Intn(1 << 16)
+
+	request, err := (&icmp.Message{
+		Type: requestType,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   os.Getpid() & 0xffff,
+			Seq:  sequence,
+			Data: icmpPayload,
+		},
+	}).Marshal(nil)
+
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = conn.WriteTo(request, destination); err != nil {
+		return false, err
+	}
+
+	buf := make([]byte, 1500)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			if IsTimeoutError(err) {
+				return false, nil
+			}
+
+			return false, err
+		}
+
+		message, err := icmp.ParseMessage(protocol, buf[:n])
+
+		if err != nil || message.Type != replyType {
+			continue
+		}
+
+		if echo, ok := message.Body.(*icmp.Echo); ok && echo.Seq == sequence && bytes.Equal(echo.Data, icmpPayload) {
+			return true, nil
+		}
+	}
+}
+
+// IsTimeoutError checks whether the error is caused by a network operation or context reaching its deadline.
+func IsTimeoutError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"main/src/assets"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/image/draw"
+)
+
+const (
+	maxIconOverrideSize = 64 * 1024
+	iconOverrideWidth   = 64
+	iconOverrideHeight  = 64
+	minIconSize         = 16
+	maxIconSize         = 512
+	iconJPEGQuality     = 90
+	maxIconSourceSize   = 64
+)
+
+var (
+	ErrInvalidIcon error = errors.New("icon is not a valid PNG image of at most 64x64 pixels")
+)
+
+// IconOverride is a custom icon uploaded by the verified owner of a server.
+type IconOverride struct {
+	Mode      string    `json:"mode"`
+	Data      []byte    `json:"data,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// IconResponse is the JSON representation of an icon, for clients that embed icons into JSON driven interfaces.
+type IconResponse struct {
+	DataURI     string `json:"data_uri"`
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Hash        string `json:"hash"`
+}
+
+// SendIcon writes the PNG icon in the format requested by the 'format' query parameter, scaled to the size requested by
+// the 'size' query parameter. Icons are converted to JPEG or WebP on request, for consumers that prefer smaller payloads.
+func SendIcon(ctx *fiber.Ctx, icon []byte, lastModified time.Time) error {
+	if value := ctx.Query("size"); len(value) > 0 {
+		size, err := strconv.Atoi(value)
+
+		if err != nil || size < minIconSize || size > maxIconSize {
+			return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Invalid 'size' query parameter, must be between %d and %d", minIconSize, maxIconSize))
+		}
+
+		resized, err := GetResizedIcon(ctx.UserContext(), icon, size)
+
+		// Icons that cannot be decoded are sent unscaled rather than failing the request
+		if err != nil && !errors.Is(err, ErrInvalidIcon) {
+			return err
+		}
+
+		if err == nil {
+			icon = resized
+		}
+	}
+
+	switch ctx.Query("format", "png") {
+	case "png":
+		return SendContent(ctx, "png", icon, lastModified)
+	case "jpeg", "webp":
+		format := ctx.Query("format")
+
+		converted, err := GetConvertedIcon(ctx.UserContext(), icon, format)
+
+		if errors.Is(err, ErrInvalidIcon) {
+			converted, err = GetConvertedIcon(ctx.UserContext(), assets.DefaultIcon, format)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return SendContent(ctx, format, converted, lastModified)
+	case "json":
+		imageConfig, err := png.DecodeConfig(bytes.NewReader(icon))
+
+		if err != nil {
+			icon = assets.DefaultIcon
+
+			if imageConfig, err = png.DecodeConfig(bytes.NewReader(icon)); err != nil {
+				return err
+			}
+		}
+
+		return ctx.JSON(IconResponse{
+			DataURI:     fmt.Sprintf("data:image/png;base64,%s", base64.StdEncoding.EncodeToString(icon)),
+			ContentType: "image/png",
+			Width:       imageConfig.Width,
+			Height:      imageConfig.Height,
+			Hash:        SHA256(string(icon)),
+		})
+	default:
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'format' query parameter, must be 'png', 'jpeg', 'webp' or 'json'")
+	}
+}
+
+// GetResizedIcon returns the PNG icon scaled to a square of the size, either using cache or resampling the icon. The
+// scaled icons are cached by the hash of the original, so that they never outlive a change of the icon.
+func GetResizedIcon(ctx context.Context, icon []byte, size int) ([]byte, error) {
+	result, _, err := cacheStore.GetOrSet(ctx, fmt.Sprintf("icon-resized:%s:%d", SHA256(string(icon)), size), func() ([]byte, error) {
+		source, err := decodeIcon(icon)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if bounds := source.Bounds(); bounds.Dx() == size && bounds.Dy() == size {
+			return icon, nil
+		}
+
+		target := image.NewNRGBA(image.Rect(0, 0, size, size))
+
+		draw.CatmullRom.Scale(target, target.Bounds(), source, source.Bounds(), draw.Src, nil)
+
+		buf := &bytes.Buffer{}
+
+		if err = png.Encode(buf, target); err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}, config.Cache.IconDuration, nil)
+
+	return result, err
+}
+
+// GetConvertedIcon returns the PNG icon encoded in the JPEG or WebP format, either using cache or encoding the icon. JPEG
+// has no transparency, so transparent pixels are flattened onto a white background.
+func GetConvertedIcon(ctx context.Context, icon []byte, format string) ([]byte, error) {
+	result, _, err := cacheStore.GetOrSet(ctx, fmt.Sprintf("icon-converted:%s:%s", SHA256(string(icon)), format), func() ([]byte, error) {
+		source, err := decodeIcon(icon)
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf := &bytes.Buffer{}
+
+		switch format {
+		case "jpeg":
+			target := image.NewRGBA(source.Bounds())
+
+			draw.Draw(target, target.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+			draw.Draw(target, target.Bounds(), source, source.Bounds().Min, draw.Over)
+
+			err = jpeg.Encode(buf, target, &jpeg.Options{Quality: iconJPEGQuality})
+		case "webp":
+			err = nativewebp.Encode(buf, source, nil)
+		default:
+			err = fmt.Errorf("unsupported icon format: %s", format)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}, config.Cache.IconDuration, nil)
+
+	return result, err
+}
+
+// decodeIcon decodes the PNG icon, checking its dimensions before decoding so that a server cannot make the image
+// allocate more than an icon needs. ErrInvalidIcon is returned if the icon is not a PNG image of at most 64x64 pixels.
+func decodeIcon(icon []byte) (image.Image, error) {
+	imageConfig, err := png.DecodeConfig(bytes.NewReader(icon))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIcon, err)
+	}
+
+	if imageConfig.Width < 1 || imageConfig.Height < 1 || imageConfig.Width > maxIconSourceSize || imageConfig.Height > maxIconSourceSize {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrInvalidIcon, imageConfig.Width, imageConfig.Height)
+	}
+
+	source, err := png.Decode(bytes.NewReader(icon))
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIcon, err)
+	}
+
+	return source, nil
+}
+
+// GetIconOverride returns the custom icon uploaded for the server, or nil if there is none.
+func GetIconOverride(ctx context.Context, hostname string, port uint16) (*IconOverride, error) {
+	cache, _, err := r.Get(ctx, fmt.Sprintf("icon-override:%s", GetOwnerKey("java", hostname, port)))
+
+	if err != nil || cache == nil {
+		return nil, err
+	}
+
+	var result IconOverride
+
+	if err = json.Unmarshal(cache, &result); err != nil {
+		return nil, err
+	}
+
+	// Icons uploaded before artifact storage was introduced are still stored inline
+	if result.Key != "" {
+		if result.Data, err = artifacts.Get(ctx, result.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &result, nil
+}
+
+// ValidateIconOverride checks that the uploaded data is a PNG image with the dimensions of a server icon.
+func ValidateIconOverride(data []byte) error {
+	if len(data) > maxIconOverrideSize {
+		return fmt.Errorf("icon must not be larger than %d bytes", maxIconOverrideSize)
+	}
+
+	imageConfig, err := png.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return fmt.Errorf("icon must be a valid PNG image")
+	}
+
+	if imageConfig.Width != iconOverrideWidth || imageConfig.Height != iconOverrideHeight {
+		return fmt.Errorf("icon must be %dx%d pixels", iconOverrideWidth, iconOverrideHeight)
+	}
+
+	return nil
+}
+
+// UploadIconOverrideHandler stores the PNG image in the request body as the custom icon of the server.
+func UploadIconOverrideHandler(ctx *fiber.Ctx) error {
+	if ctx.Locals("edition").(string) != "java" {
+		return ctx.Status(http.StatusBadRequest).SendString("Icons are only supported for Java Edition servers")
+	}
+
+	mode := ctx.Query("mode", "replace")
+
+	if mode != "replace" && mode != "fallback" {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'mode' query parameter, must be 'replace' or 'fallback'")
+	}
+
+	if err := ValidateIconOverride(ctx.Body()); err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	ownerKey := GetOwnerKey("java", ctx.Locals("hostname").(string), ctx.Locals("port").(uint16))
+	key := fmt.Sprintf("icon-overrides/%s.png", ownerKey)
+
+	if err := artifacts.Put(ctx.UserContext(), key, ctx.Body(), "image/png"); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(IconOverride{
+		Mode:      mode,
+		Key:       key,
+		UpdatedAt: time.Now().UTC(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err = r.Set(ctx.UserContext(), fmt.Sprintf("icon-override:%s", ownerKey), data, 0); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// DeleteIconOverrideHandler removes the custom icon of the server.
+func DeleteIconOverrideHandler(ctx *fiber.Ctx) error {
+	ownerKey := GetOwnerKey(ctx.Locals("edition").(string), ctx.Locals("hostname").(string), ctx.Locals("port").(uint16))
+
+	if err := r.Delete(ctx.UserContext(), fmt.Sprintf("icon-override:%s", ownerKey)); err != nil {
+		return err
+	}
+
+	if err := artifacts.Delete(ctx.UserContext(), fmt.Sprintf("icon-overrides/%s.png", ownerKey)); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"main/src/assets"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func encodeTestIcon(t *testing.T, width, height int) []byte {
+	buf := &bytes.Buffer{}
+
+	if err := png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeIcon(t *testing.T) {
+	tests := []struct {
+		Name string
+		Icon []byte
+		Err  error
+	}{
+		{"64x64", encodeTestIcon(t, 64, 64), nil},
+		{"32x16", encodeTestIcon(t, 32, 16), nil},
+		{"65x64", encodeTestIcon(t, 65, 64), ErrInvalidIcon},
+		{"4096x4096", encodeTestIcon(t, 4096, 4096), ErrInvalidIcon},
+		{"truncated", encodeTestIcon(t, 64, 64)[:40], ErrInvalidIcon},
+		{"garbage", []byte("not a png"), ErrInvalidIcon},
+		{"empty", nil, ErrInvalidIcon},
+	}
+
+	for _, test := range tests {
+		if _, err := decodeIcon(test.Icon); !errors.Is(err, test.Err) {
+			t.Errorf("decodeIcon(%s) = %v, expected %v", test.Name, err, test.Err)
+		}
+	}
+}
+
+func TestGetResizedIcon(t *testing.T) {
+	resized, err := GetResizedIcon(context.Background(), assets.DefaultIcon, 32)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imageConfig, err := png.DecodeConfig(bytes.NewReader(resized))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imageConfig.Width != 32 || imageConfig.Height != 32 {
+		t.Errorf("expected a 32x32 icon, got %dx%d", imageConfig.Width, imageConfig.Height)
+	}
+}
+
+func TestSendIconWithInvalidIcon(t *testing.T) {
+	corrupt := []byte("\x89PNG\r\n\x1a\nnot really a png")
+
+	app := fiber.New()
+
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return SendIcon(ctx, corrupt, time.Now())
+	})
+
+	tests := []struct {
+		Query       string
+		ContentType string
+		Body        []byte
+	}{
+		{"size=32", "image/png", corrupt},
+		{"format=jpeg", "image/jpeg", nil},
+		{"format=webp", "image/webp", nil},
+		{"format=json", "application/json", nil},
+	}
+
+	for _, test := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", "/?"+test.Query, nil))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+
+		if resp.StatusCode != fiber.StatusOK {
+			t.Errorf("%s: expected status 200, got %d: %s", test.Query, resp.StatusCode, body)
+
+			continue
+		}
+
+		if contentType := resp.Header.Get("Content-Type"); contentType != test.ContentType {
+			t.Errorf("%s: expected content type %s, got %s", test.Query, test.ContentType, contentType)
+		}
+
+		if test.Body != nil && !bytes.Equal(body, test.Body) {
+			t.Errorf("%s: expected the unscaled icon", test.Query)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	inflight *InflightRegistry = &InflightRegistry{
+		Lookups: make(map[string]*InflightLookup),
+		Mutex:   &sync.Mutex{},
+	}
+)
+
+// InflightRegistry keeps track of every lookup that is currently being performed by this process.
+type InflightRegistry struct {
+	Lookups map[string]*InflightLookup
+	Mutex   *sync.Mutex
+}
+
+// InflightLookup is a single lookup that is currently being performed.
+type InflightLookup struct {
+	ID        string    `json:"id"`
+	Edition   string    `json:"edition"`
+	Target    string    `json:"target"`
+	Trigger   string    `json:"trigger"`
+	StartedAt time.Time `json:"started_at"`
+	Elapsed   float64   `json:"elapsed"`
+	cancel    context.CancelFunc
+}
+
+// Start registers a new lookup and returns a context that is cancelled if the lookup is cancelled, and a function
+// that must be called once the lookup has finished.
+func (i *InflightRegistry) Start(parent context.Context, edition, hostname string, port uint16, trigger string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	lookup := &InflightLookup{
+		ID:        RandomHexString(8),
+		Edition:   edition,
+		Target:    fmt.Sprintf("%s:%d", hostname, port),
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	i.Mutex.Lock()
+	i.Lookups[lookup.ID] = lookup
+	i.Mutex.Unlock()
+
+	return ctx, func() {
+		i.Mutex.Lock()
+		delete(i.Lookups, lookup.ID)
+		i.Mutex.Unlock()
+
+		cancel()
+	}
+}
+
+// List returns a snapshot of all lookups currently being performed, oldest first.
+func (i *InflightRegistry) List() []InflightLookup {
+	i.Mutex.Lock()
+
+	defer i.Mutex.Unlock()
+
+	result := make([]InflightLookup, 0, len(i.Lookups))
+
+	for _, lookup := range i.Lookups {
+		value := *lookup
+		value.Elapsed = time.Since(lookup.StartedAt).Seconds()
+
+		result = append(result, value)
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].StartedAt.Before(result[b].StartedAt)
+	})
+
+	return result
+}
+
+// Cancel aborts the lookup with the given ID, returning false if no such lookup exists.
+func (i *InflightRegistry) Cancel(id string) bool {
+	i.Mutex.Lock()
+
+	defer i.Mutex.Unlock()
+
+	lookup, ok := i.Lookups[id]
+
+	if !ok {
+		return false
+	}
+
+	lookup.cancel()
+
+	return true
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcstatus-io/mcutil/v4/formatting"
+	"github.com/mcstatus-io/mcutil/v4/proto"
+	"github.com/mcstatus-io/mcutil/v4/response"
+	"github.com/mcstatus-io/mcutil/v4/util"
+)
+
+// maxJavaPacketSize is the largest packet that a Java Edition server is allowed to send.
+const maxJavaPacketSize = 2097151
+
+var (
+	ErrInvalidJavaPacket error = errors.New("invalid Java Edition packet")
+)
+
+// javaStatusJSON is the status document sent by Java Edition servers in response to a status request.
+type javaStatusJSON struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int64  `json:"protocol"`
+	} `json:"version"`
+	Players struct {
+		Max    *int64 `json:"max"`
+		Online *int64 `json:"online"`
+		Sample []struct {
+			ID   interface{} `json:"id"`
+			Name string      `json:"name"`
+		} `json:"sample"`
+	} `json:"players"`
+	Description interface{} `json:"description"`
+	Favicon     *string     `json:"favicon"`
+	ModInfo     struct {
+		List []struct {
+			ID      string `json:"modid"`
+			Version string `json:"version"`
+		} `json:"modList"`
+		Type string `json:"type"`
+	} `json:"modinfo"`
+	ForgeData struct {
+		Mods []struct {
+			ID      string `json:"modId"`
+			Version string `json:"modmarker"`
+		} `json:"mods"`
+	} `json:"forgeData"`
+}
+
+// PingJava retrieves the status of a Java Edition server with a server list ping. The hostname and port are sent in the
+// handshake, while the connection is made to the address, which is the target of the SRV record if there is one.
+// Unlike the status of mcutil, the connection is made through the target dialer, so that target protection applies to
+// the address actually connected to, and the unparsed status is returned along with the parsed one.
+func PingJava(ctx context.Context, hostname string, port uint16, address string) (*response.StatusModern, json.RawMessage, error) {
+	conn, err := NewTargetDialer().DialContext(ctx, "tcp", address)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer conn.Close()
+
+	// A tarpit fails the ping as soon as it falls below the minimum throughput, instead of holding it until the deadline
+	if config.Tarpit.Enable {
+		conn = newThroughputConn(conn, config.Tarpit.MinThroughput, config.Tarpit.Window)
+	}
+
+	return pingJavaConn(ctx, conn, hostname, port)
+}
+
+// pingJavaConn performs the server list ping over the connection, sending the hostname and port in the handshake.
+func pingJavaConn(ctx context.Context, conn net.Conn, hostname string, port uint16) (*response.StatusModern, json.RawMessage, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Unblock the reads as soon as the context is cancelled rather than at its deadline
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+
+	defer stop()
+
+	request, err := NewJavaStatusRequest(hostname, port)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err = conn.Write(request); err != nil {
+		return nil, nil, wrapContextError(ctx, err)
+	}
+
+	reader := bufio.NewReader(conn)
+
+	packet, err := ReadJavaPacket(reader)
+
+	if err != nil {
+		return nil, nil, wrapContextError(ctx, err)
+	}
+
+	raw, err := ParseJavaStatusPacket(packet)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := ParseJavaStatus(raw)
+
+	if err != nil {
+		return nil, raw, err
+	}
+
+	payload := rand.Int63()
+
+	if _, err = conn.Write(NewJavaPingRequest(payload)); err != nil {
+		return nil, raw, wrapContextError(ctx, err)
+	}
+
+	start := time.Now()
+
+	if packet, err = ReadJavaPacket(reader); err != nil {
+		return nil, raw, wrapContextError(ctx, err)
+	}
+
+	if err = ParseJavaPongPacket(packet, payload); err != nil {
+		return nil, raw, err
+	}
+
+	result.Latency = time.Since(start)
+
+	return result, raw, nil
+}
+
+// LookupJavaAddress returns the address that the game connects to for the Java Edition server, which is the target of
+// its SRV record when the default port is used.
+func LookupJavaAddress(ctx context.Context, hostname string, port uint16) string {
+	if port == util.DefaultJavaPort && net.ParseIP(hostname) == nil {
+		if record, _, err := LookupSRV(ctx, hostname); err == nil && record != nil {
+			return net.JoinHostPort(strings.Trim(record.Target, "."), strconv.Itoa(int(record.Port)))
+		}
+	}
+
+	return net.JoinHostPort(hostname, strconv.Itoa(int(port)))
+}
+
+// NewJavaStatusRequest returns the handshake and status request packets that start a Java Edition status lookup.
+func NewJavaStatusRequest(hostname string, port uint16) ([]byte, error) {
+	handshake := &bytes.Buffer{}
+
+	// Packet ID, protocol version, server address, server port and the status state as the next state
+	if err := proto.WriteVarInt(0x00, handshake); err != nil {
+		return nil, err
+	}
+
+	if err := proto.WriteVarInt(-1, handshake); err != nil {
+		return nil, err
+	}
+
+	if err := proto.WriteString(hostname, handshake); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Write(handshake, binary.BigEndian, port); err != nil {
+		return nil, err
+	}
+
+	if err := proto.WriteVarInt(1, handshake); err != nil {
+		return nil, err
+	}
+
+	result := &bytes.Buffer{}
+
+	if err := proto.WriteVarInt(int32(handshake.Len()), result); err != nil {
+		return nil, err
+	}
+
+	result.Write(handshake.Bytes())
+
+	// The status request is an empty packet with the ID 0x00
+	result.Write([]byte{0x01, 0x00})
+
+	return result.Bytes(), nil
+}
+
+// NewJavaPingRequest returns the ping packet that a Java Edition server answers with a pong of the same payload.
+func NewJavaPingRequest(payload int64) []byte {
+	result := make([]byte, 10)
+
+	result[0] = 0x09
+	result[1] = 0x01
+
+	binary.BigEndian.PutUint64(result[2:], uint64(payload))
+
+	return result
+}
+
+// ReadJavaPacket reads a length-prefixed Java Edition packet, returning its content starting with the packet ID.
+func ReadJavaPacket(r io.Reader) ([]byte, error) {
+	length, err := proto.ReadVarInt(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length < 1 || length > maxJavaPacketSize {
+		return nil, fmt.Errorf("%w: length of %d bytes", ErrInvalidJavaPacket, length)
+	}
+
+	packet := make([]byte, length)
+
+	if _, err = io.ReadFull(r, packet); err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// ParseJavaStatusPacket returns the status document of a status response packet.
+func ParseJavaStatusPacket(packet []byte) (json.RawMessage, error) {
+	r := bytes.NewReader(packet)
+
+	packetID, err := proto.ReadVarInt(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if packetID != 0x00 {
+		return nil, fmt.Errorf("%w: expected status response, received ID 0x%02X", ErrInvalidJavaPacket, packetID)
+	}
+
+	length, err := proto.ReadVarInt(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length < 0 || int(length) > r.Len() {
+		return nil, fmt.Errorf("%w: status of %d bytes in a packet of %d bytes", ErrInvalidJavaPacket, length, len(packet))
+	}
+
+	result := make([]byte, length)
+
+	if _, err = io.ReadFull(r, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ParseJavaPongPacket checks that the packet is a pong with the payload of the ping.
+func ParseJavaPongPacket(packet []byte, payload int64) error {
+	if len(packet) != 9 || packet[0] != 0x01 {
+		return fmt.Errorf("%w: expected pong", ErrInvalidJavaPacket)
+	}
+
+	if received := int64(binary.BigEndian.Uint64(packet[1:])); received != payload {
+		return fmt.Errorf("%w: expected pong payload %X, received %X", ErrInvalidJavaPacket, payload, received)
+	}
+
+	return nil
+}
+
+// ParseJavaStatus parses the status document of a Java Edition server into the status of mcutil.
+func ParseJavaStatus(data []byte) (*response.StatusModern, error) {
+	var status javaStatusJSON
+
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+
+	motd, err := formatting.Parse(status.Description)
+
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := formatting.Parse(status.Version.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &response.StatusModern{
+		Version: response.Version{
+			Name:     *version,
+			Protocol: status.Version.Protocol,
+		},
+		Players: response.Players{
+			Online: status.Players.Online,
+			Max:    status.Players.Max,
+			Sample: make([]response.SamplePlayer, 0, len(status.Players.Sample)),
+		},
+		MOTD:    *motd,
+		Favicon: status.Favicon,
+	}
+
+	for _, player := range status.Players.Sample {
+		name, err := formatting.Parse(player.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		id, ok := parsePlayerID(player.ID)
+
+		if !ok {
+			return nil, fmt.Errorf("invalid player UUID: %v", player.ID)
+		}
+
+		result.Players.Sample = append(result.Players.Sample, response.SamplePlayer{
+			ID:   id,
+			Name: *name,
+		})
+	}
+
+	if len(status.ModInfo.Type) > 0 {
+		result.Mods = &response.ModInfo{
+			Type: status.ModInfo.Type,
+			List: make([]response.Mod, 0, len(status.ModInfo.List)),
+		}
+
+		for _, mod := range status.ModInfo.List {
+			result.Mods.List = append(result.Mods.List, response.Mod{
+				ID:      mod.ID,
+				Version: mod.Version,
+			})
+		}
+	}
+
+	if status.ForgeData.Mods != nil {
+		result.Mods = &response.ModInfo{
+			Type: "FML2",
+			List: make([]response.Mod, 0, len(status.ForgeData.Mods)),
+		}
+
+		for _, mod := range status.ForgeData.Mods {
+			result.Mods.List = append(result.Mods.List, response.Mod{
+				ID:      mod.ID,
+				Version: mod.Version,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// parsePlayerID returns the UUID of a sample player, sent either as a string or as an array of four integers.
+func parsePlayerID(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		if len(v) != 4 {
+			return "", false
+		}
+
+		result := ""
+
+		for _, part := range v {
+			number, ok := part.(float64)
+
+			if !ok {
+				return "", false
+			}
+
+			result += fmt.Sprintf("%08x", uint32(int32(number)))
+		}
+
+		return result, true
+	default:
+		return "", false
+	}
+}
+
+// wrapContextError returns the error of the context if it was cancelled, which is the cause of any error of a
+// connection whose deadline was moved when the context was cancelled.
+func wrapContextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// SubsystemStopped is the state of a subsystem that has not been started, or has been stopped.
+	SubsystemStopped = "stopped"
+	// SubsystemStarting is the state of a subsystem that is waiting to become ready.
+	SubsystemStarting = "starting"
+	// SubsystemRunning is the state of a subsystem that is ready.
+	SubsystemRunning = "running"
+	// SubsystemFailed is the state of a subsystem that failed to start or to stop.
+	SubsystemFailed = "failed"
+
+	defaultSubsystemTimeout = time.Second * 10
+)
+
+var (
+	lifecycle *Lifecycle = &Lifecycle{
+		Subsystems: make([]*Subsystem, 0),
+		Mutex:      &sync.Mutex{},
+	}
+
+	ErrSubsystemPermanent error = errors.New("subsystem cannot be restarted while the server is running")
+	ErrUnknownSubsystem   error = errors.New("unknown subsystem")
+)
+
+// Subsystem is a part of the server that is started and stopped by the lifecycle manager. Start returns once the
+// subsystem is ready, which gates the start of the subsystems that depend on it, and Run is then kept running in the
+// background until the subsystem is stopped. Every function is optional.
+type Subsystem struct {
+	Name      string
+	DependsOn []string
+	Timeout   time.Duration
+	Permanent bool
+	Start     func(ctx context.Context) error
+	Run       func(ctx context.Context)
+	Stop      func(ctx context.Context) error
+	State     string
+	Error     error
+	StartedAt *time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// SubsystemState is the state of a subsystem as reported by the admin API.
+type SubsystemState struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"depends_on"`
+	Permanent bool     `json:"permanent"`
+	State     string   `json:"state"`
+	Error     *string  `json:"error"`
+	StartedAt *int64   `json:"started_at"`
+}
+
+// Lifecycle starts the registered subsystems in dependency order and stops them in the reverse order.
+type Lifecycle struct {
+	Subsystems []*Subsystem
+	Mutex      *sync.Mutex
+}
+
+// Register adds the subsystem to the lifecycle. Subsystems must be registered before the lifecycle is started.
+func (l *Lifecycle) Register(subsystem *Subsystem) {
+	l.Mutex.Lock()
+
+	defer l.Mutex.Unlock()
+
+	if subsystem.Timeout == 0 {
+		subsystem.Timeout = defaultSubsystemTimeout
+	}
+
+	subsystem.State = SubsystemStopped
+
+	l.Subsystems = append(l.Subsystems, subsystem)
+}
+
+// Start starts every subsystem in dependency order, returning the error of the first subsystem that fails to become
+// ready within its timeout.
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.Mutex.Lock()
+
+	defer l.Mutex.Unlock()
+
+	order, err := l.order()
+
+	if err != nil {
+		return err
+	}
+
+	for _, subsystem := range order {
+		if err = subsystem.start(ctx); err != nil {
+			return fmt.Errorf("%s: %w", subsystem.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Stop stops every running subsystem in the reverse of the dependency order. Errors are logged rather than returned
+// so that a subsystem failing to stop does not keep the others running.
+func (l *Lifecycle) Stop(ctx context.Context) {
+	l.Mutex.Lock()
+
+	defer l.Mutex.Unlock()
+
+	order, err := l.order()
+
+	if err != nil {
+		order = l.Subsystems
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		if order[i].State != SubsystemRunning {
+			continue
+		}
+
+		if err = order[i].stop(ctx); err != nil {
+			log.Printf("Failed to stop %s: %v\n", order[i].Name, err)
+		}
+	}
+}
+
+// Restart stops and starts a single subsystem, leaving the subsystems that depend on it running. Its dependencies
+// must be running.
+func (l *Lifecycle) Restart(ctx context.Context, name string) error {
+	l.Mutex.Lock()
+
+	defer l.Mutex.Unlock()
+
+	subsystem := l.get(name)
+
+	if subsystem == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownSubsystem, name)
+	}
+
+	if subsystem.Permanent {
+		return ErrSubsystemPermanent
+	}
+
+	for _, dependency := range subsystem.DependsOn {
+		if value := l.get(dependency); value == nil || value.State != SubsystemRunning {
+			return fmt.Errorf("dependency is not running: %s", dependency)
+		}
+	}
+
+	if subsystem.State == SubsystemRunning {
+		if err := subsystem.stop(ctx); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Restarting %s\n", name)
+
+	return subsystem.start(ctx)
+}
+
+// List returns the state of every registered subsystem, in registration order.
+func (l *Lifecycle) List() []SubsystemState {
+	l.Mutex.Lock()
+
+	defer l.Mutex.Unlock()
+
+	result := make([]SubsystemState, 0, len(l.Subsystems))
+
+	for _, subsystem := range l.Subsystems {
+		state := SubsystemState{
+			Name:      subsystem.Name,
+			DependsOn: subsystem.DependsOn,
+			Permanent: subsystem.Permanent,
+			State:     subsystem.State,
+			Error:     nil,
+			StartedAt: nil,
+		}
+
+		if state.DependsOn == nil {
+			state.DependsOn = make([]string, 0)
+		}
+
+		if subsystem.Error != nil {
+			state.Error = PointerOf(subsystem.Error.Error())
+		}
+
+		if subsystem.StartedAt != nil {
+			state.StartedAt = PointerOf(subsystem.StartedAt.UnixMilli())
+		}
+
+		result = append(result, state)
+	}
+
+	return result
+}
+
+func (l *Lifecycle) get(name string) *Subsystem {
+	for _, subsystem := range l.Subsystems {
+		if subsystem.Name == name {
+			return subsystem
+		}
+	}
+
+	return nil
+}
+
+// order sorts the subsystems so that every subsystem comes after its dependencies, keeping the registration order
+// otherwise.
+func (l *Lifecycle) order() ([]*Subsystem, error) {
+	var (
+		result  []*Subsystem    = make([]*Subsystem, 0, len(l.Subsystems))
+		visited map[string]bool = make(map[string]bool)
+		visit   func(*Subsystem) error
+	)
+
+	visit = func(subsystem *Subsystem) error {
+		if done, ok := visited[subsystem.Name]; ok {
+			if !done {
+				return fmt.Errorf("dependency cycle at subsystem: %s", subsystem.Name)
+			}
+
+			return nil
+		}
+
+		visited[subsystem.Name] = false
+
+		for _, name := range subsystem.DependsOn {
+			dependency := l.get(name)
+
+			if dependency == nil {
+				return fmt.Errorf("subsystem %s depends on unknown subsystem: %s", subsystem.Name, name)
+			}
+
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		visited[subsystem.Name] = true
+
+		result = append(result, subsystem)
+
+		return nil
+	}
+
+	for _, subsystem := range l.Subsystems {
+		if err := visit(subsystem); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Subsystem) start(ctx context.Context) error {
+	s.State = SubsystemStarting
+	s.Error = nil
+
+	if s.Start != nil {
+		ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+
+		defer cancel()
+
+		if err := runWithContext(ctx, s.Start); err != nil {
+			s.State = SubsystemFailed
+			s.Error = err
+
+			return err
+		}
+	}
+
+	if s.Run != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		s.cancel = cancel
+		s.done = make(chan struct{})
+
+		go func(done chan struct{}) {
+			defer close(done)
+
+			s.Run(ctx)
+		}(s.done)
+	}
+
+	s.State = SubsystemRunning
+	s.StartedAt = PointerOf(time.Now())
+
+	return nil
+}
+
+func (s *Subsystem) stop(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+
+	defer cancel()
+
+	// Wait for the background loop to return before stopping what it may still be using
+	if s.cancel != nil {
+		s.cancel()
+
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			s.State = SubsystemFailed
+			s.Error = ctx.Err()
+
+			return ctx.Err()
+		}
+
+		s.cancel = nil
+		s.done = nil
+	}
+
+	if s.Stop != nil {
+		if err := runWithContext(ctx, s.Stop); err != nil {
+			s.State = SubsystemFailed
+			s.Error = err
+
+			return err
+		}
+	}
+
+	s.State = SubsystemStopped
+	s.StartedAt = nil
+
+	return nil
+}
+
+// runWithContext runs the function until it returns or the context is done, for functions that do not respect the
+// deadline of the context themselves.
+func runWithContext(ctx context.Context, fn func(ctx context.Context) error) error {
+	result := make(chan error, 1)
+
+	go func() {
+		result <- fn(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ListSubsystemsHandler returns the state of every subsystem of the server.
+func ListSubsystemsHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(lifecycle.List())
+}
+
+// RestartSubsystemHandler restarts the subsystem with the name in the parameters.
+func RestartSubsystemHandler(ctx *fiber.Ctx) error {
+	err := lifecycle.Restart(ctx.UserContext(), ctx.Params("name"))
+
+	if errors.Is(err, ErrUnknownSubsystem) {
+		return ctx.Status(http.StatusNotFound).SendString(err.Error())
+	}
+
+	if err != nil {
+		return ctx.Status(http.StatusConflict).SendString(err.Error())
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
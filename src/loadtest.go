@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// LoadTestPatternUniform spreads the requests evenly over every mock server.
+	LoadTestPatternUniform = "uniform"
+	// LoadTestPatternZipf sends most requests to a few hot mock servers, like real traffic does.
+	LoadTestPatternZipf = "zipf"
+)
+
+var (
+	loadTest *LoadTestOptions = nil
+)
+
+// LoadTestOptions are the settings of the synthetic traffic generated by the loadtest command.
+type LoadTestOptions struct {
+	Duration        time.Duration
+	Concurrency     int
+	Rate            int
+	Servers         int
+	Pattern         string
+	Edition         string
+	UpstreamLatency time.Duration
+	JSON            bool
+}
+
+// LoadTestReport is the result of a load test.
+type LoadTestReport struct {
+	Duration    time.Duration    `json:"duration"`
+	Requests    int64            `json:"requests"`
+	Failures    int64            `json:"failures"`
+	Throughput  float64          `json:"throughput"`
+	Latency     LoadTestLatency  `json:"latency"`
+	StatusCodes map[int]int64    `json:"status_codes"`
+	CacheHits   int64            `json:"cache_hits"`
+	CacheMisses int64            `json:"cache_misses"`
+	Memory      LoadTestMemory   `json:"memory"`
+	Options     *LoadTestOptions `json:"options"`
+}
+
+// LoadTestLatency is the distribution of the request latencies of a load test.
+type LoadTestLatency struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// LoadTestMemory is the memory used by the process during a load test.
+type LoadTestMemory struct {
+	HeapBefore uint64 `json:"heap_before"`
+	HeapAfter  uint64 `json:"heap_after"`
+	HeapPeak   uint64 `json:"heap_peak"`
+	TotalAlloc uint64 `json:"total_alloc"`
+	GCCycles   uint32 `json:"gc_cycles"`
+}
+
+// ParseLoadTestOptions parses the arguments of the loadtest command.
+func ParseLoadTestOptions(args []string) (*LoadTestOptions, error) {
+	result := &LoadTestOptions{}
+
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+
+	flags.DurationVar(&result.Duration, "duration", time.Second*30, "How long to generate traffic for")
+	flags.IntVar(&result.Concurrency, "concurrency", 32, "Number of requests in flight at once")
+	flags.IntVar(&result.Rate, "rate", 0, "Maximum number of requests per second, 0 for as many as the concurrency allows")
+	flags.IntVar(&result.Servers, "servers", 100, "Number of distinct mock servers to request the status of")
+	flags.StringVar(&result.Pattern, "pattern", LoadTestPatternZipf, "How requests are spread over the mock servers: 'uniform' or 'zipf'")
+	flags.StringVar(&result.Edition, "edition", "java", "Edition of the mock servers: 'java', 'bedrock' or 'mixed'")
+	flags.DurationVar(&result.UpstreamLatency, "upstream-latency", time.Millisecond*20, "Delay of the mock servers before they answer a status request")
+	flags.BoolVar(&result.JSON, "json", false, "Print the report as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if result.Duration <= 0 || result.Concurrency < 1 || result.Rate < 0 || result.Servers < 1 {
+		return nil, errors.New("duration, concurrency and servers must be positive and rate must not be negative")
+	}
+
+	if result.Pattern != LoadTestPatternUniform && result.Pattern != LoadTestPatternZipf {
+		return nil, fmt.Errorf("unknown traffic pattern: %s", result.Pattern)
+	}
+
+	if result.Edition != "java" && result.Edition != "bedrock" && result.Edition != "mixed" {
+		return nil, fmt.Errorf("unknown edition: %s", result.Edition)
+	}
+
+	return result, nil
+}
+
+// RunLoadTest starts the mock servers and sends status requests for them through the HTTP handlers in-process, without
+// going through the network, until the duration of the test has passed.
+func RunLoadTest(ctx context.Context, opts *LoadTestOptions) (*LoadTestReport, error) {
+	paths, closeServers, err := startMockServers(ctx, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeServers()
+
+	report := &LoadTestReport{
+		StatusCodes: make(map[int]int64),
+		Options:     opts,
+	}
+
+	var memory runtime.MemStats
+
+	runtime.GC()
+	runtime.ReadMemStats(&memory)
+
+	report.Memory.HeapBefore = memory.HeapAlloc
+	report.Memory.HeapPeak = memory.HeapAlloc
+	totalAllocBefore, gcCyclesBefore := memory.TotalAlloc, memory.NumGC
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+
+	defer cancel()
+
+	// Requests either wait for a token of the rate limiter or are sent as fast as the workers can send them
+	var tokens <-chan time.Time
+
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+
+		defer ticker.Stop()
+
+		tokens = ticker.C
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mutex     sync.Mutex
+		latencies []time.Duration = make([]time.Duration, 0)
+		hits      atomic.Int64
+		misses    atomic.Int64
+		failures  atomic.Int64
+	)
+
+	startedAt := time.Now()
+
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+
+		go func(seed int64) {
+			defer wg.Done()
+
+			random := rand.New(rand.NewSource(seed))
+			pick := func() int { return random.Intn(len(paths)) }
+
+			if opts.Pattern == LoadTestPatternZipf && len(paths) > 1 {
+				zipf := rand.NewZipf(random, 1.1, 1, uint64(len(paths)-1))
+				pick = func() int { return int(zipf.Uint64()) }
+			}
+
+			for {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+
+				start := time.Now()
+
+				resp, err := app.Test(httptest.NewRequest("GET", paths[pick()], nil), -1)
+
+				latency := time.Since(start)
+
+				if err != nil {
+					failures.Add(1)
+
+					continue
+				}
+
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+
+				switch resp.Header.Get("X-Cache-Hit") {
+				case "true":
+					hits.Add(1)
+				case "false":
+					misses.Add(1)
+				}
+
+				mutex.Lock()
+				latencies = append(latencies, latency)
+				report.StatusCodes[resp.StatusCode]++
+				mutex.Unlock()
+			}
+		}(int64(i))
+	}
+
+	// The heap is sampled while the test runs, as it is collected before the test ends
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	sampler := time.NewTicker(time.Millisecond * 100)
+
+	defer sampler.Stop()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-sampler.C:
+		}
+
+		runtime.ReadMemStats(&memory)
+
+		report.Memory.HeapPeak = max(report.Memory.HeapPeak, memory.HeapAlloc)
+	}
+
+	report.Duration = time.Since(startedAt)
+	report.Requests = int64(len(latencies))
+	report.Failures = failures.Load()
+	report.Throughput = float64(report.Requests) / report.Duration.Seconds()
+	report.CacheHits = hits.Load()
+	report.CacheMisses = misses.Load()
+	report.Memory.HeapAfter = memory.HeapAlloc
+	report.Memory.TotalAlloc = memory.TotalAlloc - totalAllocBefore
+	report.Memory.GCCycles = memory.NumGC - gcCyclesBefore
+
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+		percentile := func(p float64) time.Duration {
+			return latencies[int(float64(len(latencies)-1)*p)]
+		}
+
+		report.Latency = LoadTestLatency{
+			P50: percentile(0.5),
+			P90: percentile(0.9),
+			P99: percentile(0.99),
+			Max: latencies[len(latencies)-1],
+		}
+	}
+
+	return report, nil
+}
+
+// Print writes the report in a human readable form, or as JSON.
+func (r *LoadTestReport) Print(w io.Writer, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(w)
+
+		encoder.SetIndent("", "\t")
+
+		return encoder.Encode(r)
+	}
+
+	cacheRatio := 0.0
+
+	if total := r.CacheHits + r.CacheMisses; total > 0 {
+		cacheRatio = float64(r.CacheHits) / float64(total) * 100
+	}
+
+	codes := make([]int, 0, len(r.StatusCodes))
+
+	for code := range r.StatusCodes {
+		codes = append(codes, code)
+	}
+
+	sort.Ints(codes)
+
+	fmt.Fprintf(w, "Pattern:     %s over %d %s servers, %d concurrent\n", r.Options.Pattern, r.Options.Servers, r.Options.Edition, r.Options.Concurrency)
+	fmt.Fprintf(w, "Requests:    %d in %s (%d failed)\n", r.Requests, r.Duration.Round(time.Millisecond), r.Failures)
+	fmt.Fprintf(w, "Throughput:  %.1f requests/s\n", r.Throughput)
+	fmt.Fprintf(w, "Latency:     p50 %s, p90 %s, p99 %s, max %s\n", r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+
+	for _, code := range codes {
+		fmt.Fprintf(w, "Status %d:  %d\n", code, r.StatusCodes[code])
+	}
+
+	fmt.Fprintf(w, "Cache:       %d hits, %d misses (%.1f%% hit ratio)\n", r.CacheHits, r.CacheMisses, cacheRatio)
+	fmt.Fprintf(w, "Heap:        %s before, %s after, %s peak\n", formatBytes(r.Memory.HeapBefore), formatBytes(r.Memory.HeapAfter), formatBytes(r.Memory.HeapPeak))
+	fmt.Fprintf(w, "Allocations: %s in %d GC cycles\n", formatBytes(r.Memory.TotalAlloc), r.Memory.GCCycles)
+
+	return nil
+}
+
+// startMockServers starts the mock servers on the loopback interface and returns the request paths of their statuses,
+// along with a function that stops them.
+func startMockServers(ctx context.Context, opts *LoadTestOptions) ([]string, func(), error) {
+	paths := make([]string, 0, opts.Servers)
+	closers := make([]io.Closer, 0, opts.Servers)
+
+	closeAll := func() {
+		for _, closer := range closers {
+			closer.Close()
+		}
+	}
+
+	for i := 0; i < opts.Servers; i++ {
+		edition := opts.Edition
+
+		if edition == "mixed" {
+			edition = []string{"java", "bedrock"}[i%2]
+		}
+
+		var (
+			closer io.Closer
+			port   int
+			err    error
+		)
+
+		switch edition {
+		case "java":
+			closer, port, err = serveMockJavaServer(ctx, i, opts.UpstreamLatency)
+		case "bedrock":
+			closer, port, err = serveMockBedrockServer(ctx, i, opts.UpstreamLatency)
+		}
+
+		if err != nil {
+			closeAll()
+
+			return nil, nil, err
+		}
+
+		path := fmt.Sprintf("/status/%s/127.0.0.1:%d", edition, port)
+
+		// The mock servers do not answer queries, which would otherwise wait for the whole timeout
+		if edition == "java" {
+			path += "?query=false"
+		}
+
+		closers = append(closers, closer)
+		paths = append(paths, path)
+	}
+
+	return paths, closeAll, nil
+}
+
+// serveMockJavaServer starts a server answering Java Edition status and ping requests, the only packets sent by a
+// status lookup.
+func serveMockJavaServer(ctx context.Context, id int, latency time.Duration) (io.Closer, int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	status, err := json.Marshal(map[string]interface{}{
+		"version":     map[string]interface{}{"name": "1.21.1", "protocol": 767},
+		"players":     map[string]interface{}{"online": id % 50, "max": 100},
+		"description": map[string]interface{}{"text": fmt.Sprintf("Load test server #%d", id)},
+	})
+
+	if err != nil {
+		listener.Close()
+
+		return nil, 0, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go handleMockJavaConn(ctx, conn, status, latency)
+		}
+	}()
+
+	return listener, listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func handleMockJavaConn(ctx context.Context, conn net.Conn, status []byte, latency time.Duration) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second * 10))
+
+	reader := bufio.NewReader(conn)
+
+	// Legacy status requests are refused right away, as the status lookup waits for them to finish
+	if first, err := reader.Peek(1); err != nil || first[0] == 0xFE {
+		return
+	}
+
+	// The handshake packet comes first, and only the status state is supported
+	if _, err := readMockPacket(reader); err != nil {
+		return
+	}
+
+	for {
+		packet, err := readMockPacket(reader)
+
+		if err != nil || len(packet) < 1 {
+			return
+		}
+
+		switch packet[0] {
+		case 0x00:
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(latency):
+			}
+
+			body := &bytes.Buffer{}
+
+			body.WriteByte(0x00)
+			body.Write(binary.AppendUvarint(nil, uint64(len(status))))
+			body.Write(status)
+
+			if err = writeMockPacket(conn, body.Bytes()); err != nil {
+				return
+			}
+		case 0x01:
+			writeMockPacket(conn, packet)
+
+			return
+		default:
+			return
+		}
+	}
+}
+
+func readMockPacket(reader *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length > 1<<16 {
+		return nil, errors.New("mock packet is too long")
+	}
+
+	packet := make([]byte, length)
+
+	_, err = io.ReadFull(reader, packet)
+
+	return packet, err
+}
+
+func writeMockPacket(w io.Writer, packet []byte) error {
+	_, err := w.Write(append(binary.AppendUvarint(nil, uint64(len(packet))), packet...))
+
+	return err
+}
+
+// serveMockBedrockServer starts a server answering the RakNet unconnected pings that Bedrock Edition status lookups
+// send.
+func serveMockBedrockServer(ctx context.Context, id int, latency time.Duration) (io.Closer, int, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	serverID := fmt.Sprintf("MCPE;Load test server #%d;712;1.21.20;%d;100;%d;Load test;Survival;1;%d;%d;", id, id%50, id, port, port)
+
+	go func() {
+		data := make([]byte, 1500)
+
+		for {
+			n, addr, err := conn.ReadFrom(data)
+
+			if err != nil {
+				return
+			}
+
+			if n < 33 || data[0] != 0x01 {
+				continue
+			}
+
+			pong := &bytes.Buffer{}
+
+			pong.WriteByte(0x1C)
+			pong.Write(data[1:9])
+			binary.Write(pong, binary.BigEndian, int64(id))
+			pong.Write(raknetMagic)
+			binary.Write(pong, binary.BigEndian, uint16(len(serverID)))
+			pong.WriteString(serverID)
+
+			time.AfterFunc(latency, func() {
+				if ctx.Err() == nil {
+					conn.WriteTo(pong.Bytes(), addr)
+				}
+			})
+		}
+	}()
+
+	return conn, port, nil
+}
+
+func formatBytes(value uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(value)/(1<<20))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	logSubscriberBuffer = 256
+	recentErrorLogs     = 100
+)
+
+var (
+	logs *LogBroadcaster = &LogBroadcaster{
+		Subscribers: make(map[chan LogEvent]struct{}),
+		Mutex:       &sync.RWMutex{},
+	}
+	redactedQueryParameters []string = []string{"token", "signature"}
+)
+
+// LogEvent is a single structured log event streamed to log tail subscribers.
+type LogEvent struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Route   *string   `json:"route"`
+	TraceID *string   `json:"trace_id"`
+	Message string    `json:"message"`
+}
+
+// LogBroadcaster fans out log events to every subscriber, dropping events for subscribers that cannot keep up. The
+// most recent error events are kept for support bundles.
+type LogBroadcaster struct {
+	Subscribers  map[chan LogEvent]struct{}
+	RecentErrors []LogEvent
+	Mutex        *sync.RWMutex
+}
+
+// HasSubscribers returns whether anyone is currently listening for log events.
+func (b *LogBroadcaster) HasSubscribers() bool {
+	b.Mutex.RLock()
+
+	defer b.Mutex.RUnlock()
+
+	return len(b.Subscribers) > 0
+}
+
+// Publish sends the event to every subscriber.
+func (b *LogBroadcaster) Publish(event LogEvent) {
+	b.Mutex.RLock()
+
+	defer b.Mutex.RUnlock()
+
+	for subscriber := range b.Subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving all future log events, and a function that must be called to unsubscribe.
+func (b *LogBroadcaster) Subscribe() (chan LogEvent, func()) {
+	subscriber := make(chan LogEvent, logSubscriberBuffer)
+
+	b.Mutex.Lock()
+	b.Subscribers[subscriber] = struct{}{}
+	b.Mutex.Unlock()
+
+	return subscriber, func() {
+		b.Mutex.Lock()
+		delete(b.Subscribers, subscriber)
+		b.Mutex.Unlock()
+	}
+}
+
+// GetRecentErrors returns the most recent error events, oldest first.
+func (b *LogBroadcaster) GetRecentErrors() []LogEvent {
+	b.Mutex.RLock()
+
+	defer b.Mutex.RUnlock()
+
+	return append(make([]LogEvent, 0, len(b.RecentErrors)), b.RecentErrors...)
+}
+
+// Write allows the broadcaster to be used as an output of the standard logger.
+func (b *LogBroadcaster) Write(p []byte) (int, error) {
+	message := strings.TrimSpace(string(p))
+
+	// Strip the date and time prefix written by the standard logger
+	if fields := strings.SplitN(message, " ", 3); len(fields) == 3 {
+		message = fields[2]
+	}
+
+	event := LogEvent{
+		Time:    time.Now().UTC(),
+		Level:   "info",
+		Route:   nil,
+		TraceID: nil,
+		Message: message,
+	}
+
+	if strings.HasPrefix(message, "Error") || strings.HasPrefix(message, "Failed") {
+		event.Level = "error"
+
+		b.Mutex.Lock()
+		b.RecentErrors = append(b.RecentErrors, event)
+
+		if len(b.RecentErrors) > recentErrorLogs {
+			b.RecentErrors = b.RecentErrors[len(b.RecentErrors)-recentErrorLogs:]
+		}
+
+		b.Mutex.Unlock()
+	}
+
+	if b.HasSubscribers() {
+		b.Publish(event)
+	}
+
+	return len(p), nil
+}
+
+// PublishRequestLogs is a middleware that publishes a log event for every handled request while anyone is tailing
+// the logs.
+func PublishRequestLogs(ctx *fiber.Ctx) error {
+	if !logs.HasSubscribers() {
+		return ctx.Next()
+	}
+
+	start := time.Now()
+	err := ctx.Next()
+
+	level := "info"
+
+	if err != nil || ctx.Response().StatusCode() >= 500 {
+		level = "error"
+	}
+
+	logs.Publish(LogEvent{
+		Time:    start.UTC(),
+		Level:   level,
+		Route:   PointerOf(ctx.Path()),
+		TraceID: GetRequestTraceID(ctx),
+		Message: fmt.Sprintf("%s %s -> %d (%s)", ctx.Method(), RedactedRequestURI(ctx), ctx.Response().StatusCode(), time.Since(start)),
+	})
+
+	return err
+}
+
+// RedactedRequestURI returns the URI of the request with the values of secret query parameters, such as vote tokens
+// and URL signatures, replaced, so that it can be logged.
+func RedactedRequestURI(ctx *fiber.Ctx) string {
+	uri := &fasthttp.URI{}
+
+	ctx.Request().URI().CopyTo(uri)
+
+	args := uri.QueryArgs()
+
+	for _, name := range redactedQueryParameters {
+		if !args.Has(name) {
+			continue
+		}
+
+		args.Del(name)
+		args.Add(name, redactedConfigValue)
+	}
+
+	return string(uri.RequestURI())
+}
+
+// RequireWebSocket is a middleware that only allows WebSocket upgrade requests.
+func RequireWebSocket(ctx *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	return ctx.Next()
+}
+
+// TailLogsHandler streams log events over a WebSocket, optionally filtered by the 'level' and 'route' query
+// parameters. The route filter matches any route starting with the given value.
+var TailLogsHandler = websocket.New(func(conn *websocket.Conn) {
+	level := conn.Query("level")
+	route := conn.Query("route")
+
+	events, unsubscribe := logs.Subscribe()
+
+	defer unsubscribe()
+
+	// Read until the client closes the connection, as no messages are expected from it
+	closed := make(chan struct{})
+
+	go func() {
+		defer close(closed)
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case event := <-events:
+			if len(level) > 0 && event.Level != level {
+				continue
+			}
+
+			if len(route) > 0 && (event.Route == nil || !strings.HasPrefix(*event.Route, route)) {
+				continue
+			}
+
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+})
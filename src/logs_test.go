@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRedactedRequestURI(t *testing.T) {
+	app := fiber.New()
+
+	app.Get("/*", func(ctx *fiber.Ctx) error {
+		return ctx.SendString(RedactedRequestURI(ctx))
+	})
+
+	tests := []struct {
+		URI      string
+		Redacted string
+	}{
+		{"/status/java/example.com", "/status/java/example.com"},
+		{"/vote/votifier/example.com?token=secret&username=test", "/vote/votifier/example.com?username=test&token=REDACTED"},
+		{"/icon/example.com?expires=1&key=a&signature=secret", "/icon/example.com?expires=1&key=a&signature=REDACTED"},
+	}
+
+	for _, test := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", test.URI, nil))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+
+		if string(body) != test.Redacted {
+			t.Errorf("RedactedRequestURI(%s) = %s, expected %s", test.URI, body, test.Redacted)
+		}
+	}
+}
@@ -1,40 +1,66 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	app *fiber.App = fiber.New(fiber.Config{
-		DisableStartupMessage: true,
-		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
-			var fiberError *fiber.Error
+	app        *fiber.App = nil
+	r          *Redis     = &Redis{}
+	db         *MongoDB   = &MongoDB{}
+	config     *Config    = DefaultConfig
+	instanceID uint16     = 0
+)
 
-			if errors.As(err, &fiberError) {
-				return ctx.SendStatus(fiberError.Code)
-			}
+func init() {
+	var (
+		err                  error
+		printEffectiveConfig bool
+	)
 
-			log.Printf("Error: %v - URI: %s\n", err, ctx.Request().URI())
+	log.SetOutput(io.MultiWriter(os.Stderr, logs))
 
-			return ctx.SendStatus(http.StatusInternalServerError)
-		},
-	})
-	r          *Redis   = &Redis{}
-	db         *MongoDB = &MongoDB{}
-	config     *Config  = DefaultConfig
-	instanceID uint16   = 0
-)
+	flag.StringVar(&role, "role", RoleAll, "Role of this process: 'api' only serves requests, 'prober' only probes servers, 'all' does both")
+	flag.BoolVar(&printEffectiveConfig, "print-effective-config", false, "Print the configuration resulting from every layer, with secrets redacted, and exit")
 
-func init() {
-	var err error
+	// Tests have flags of their own and run against the default configuration rather than config.yml
+	if testing.Testing() {
+		initApp()
+
+		return
+	}
+
+	flag.Parse()
+
+	if !IsValidRole(role) {
+		log.Fatalf("Invalid role: %s", role)
+	}
 
-	if err = config.ReadFile("config.yml"); err != nil {
+	if flag.Arg(0) == "loadtest" {
+		if loadTest, err = ParseLoadTestOptions(flag.Args()[1:]); errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		} else if err != nil {
+			log.Fatalf("Invalid load test options: %v", err)
+		}
+	}
+
+	if err = config.Load("config.yml"); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			log.Printf("config.yml does not exist, writing default config\n")
 
@@ -46,44 +72,491 @@ func init() {
 		}
 	}
 
-	if err = GetBlockedServerList(); err != nil {
-		log.Fatalf("Failed to retrieve EULA blocked servers: %v", err)
+	if err = ApplyPerformanceProfile(); err != nil {
+		log.Fatalf("Failed to apply performance profile: %v", err)
 	}
 
-	log.Println("Successfully retrieved EULA blocked servers")
+	if printEffectiveConfig {
+		redacted, err := config.Redacted()
 
-	if config.MongoDB != nil {
-		if err = db.Connect(); err != nil {
-			log.Fatalf("Failed to connect to MongoDB: %v", err)
+		if err != nil {
+			log.Fatalf("Failed to redact config: %v", err)
 		}
 
-		log.Println("Successfully connected to MongoDB")
+		if err = yaml.NewEncoder(os.Stdout).Encode(redacted); err != nil {
+			log.Fatalf("Failed to print config: %v", err)
+		}
+
+		os.Exit(0)
+	}
+
+	initApp()
+
+	lifecycle.Register(&Subsystem{
+		Name:    "blocked-servers",
+		Timeout: time.Second * 30,
+		Start: func(ctx context.Context) error {
+			if err := GetBlockedServerList(); err != nil {
+				return err
+			}
+
+			log.Println("Successfully retrieved EULA blocked servers")
+
+			return nil
+		},
+	})
+
+	lifecycle.Register(&Subsystem{
+		Name:    "storage",
+		Timeout: time.Second * 30,
+		Start: func(ctx context.Context) (err error) {
+			if artifacts, err = NewArtifactStore(ctx); err != nil {
+				return err
+			}
+
+			log.Printf("Successfully initialized %s artifact storage\n", config.Storage.Backend)
+
+			return nil
+		},
+	})
+
+	if config.MongoDB != nil {
+		lifecycle.Register(&Subsystem{
+			Name: "mongodb",
+			Start: func(ctx context.Context) error {
+				if err := db.Connect(); err != nil {
+					return err
+				}
+
+				log.Println("Successfully connected to MongoDB")
+
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				return db.Close()
+			},
+		})
 	}
 
 	if config.Redis != nil {
-		if err = r.Connect(); err != nil {
-			log.Fatalf("Failed to connect to Redis: %v", err)
+		lifecycle.Register(&Subsystem{
+			Name: "redis",
+			Start: func(ctx context.Context) error {
+				if err := r.Connect(); err != nil {
+					return err
+				}
+
+				log.Println("Successfully connected to Redis")
+
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				return r.Close()
+			},
+		})
+
+		lifecycle.Register(&Subsystem{
+			Name:      "local-blocklist",
+			DependsOn: []string{"redis"},
+			Start: func(ctx context.Context) error {
+				return RefreshLocalBlocklist(ctx)
+			},
+			Run: func(ctx context.Context) {
+				SyncLocalBlocklist(ctx, time.Minute)
+			},
+		})
+
+		if config.HotRefresh.Enable {
+			lifecycle.Register(&Subsystem{
+				Name:      "hot-refresh",
+				DependsOn: []string{"redis"},
+				Run: func(ctx context.Context) {
+					SyncHotTargets(ctx, config.HotRefresh.Interval)
+				},
+			})
+		}
+
+		lifecycle.Register(&Subsystem{
+			Name:      "features",
+			DependsOn: []string{"redis"},
+			Start: func(ctx context.Context) error {
+				return RefreshFeatureFlags(ctx)
+			},
+			Run: func(ctx context.Context) {
+				SyncFeatureFlags(ctx, time.Minute)
+			},
+		})
+
+		lifecycle.Register(&Subsystem{
+			Name:      "signing-keys",
+			DependsOn: []string{"redis"},
+			Start: func(ctx context.Context) error {
+				return RefreshSigningKeys(ctx)
+			},
+			Run: func(ctx context.Context) {
+				SyncSigningKeys(ctx, signingKeySyncInterval)
+			},
+		})
+	}
+
+	switch config.Cache.Backend {
+	case CacheBackendRedis:
+		cacheStore = r
+	case CacheBackendMemcached:
+		cacheStore = mc
+
+		lifecycle.Register(&Subsystem{
+			Name: "memcached",
+			Start: func(ctx context.Context) error {
+				if err := mc.Connect(); err != nil {
+					return err
+				}
+
+				log.Println("Successfully connected to Memcached")
+
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				return mc.Close()
+			},
+		})
+	default:
+		log.Fatalf("Invalid cache backend: %s", config.Cache.Backend)
+	}
+
+	if config.Aliases.File != nil {
+		lifecycle.Register(&Subsystem{
+			Name: "aliases",
+			Start: func(ctx context.Context) error {
+				if err := aliases.Load(*config.Aliases.File); err != nil {
+					return err
+				}
+
+				log.Printf("Successfully loaded %d aliases\n", len(aliases.List()))
+
+				return nil
+			},
+			Run: func(ctx context.Context) {
+				aliases.Watch(ctx, *config.Aliases.File, config.Aliases.ReloadInterval)
+			},
+		})
+	}
+
+	translator = NewTranslator()
+
+	if err = LoadColorPalette(config.Formatting.Palette); err != nil {
+		log.Fatalf("Failed to load color palette: %v", err)
+	}
+
+	// The mock servers of the load test listen on the loopback interface, which target protection blocks otherwise
+	if loadTest != nil {
+		config.TargetProtection.AllowedNetworks = append(config.TargetProtection.AllowedNetworks, "127.0.0.1/32")
+	}
+
+	if err = LoadTargetProtection(config.TargetProtection); err != nil {
+		log.Fatalf("Failed to load target protection networks: %v", err)
+	}
+
+	if config.APIKeys.Enable && config.Redis == nil {
+		log.Fatalf("API keys require Redis to be configured")
+	}
+
+	if config.RateLimit.Enable && config.Redis == nil {
+		log.Fatalf("Rate limiting requires Redis to be configured")
+	}
+
+	if config.RateLimit.Enable && (config.RateLimit.RequestsPerMinute < 1 || config.RateLimit.Burst < 1) {
+		log.Fatalf("Rate limiting requires both the requests per minute and the burst to be greater than 0")
+	}
+
+	for _, tenant := range config.Tenants {
+		if tenant.RateLimit != nil && (tenant.RateLimit.RequestsPerMinute < 1 || tenant.RateLimit.Burst < 1) {
+			log.Fatalf("The rate limit of the %s tenant requires both the requests per minute and the burst to be greater than 0", tenant.Name)
 		}
+	}
+
+	// The proxy header could otherwise be set by any client to pick its own IP address
+	if config.RateLimit.ProxyHeader != nil && len(*config.RateLimit.ProxyHeader) > 0 && len(config.RateLimit.TrustedProxies) < 1 {
+		log.Fatalf("Using a proxy header requires the trusted proxies to be configured")
+	}
 
-		log.Println("Successfully connected to Redis")
+	// A larger quorum could never be reached, so the first online re-probe would always decide the result
+	if config.Lookup.OfflineReprobes > 0 && config.Lookup.OfflineQuorum > config.Lookup.OfflineReprobes {
+		log.Fatalf("The offline quorum must not be greater than the number of offline re-probes")
+	}
+
+	if config.HotRefresh.Enable && config.Redis == nil {
+		log.Fatalf("Refreshing hot servers requires Redis to be configured")
+	}
+
+	if err = ValidateExperiments(); err != nil {
+		log.Fatalf("Invalid experiment: %v", err)
+	}
+
+	for i, key := range config.SignedURLs.Keys {
+		if len(key.ID) < 1 || len(key.Secret) < 1 {
+			log.Fatalf("Signing key %d must have an ID and a secret", i)
+		}
+
+		for _, other := range config.SignedURLs.Keys[:i] {
+			if other.ID == key.ID {
+				log.Fatalf("Duplicate signing key ID: %s", key.ID)
+			}
+		}
+	}
+
+	// Every request to the image routes would be rejected until a runtime key is rotated in through the admin API
+	if config.SignedURLs.RequireForImages && config.SignedURLs.Secret == nil && len(config.SignedURLs.Keys) < 1 {
+		log.Fatalf("Requiring signed image URLs requires a signing key to be configured")
+	}
+
+	for edition, name := range config.Shadow.Candidates {
+		if _, ok := shadowCandidates[edition][name]; !ok {
+			log.Fatalf("Invalid shadow lookup candidate for %s: %s", edition, name)
+		}
+	}
+
+	if config.Subscriptions.Enable {
+		lifecycle.Register(&Subsystem{
+			Name: "subscriptions",
+			Run: func(ctx context.Context) {
+				RefreshSubscriptions(ctx, config.Subscriptions.RefreshInterval)
+			},
+		})
+	}
+
+	if config.Analytics.Enable {
+		lifecycle.Register(&Subsystem{
+			Name: "analytics",
+			Start: func(ctx context.Context) error {
+				return analytics.Open(ctx)
+			},
+			Run: func(ctx context.Context) {
+				analytics.Run(ctx, config.Analytics.FlushInterval)
+			},
+			Stop: func(ctx context.Context) error {
+				return analytics.Close(ctx)
+			},
+		})
+	}
+
+	if config.Events.Enable {
+		lifecycle.Register(&Subsystem{
+			Name: "events",
+			Start: func(ctx context.Context) error {
+				if err := events.Connect(); err != nil {
+					return err
+				}
+
+				log.Printf("Publishing status events to %s\n", config.Events.Backend)
+
+				return nil
+			},
+			Run: func(ctx context.Context) {
+				events.Run(ctx)
+			},
+			Stop: func(ctx context.Context) error {
+				return events.Close()
+			},
+		})
+	}
+
+	if config.LANDiscovery.Enable {
+		lifecycle.Register(&Subsystem{
+			Name: "lan-discovery",
+			Start: func(ctx context.Context) error {
+				return lanDiscovery.Listen()
+			},
+			Run: func(ctx context.Context) {
+				lanDiscovery.Run(ctx, config.LANDiscovery.Interval)
+			},
+			Stop: func(ctx context.Context) error {
+				return lanDiscovery.Close()
+			},
+		})
+	}
+
+	if role != RoleAll {
+		if config.Redis == nil {
+			log.Fatalf("The %s role requires Redis to be configured", role)
+		}
+
+		log.Printf("Running with the %s role\n", role)
+	}
+
+	if role == RoleProber {
+		lifecycle.Register(&Subsystem{
+			Name:      "prober",
+			DependsOn: []string{"redis"},
+			Timeout:   config.Prober.QueueTimeout + time.Second*30,
+			Run: func(ctx context.Context) {
+				ProcessProbeQueue(ctx, config.Prober.Workers)
+			},
+		})
 	}
 
 	if instanceID, err = GetInstanceID(); err != nil {
 		panic(err)
 	}
 
+	// The load test sends its requests to the handlers in-process, so it does not serve HTTP requests
+	if loadTest != nil {
+		return
+	}
+
+	listening := make(chan struct{})
+
 	app.Hooks().OnListen(func(ld fiber.ListenData) error {
-		log.Printf("Listening on %s:%d\n", config.Host, config.Port+instanceID)
+		address := net.JoinHostPort(ld.Host, ld.Port)
+
+		close(listening)
+
+		log.Printf("Listening on %s\n", address)
+
+		if err := SystemdNotify("READY=1"); err != nil {
+			log.Printf("Failed to notify systemd: %v\n", err)
+		}
+
+		if interval := SystemdWatchdogInterval(); interval > 0 {
+			go RunSystemdWatchdog(address, interval)
+		}
 
 		return nil
 	})
+
+	// The HTTP server is started last so that requests are only served once every other subsystem is ready
+	dependencies := make([]string, 0, len(lifecycle.Subsystems))
+
+	for _, subsystem := range lifecycle.Subsystems {
+		dependencies = append(dependencies, subsystem.Name)
+	}
+
+	lifecycle.Register(&Subsystem{
+		Name:      "http",
+		DependsOn: dependencies,
+		Timeout:   time.Second * 30,
+		Permanent: true,
+		Start: func(ctx context.Context) error {
+			errs := make(chan error)
+
+			go func() {
+				if err := listen(); err != nil {
+					select {
+					case errs <- err:
+					default:
+						log.Fatalf("HTTP server stopped: %v", err)
+					}
+				}
+			}()
+
+			select {
+			case <-listening:
+				return nil
+			case err := <-errs:
+				return err
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+		Stop: func(ctx context.Context) error {
+			return app.ShutdownWithContext(ctx)
+		},
+	})
+}
+
+// initApp creates the Fiber application with the settings of the loaded configuration.
+func initApp() {
+	jsonEncoder := json.Marshal
+
+	if config.CanonicalJSON {
+		jsonEncoder = MarshalCanonicalJSON
+	}
+
+	proxyHeader := ""
+
+	if config.RateLimit.ProxyHeader != nil {
+		proxyHeader = *config.RateLimit.ProxyHeader
+	}
+
+	app = fiber.New(fiber.Config{
+		DisableStartupMessage:   true,
+		BodyLimit:               int(config.Limits.MaxRequestSize),
+		JSONEncoder:             jsonEncoder,
+		ProxyHeader:             proxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          config.RateLimit.TrustedProxies,
+		EnableIPValidation:      true,
+		ReduceMemoryUsage:       config.Performance.Profile == PerformanceProfileLowMemory,
+		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
+			var fiberError *fiber.Error
+
+			if errors.As(err, &fiberError) {
+				return ctx.SendStatus(fiberError.Code)
+			}
+
+			// Nobody is left to receive the response of a request abandoned by its client
+			if errors.Is(context.Cause(ctx.UserContext()), ErrClientDisconnected) {
+				return nil
+			}
+
+			log.Printf("Error: %v - URI: %s - Trace: %s\n", err, RedactedRequestURI(ctx), FormatTraceID(GetRequestTraceID(ctx)))
+
+			return ctx.SendStatus(http.StatusInternalServerError)
+		},
+	})
 }
 
 func main() {
-	defer r.Close()
-	defer db.Close()
+	if err := lifecycle.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start %v", err)
+	}
 
-	if err := app.Listen(fmt.Sprintf("%s:%d", config.Host, config.Port+instanceID)); err != nil {
-		panic(err)
+	if loadTest != nil {
+		report, err := RunLoadTest(context.Background(), loadTest)
+
+		lifecycle.Stop(context.Background())
+
+		if err != nil {
+			log.Fatalf("Load test failed: %v", err)
+		}
+
+		if err = report.Print(os.Stdout, loadTest.JSON); err != nil {
+			log.Fatalf("Failed to print load test report: %v", err)
+		}
+
+		return
 	}
+
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	<-signals
+
+	log.Println("Shutting down")
+
+	if err := SystemdNotify("STOPPING=1"); err != nil {
+		log.Printf("Failed to notify systemd: %v\n", err)
+	}
+
+	lifecycle.Stop(context.Background())
+}
+
+// listen serves HTTP requests until the server is shut down, preferring the socket passed by systemd socket activation
+// over the configured address.
+func listen() error {
+	listener, err := SystemdListener()
+
+	if err != nil {
+		return err
+	}
+
+	if listener == nil {
+		if listener, err = net.Listen(app.Config().Network, fmt.Sprintf("%s:%d", config.Host, config.Port+instanceID)); err != nil {
+			return err
+		}
+	}
+
+	// Requests notice their client going away through the connections of the listener, see RequestContext
+	return app.Listener(&ClientListener{Listener: listener})
 }
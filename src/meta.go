@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxMetaDescriptionLength = 500
+	maxMetaTags              = 10
+)
+
+var (
+	metaTagRegEx       *regexp.Regexp = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+	discordInviteHosts []string       = []string{"discord.gg", "discord.com", "www.discord.com"}
+)
+
+// ServerMeta is the freeform information attached to a server by its verified owner, returned along with its status.
+type ServerMeta struct {
+	Website     *string  `json:"website"`
+	Discord     *string  `json:"discord"`
+	Description *string  `json:"description"`
+	Tags        []string `json:"tags"`
+	UpdatedAt   int64    `json:"updated_at"`
+}
+
+// GetServerMeta returns the information attached to the server by its owner, or nil if there is none.
+func GetServerMeta(ctx context.Context, edition, hostname string, port uint16) (*ServerMeta, error) {
+	cache, _, err := r.Get(ctx, fmt.Sprintf("meta:%s", GetOwnerKey(edition, hostname, port)))
+
+	if err != nil || cache == nil {
+		return nil, err
+	}
+
+	var result ServerMeta
+
+	if err = json.Unmarshal(cache, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ValidateServerMeta checks the information submitted by an owner and normalizes its tags.
+func ValidateServerMeta(meta *ServerMeta) error {
+	if meta.Website != nil {
+		value, err := url.Parse(*meta.Website)
+
+		if err != nil || (value.Scheme != "http" && value.Scheme != "https") || len(value.Host) < 1 {
+			return errors.New("website must be an HTTP or HTTPS URL")
+		}
+	}
+
+	if meta.Discord != nil {
+		value, err := url.Parse(*meta.Discord)
+
+		if err != nil || value.Scheme != "https" || !Contains(discordInviteHosts, value.Host) {
+			return errors.New("discord must be an HTTPS Discord invite link")
+		}
+	}
+
+	if meta.Description != nil && utf8.RuneCountInString(*meta.Description) > maxMetaDescriptionLength {
+		return fmt.Errorf("description must not be longer than %d characters", maxMetaDescriptionLength)
+	}
+
+	if len(meta.Tags) > maxMetaTags {
+		return fmt.Errorf("there must not be more than %d tags", maxMetaTags)
+	}
+
+	for i, tag := range meta.Tags {
+		meta.Tags[i] = strings.ToLower(strings.TrimSpace(tag))
+
+		if !metaTagRegEx.MatchString(meta.Tags[i]) {
+			return errors.New("tags must be 1 to 32 lowercase letters, digits or hyphens")
+		}
+	}
+
+	return nil
+}
+
+// SetServerMetaHandler replaces the information attached to the server with the JSON object in the request body.
+func SetServerMetaHandler(ctx *fiber.Ctx) error {
+	var body ServerMeta
+
+	if err := ctx.BodyParser(&body); err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Request body must be a JSON object")
+	}
+
+	if err := ValidateServerMeta(&body); err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	if body.Tags == nil {
+		body.Tags = make([]string, 0)
+	}
+
+	body.UpdatedAt = time.Now().UnixMilli()
+
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		return err
+	}
+
+	if err = r.Set(ctx.UserContext(), fmt.Sprintf("meta:%s", GetOwnerKey(ctx.Locals("edition").(string), ctx.Locals("hostname").(string), ctx.Locals("port").(uint16))), data, 0); err != nil {
+		return err
+	}
+
+	return ctx.JSON(body)
+}
+
+// DeleteServerMetaHandler removes the information attached to the server.
+func DeleteServerMetaHandler(ctx *fiber.Ctx) error {
+	if err := r.Delete(ctx.UserContext(), fmt.Sprintf("meta:%s", GetOwnerKey(ctx.Locals("edition").(string), ctx.Locals("hostname").(string), ctx.Locals("port").(uint16)))); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
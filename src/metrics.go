@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	metrics *prometheus.Registry = prometheus.NewRegistry()
+	// sizeBuckets are the histogram buckets used for request and response sizes, from 64 bytes to 1 MiB.
+	sizeBuckets []float64 = prometheus.ExponentialBuckets(64, 4, 8)
+	// requestSizes is the histogram of request body sizes by route and method.
+	requestSizes *prometheus.HistogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_size_bytes",
+		Help:    "Size of request bodies in bytes.",
+		Buckets: sizeBuckets,
+	}, []string{"route", "method"})
+	// responseSizes is the histogram of response body sizes by route and method.
+	responseSizes *prometheus.HistogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "Size of response bodies in bytes.",
+		Buckets: sizeBuckets,
+	}, []string{"route", "method"})
+	// rejectedRequests is the counter of requests rejected for exceeding their body size limit.
+	rejectedRequests *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_too_large_total",
+		Help: "Number of requests rejected because the body exceeded the route limit.",
+	}, []string{"method"})
+	// cacheEntrySizes is the histogram of the sizes of values written to the cache by resource.
+	cacheEntrySizes *prometheus.HistogramVec = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cache_entry_size_bytes",
+		Help:    "Size of values written to the cache in bytes.",
+		Buckets: sizeBuckets,
+	}, []string{"resource"})
+	// protocolPanics is the counter of malformed server responses that crashed a protocol parser.
+	protocolPanics *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "protocol_panics_total",
+		Help: "Number of server responses that caused a protocol parser to panic.",
+	}, []string{"protocol"})
+	// tarpitDetections is the counter of servers detected as tarpits by edition.
+	tarpitDetections *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tarpit_detections_total",
+		Help: "Number of servers detected as tarpits.",
+	}, []string{"edition"})
+	// tarpitSkips is the counter of probes skipped by edition because the server is a detected tarpit.
+	tarpitSkips *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tarpit_skips_total",
+		Help: "Number of probes skipped because the server is a detected tarpit.",
+	}, []string{"edition"})
+	// shadowLookups is the counter of shadow lookups by edition, candidate and whether they matched the primary lookup.
+	shadowLookups *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shadow_lookups_total",
+		Help: "Number of shadow lookups compared with the primary lookup.",
+	}, []string{"edition", "candidate", "outcome"})
+	// shadowDivergences is the counter of properties that differed between a shadow lookup and the primary lookup.
+	shadowDivergences *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shadow_divergences_total",
+		Help: "Number of status properties that differed between a shadow lookup and the primary lookup.",
+	}, []string{"edition", "candidate", "field"})
+	// droppedEvents is the counter of status events that could not be published by reason.
+	droppedEvents *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_dropped_total",
+		Help: "Number of status events that were not published to the event broker.",
+	}, []string{"reason"})
+	// experimentLookups is the counter of lookups of servers assigned to a variant of an experiment, by cache result.
+	experimentLookups *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "experiment_lookups_total",
+		Help: "Number of lookups of servers assigned to an experiment variant, by whether they were served from cache.",
+	}, []string{"experiment", "variant", "resource", "cache"})
+	// experimentProbes is the counter of upstream probes of servers assigned to a variant of an experiment.
+	experimentProbes *prometheus.CounterVec = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "experiment_probes_total",
+		Help: "Number of upstream probes of servers assigned to an experiment variant.",
+	}, []string{"experiment", "variant", "resource"})
+)
+
+const cacheSizesKey = "cache-sizes"
+
+// CacheKeySize is a cached key along with the server it belongs to and the size of its value.
+type CacheKeySize struct {
+	Key    string `json:"key"`
+	Server string `json:"server"`
+	Size   int64  `json:"size"`
+	TTL    int64  `json:"ttl"`
+}
+
+func init() {
+	metrics.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestSizes,
+		responseSizes,
+		rejectedRequests,
+		cacheEntrySizes,
+		protocolPanics,
+		tarpitDetections,
+		tarpitSkips,
+		shadowLookups,
+		shadowDivergences,
+		droppedEvents,
+		experimentLookups,
+		experimentProbes,
+	)
+}
+
+// RecordSizeMetrics is a middleware that observes the request and response body sizes of the matched route.
+func RecordSizeMetrics(ctx *fiber.Ctx) error {
+	err := ctx.Next()
+
+	// The route is read after the handler chain runs so that the label is the route pattern rather than the raw path
+	route := ctx.Route().Path
+
+	// The method is copied as Fiber reuses its underlying buffer once the request is done
+	method := strings.Clone(ctx.Method())
+
+	requestSizes.WithLabelValues(route, method).Observe(float64(len(ctx.Request().Body())))
+	responseSizes.WithLabelValues(route, method).Observe(float64(len(ctx.Response().Body())))
+
+	return err
+}
+
+// LimitRequestSize is a middleware that rejects request bodies larger than the limit configured for the path.
+func LimitRequestSize(ctx *fiber.Ctx) error {
+	limit := GetRequestSizeLimit(ctx.Path())
+
+	size := ctx.Request().Header.ContentLength()
+
+	if bodySize := len(ctx.Request().Body()); bodySize > size {
+		size = bodySize
+	}
+
+	if size > int(limit) {
+		rejectedRequests.WithLabelValues(strings.Clone(ctx.Method())).Inc()
+
+		return ctx.Status(http.StatusRequestEntityTooLarge).SendString(fmt.Sprintf("Request body must not be larger than %d bytes", limit))
+	}
+
+	return ctx.Next()
+}
+
+// GetRequestSizeLimit returns the body size limit of the path, using the longest matching route prefix if any.
+func GetRequestSizeLimit(path string) uint {
+	var (
+		limit   uint = config.Limits.MaxRequestSize
+		longest int  = -1
+	)
+
+	for prefix, value := range config.Limits.RouteRequestSizes {
+		if !strings.HasPrefix(path, prefix) || len(prefix) <= longest {
+			continue
+		}
+
+		limit = value
+		longest = len(prefix)
+	}
+
+	return limit
+}
+
+// RecordCacheEntrySize observes the size of a value written to the cache, and keeps track of it if it is among the
+// largest cached values. The tracked members are the cache key and the server address separated by a space, as cache
+// keys are hashed and would not tell operators which server they belong to.
+func RecordCacheEntrySize(ctx context.Context, key, hostname string, port uint16, size int) {
+	resource, _, _ := strings.Cut(key, ":")
+
+	cacheEntrySizes.WithLabelValues(resource).Observe(float64(size))
+
+	if config.Metrics.LargestCacheKeys < 1 {
+		return
+	}
+
+	if err := r.SortedSetAdd(ctx, cacheSizesKey, fmt.Sprintf("%s %s:%d", key, hostname, port), float64(size), int64(config.Metrics.LargestCacheKeys)); err != nil {
+		log.Printf("Failed to track cache entry size: %v\n", err)
+	}
+}
+
+// GetLargestCacheKeys returns the largest values currently in the cache, removing any that have since expired.
+func GetLargestCacheKeys(ctx context.Context, count int64) ([]CacheKeySize, error) {
+	entries, err := r.SortedSetTop(ctx, cacheSizesKey, count)
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys := Map(entries, func(v SortedSetEntry) string {
+		key, _, _ := strings.Cut(v.Member, " ")
+
+		return key
+	})
+
+	ttls, err := cacheStore.TTLs(ctx, keys...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		result  []CacheKeySize = make([]CacheKeySize, 0, len(entries))
+		expired []string       = make([]string, 0)
+	)
+
+	for i, entry := range entries {
+		// A TTL of -2 means that the key no longer exists
+		if ttls[i] == -2 {
+			expired = append(expired, entry.Member)
+
+			continue
+		}
+
+		_, server, _ := strings.Cut(entry.Member, " ")
+
+		result = append(result, CacheKeySize{
+			Key:    keys[i],
+			Server: server,
+			Size:   int64(entry.Score),
+			TTL:    max(ttls[i].Milliseconds(), 0),
+		})
+	}
+
+	return result, r.SortedSetRemove(ctx, cacheSizesKey, expired...)
+}
+
+// LargestCacheKeysHandler returns the largest values currently in the cache.
+func LargestCacheKeysHandler(ctx *fiber.Ctx) error {
+	if config.Metrics.LargestCacheKeys < 1 {
+		return ctx.SendStatus(http.StatusNotFound)
+	}
+
+	limit := ctx.QueryInt("limit", 25)
+
+	if limit < 1 || limit > int(config.Metrics.LargestCacheKeys) {
+		return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Invalid 'limit' query parameter, must be between 1 and %d", config.Metrics.LargestCacheKeys))
+	}
+
+	result, err := GetLargestCacheKeys(ctx.UserContext(), int64(limit))
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(result)
+}
+
+// MetricsHandler serves the collected metrics in the Prometheus exposition format.
+var MetricsHandler fiber.Handler = adaptor.HTTPHandler(promhttp.HandlerFor(metrics, promhttp.HandlerOpts{}))
@@ -185,6 +185,19 @@ func (c *MongoDB) UpsertRequestLog(query, update bson.M) error {
 	return err
 }
 
+// Ping checks that the primary of the MongoDB deployment can be reached.
+func (c *MongoDB) Ping(ctx context.Context) error {
+	if c.Client == nil {
+		return ErrMongoNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+
+	defer cancel()
+
+	return c.Client.Ping(ctx, nil)
+}
+
 func (c *MongoDB) Close() error {
 	if c.Client == nil {
 		return nil
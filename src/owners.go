@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	ownerChallengeDuration = time.Hour
+	ownerChallengePrefix   = "mcstatus-verify-"
+)
+
+var (
+	ErrOwnerChallengeMissing  error = errors.New("no verification challenge was requested for this server, or it has expired")
+	ErrOwnerChallengeNotFound error = errors.New("the verification code was not found in the MOTD of the server")
+)
+
+// PrivacyNotice is returned instead of the status of a server whose owner has opted out of public lookups.
+type PrivacyNotice struct {
+	Host     string `json:"host"`
+	Port     uint16 `json:"port"`
+	OptedOut bool   `json:"opted_out"`
+	Message  string `json:"message"`
+}
+
+// OwnerChallenge is the code an owner has to place in the MOTD of their server to prove ownership.
+type OwnerChallenge struct {
+	Code      string `json:"code"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// OwnerToken is the token handed out to verified owners, used for every owner-only route.
+type OwnerToken struct {
+	Token string `json:"token"`
+}
+
+// GetOwnerKey returns the key identifying a server for owner related data.
+func GetOwnerKey(edition, hostname string, port uint16) string {
+	return fmt.Sprintf("%s:%s", edition, GetCacheKey(hostname, port, nil))
+}
+
+// CreateOwnerChallenge generates a new verification code for the server.
+func CreateOwnerChallenge(ctx context.Context, edition, hostname string, port uint16) (*OwnerChallenge, error) {
+	challenge := &OwnerChallenge{
+		Code:      ownerChallengePrefix + RandomHexString(8),
+		ExpiresAt: time.Now().Add(ownerChallengeDuration).UnixMilli(),
+	}
+
+	return challenge, r.Set(ctx, fmt.Sprintf("owner-challenge:%s", GetOwnerKey(edition, hostname, port)), challenge.Code, ownerChallengeDuration)
+}
+
+// ConfirmOwnerChallenge fetches a fresh status of the server and, if its MOTD contains the verification code, issues
+// a new owner token that replaces any previously issued token.
+func ConfirmOwnerChallenge(ctx context.Context, edition, hostname string, port uint16) (*OwnerToken, error) {
+	ownerKey := GetOwnerKey(edition, hostname, port)
+
+	code, _, err := r.Get(ctx, fmt.Sprintf("owner-challenge:%s", ownerKey))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if code == nil {
+		return nil, ErrOwnerChallengeMissing
+	}
+
+	// Owners of servers that opted out may still verify, as they need a token to opt back in
+	if err = CheckTarget(ctx, nil, edition, hostname, port, edition == "java"); err != nil && !errors.Is(err, ErrTargetOptedOut) {
+		return nil, err
+	}
+
+	opts := &StatusOptions{
+		Query:             false,
+		Timeout:           time.Second * 5,
+		Trigger:           "owner-verification",
+		SkipProbeInterval: true,
+	}
+
+	var motd string
+
+	switch edition {
+	case "java":
+		response, err := FetchJavaStatus(ctx, hostname, port, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if response.JavaStatus != nil {
+			motd = response.MOTD.Clean
+		}
+	case "bedrock":
+		response, err := FetchBedrockStatus(ctx, hostname, port, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if response.BedrockStatus != nil && response.MOTD != nil {
+			motd = response.MOTD.Clean
+		}
+	}
+
+	if !strings.Contains(motd, string(code)) {
+		return nil, ErrOwnerChallengeNotFound
+	}
+
+	token := &OwnerToken{
+		Token: RandomHexString(24),
+	}
+
+	if err = r.Set(ctx, fmt.Sprintf("owner-token:%s", ownerKey), SHA256(token.Token), 0); err != nil {
+		return nil, err
+	}
+
+	return token, r.Delete(ctx, fmt.Sprintf("owner-challenge:%s", ownerKey))
+}
+
+// IsVerifiedOwner checks whether the token was issued to the owner of the server.
+func IsVerifiedOwner(ctx context.Context, edition, hostname string, port uint16, token string) (bool, error) {
+	if len(token) < 1 {
+		return false, nil
+	}
+
+	value, _, err := r.Get(ctx, fmt.Sprintf("owner-token:%s", GetOwnerKey(edition, hostname, port)))
+
+	if err != nil || value == nil {
+		return false, err
+	}
+
+	return string(value) == SHA256(token), nil
+}
+
+// IsOptedOut checks whether the owner of the server has opted out of public lookups.
+func IsOptedOut(ctx context.Context, edition, hostname string, port uint16) (bool, error) {
+	value, _, err := r.Get(ctx, fmt.Sprintf("opt-out:%s", GetOwnerKey(edition, hostname, port)))
+
+	return value != nil, err
+}
+
+// SendPrivacyNotice responds with the notice returned instead of the status of an opted-out server. The notice is
+// tagged like the status, so that it is purged once the owner opts back in.
+func SendPrivacyNotice(ctx *fiber.Ctx, hostname string, port uint16) error {
+	SetSurrogateKey(ctx, hostname)
+
+	return ctx.JSON(PrivacyNotice{
+		Host:     hostname,
+		Port:     port,
+		OptedOut: true,
+		Message:  "The owner of this server has opted out of public status lookups",
+	})
+}
+
+// RequireRedis is a middleware that rejects requests to routes that cannot work without Redis.
+func RequireRedis(ctx *fiber.Ctx) error {
+	if r.Client == nil {
+		return ctx.Status(http.StatusServiceUnavailable).SendString("This feature requires Redis to be configured")
+	}
+
+	return ctx.Next()
+}
+
+// RequireOwner is a middleware that only allows requests carrying an owner token issued for the server in the
+// edition and address parameters. Every route it guards changes how the server is shown, so the responses about the
+// server cached by CDNs are purged once the change succeeded.
+func RequireOwner(ctx *fiber.Ctx) error {
+	edition, hostname, port, err := parseOwnerTarget(ctx)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	verified, err := IsVerifiedOwner(ctx.UserContext(), edition, hostname, port, ctx.Get("X-Owner-Token"))
+
+	if err != nil {
+		return err
+	}
+
+	if !verified {
+		return ctx.Status(http.StatusUnauthorized).SendString("Missing or invalid 'X-Owner-Token' header")
+	}
+
+	ctx.Locals("edition", edition)
+	ctx.Locals("hostname", hostname)
+	ctx.Locals("port", port)
+
+	if err = ctx.Next(); err != nil || ctx.Response().StatusCode() >= http.StatusBadRequest {
+		return err
+	}
+
+	// The change was already made, so failing to purge it from the CDNs does not fail the request
+	if err = PurgeSurrogateKey(ctx.UserContext(), GetSurrogateKey(hostname)); err != nil {
+		log.Printf("Failed to purge the responses about %s: %v\n", hostname, err)
+	}
+
+	return nil
+}
+
+// CreateOwnerChallengeHandler returns a verification code that has to be placed in the MOTD of the server.
+func CreateOwnerChallengeHandler(ctx *fiber.Ctx) error {
+	edition, hostname, port, err := parseOwnerTarget(ctx)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	challenge, err := CreateOwnerChallenge(ctx.UserContext(), edition, hostname, port)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(challenge)
+}
+
+// ConfirmOwnerChallengeHandler verifies that the code is present in the MOTD and returns an owner token.
+func ConfirmOwnerChallengeHandler(ctx *fiber.Ctx) error {
+	edition, hostname, port, err := parseOwnerTarget(ctx)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	token, err := ConfirmOwnerChallenge(ctx.UserContext(), edition, hostname, port)
+
+	if err != nil {
+		if errors.Is(err, ErrOwnerChallengeMissing) || errors.Is(err, ErrOwnerChallengeNotFound) {
+			return ctx.Status(http.StatusForbidden).SendString(err.Error())
+		}
+
+		return SendTargetError(ctx, err, hostname, port)
+	}
+
+	return ctx.JSON(token)
+}
+
+// OptOutHandler opts the server out of public lookups on every instance.
+func OptOutHandler(ctx *fiber.Ctx) error {
+	if err := r.Set(ctx.UserContext(), fmt.Sprintf("opt-out:%s", GetOwnerKey(ctx.Locals("edition").(string), ctx.Locals("hostname").(string), ctx.Locals("port").(uint16))), 1, 0); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// OptInHandler allows public lookups of the server again.
+func OptInHandler(ctx *fiber.Ctx) error {
+	if err := r.Delete(ctx.UserContext(), fmt.Sprintf("opt-out:%s", GetOwnerKey(ctx.Locals("edition").(string), ctx.Locals("hostname").(string), ctx.Locals("port").(uint16)))); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+func parseOwnerTarget(ctx *fiber.Ctx) (string, string, uint16, error) {
+	edition := ctx.Params("edition")
+
+	if edition != "java" && edition != "bedrock" {
+		return "", "", 0, fmt.Errorf("unknown edition: %s", edition)
+	}
+
+	hostname, port, _, err := ParseTargetAddress(strings.ToLower(ctx.Params("address")), edition)
+
+	if err != nil {
+		return "", "", 0, errors.New("invalid address value")
+	}
+
+	return edition, hostname, port, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+)
+
+const (
+	// PerformanceProfileDefault leaves every limit as configured.
+	PerformanceProfileDefault = "default"
+	// PerformanceProfileLowMemory lowers the limits that drive memory usage so that the process runs comfortably on
+	// single-board computers with little memory.
+	PerformanceProfileLowMemory = "low_memory"
+
+	lowMemoryWorkers        = 2
+	lowMemoryQueueLength    = 100
+	lowMemoryEventQueueSize = 1000
+	lowMemoryGraphQLLookups = 4
+	lowMemoryGCPercent      = 50
+	lowMemoryLimit          = 192 << 20
+	lowMemoryPlayerList     = 12
+)
+
+// ApplyPerformanceProfile lowers the limits of the configuration to those of the configured performance profile, then
+// applies the garbage collector settings. It must be called before any subsystem reads the limits.
+func ApplyPerformanceProfile() error {
+	performance := &config.Performance
+
+	switch performance.Profile {
+	case PerformanceProfileDefault:
+	case PerformanceProfileLowMemory:
+		config.Prober.Workers = min(config.Prober.Workers, lowMemoryWorkers)
+		config.Prober.MaxQueueLength = min(config.Prober.MaxQueueLength, lowMemoryQueueLength)
+		config.HotRefresh.Workers = min(config.HotRefresh.Workers, lowMemoryWorkers)
+		config.Events.QueueSize = min(config.Events.QueueSize, lowMemoryEventQueueSize)
+		config.GraphQL.MaxLookups = min(config.GraphQL.MaxLookups, lowMemoryGraphQLLookups)
+
+		if performance.GCPercent == nil {
+			performance.GCPercent = PointerOf(lowMemoryGCPercent)
+		}
+
+		if performance.MemoryLimit == nil {
+			performance.MemoryLimit = PointerOf(int64(lowMemoryLimit))
+		}
+
+		if performance.MaxPlayerList == 0 {
+			performance.MaxPlayerList = lowMemoryPlayerList
+		}
+	default:
+		return fmt.Errorf("invalid performance profile: %s", performance.Profile)
+	}
+
+	// The environment variables are read by the runtime itself, and take precedence so that they can be tuned per host
+	if _, ok := os.LookupEnv("GOGC"); !ok && performance.GCPercent != nil {
+		debug.SetGCPercent(*performance.GCPercent)
+	}
+
+	if _, ok := os.LookupEnv("GOMEMLIMIT"); !ok && performance.MemoryLimit != nil {
+		debug.SetMemoryLimit(*performance.MemoryLimit)
+	}
+
+	if performance.Profile != PerformanceProfileDefault {
+		log.Printf("Applied the %s performance profile\n", performance.Profile)
+	}
+
+	return nil
+}
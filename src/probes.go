@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	probeGroup        *singleflight.Group     = &singleflight.Group{}
+	sharedProbes      map[string]*sharedProbe = make(map[string]*sharedProbe)
+	sharedProbesMutex *sync.Mutex             = &sync.Mutex{}
+)
+
+// sharedProbe is the context of a probe shared by concurrent callers, which is cancelled once none of them is waiting
+// for the probe anymore.
+type sharedProbe struct {
+	Context context.Context
+	Cancel  context.CancelFunc
+	Callers int
+}
+
+// CoordinateProbe merges concurrent probes of the same target into a single probe whose result is shared by every
+// caller, and reuses the most recent result for any probe requested within the minimum probe interval, regardless of
+// which route, subsystem or instance triggered it. Setting skipInterval forces a fresh probe that is still merged
+// with concurrent callers.
+func CoordinateProbe[T any](ctx context.Context, edition, key string, skipInterval bool, probe func(context.Context) (*T, error)) (*T, error) {
+	cacheKey := fmt.Sprintf("%s-probe:%s", edition, key)
+
+	groupKey := cacheKey
+
+	if skipInterval {
+		groupKey = fmt.Sprintf("%s:fresh", cacheKey)
+	}
+
+	// The probe is shared by every caller, so it must not be cancelled just because the first caller went away. Each
+	// caller still stops waiting as soon as its own context is done, and the probe is cancelled once all of them did.
+	shared, leave := joinSharedProbe(ctx, groupKey)
+
+	defer leave()
+
+	call := probeGroup.DoChan(groupKey, func() (interface{}, error) {
+		ctx := shared
+
+		if config.Lookup.MinProbeInterval > 0 && !skipInterval {
+			cache, _, err := cacheStore.Get(ctx, cacheKey)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if cache != nil {
+				var result T
+
+				if err = json.Unmarshal(cache, &result); err != nil {
+					return nil, err
+				}
+
+				return &result, nil
+			}
+		}
+
+		result, err := probe(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if config.Lookup.MinProbeInterval > 0 {
+			data, err := json.Marshal(result)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err = cacheStore.Set(ctx, cacheKey, data, config.Lookup.MinProbeInterval); err != nil {
+				return nil, err
+			}
+		}
+
+		return result, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case value := <-call:
+		if value.Err != nil {
+			return nil, value.Err
+		}
+
+		return value.Val.(*T), nil
+	}
+}
+
+// joinSharedProbe returns the context of the probe shared by the callers of the group, along with the function that
+// the caller must call once it stops waiting for the probe.
+func joinSharedProbe(ctx context.Context, groupKey string) (context.Context, func()) {
+	sharedProbesMutex.Lock()
+
+	defer sharedProbesMutex.Unlock()
+
+	probe, ok := sharedProbes[groupKey]
+
+	if !ok {
+		c, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+		probe = &sharedProbe{
+			Context: c,
+			Cancel:  cancel,
+		}
+
+		sharedProbes[groupKey] = probe
+	}
+
+	probe.Callers++
+
+	return probe.Context, func() {
+		sharedProbesMutex.Lock()
+
+		defer sharedProbesMutex.Unlock()
+
+		if probe.Callers--; probe.Callers > 0 {
+			return
+		}
+
+		probe.Cancel()
+
+		delete(sharedProbes, groupKey)
+
+		// A cancelled probe that is still running must not be joined by the callers that come after
+		probeGroup.Forget(groupKey)
+	}
+}
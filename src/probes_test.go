@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCoordinateProbeCancellation(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+
+	probe := func(ctx context.Context) (*string, error) {
+		close(started)
+
+		<-ctx.Done()
+
+		close(cancelled)
+
+		return nil, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+
+	defer cancelFirst()
+	defer cancelSecond()
+
+	errs := make(chan error, 2)
+
+	go func() {
+		_, err := CoordinateProbe(first, "java", "cancellation", true, probe)
+
+		errs <- err
+	}()
+
+	<-started
+
+	go func() {
+		_, err := CoordinateProbe(second, "java", "cancellation", true, probe)
+
+		errs <- err
+	}()
+
+	// The probe goes on as long as any caller is still waiting for it
+	time.Sleep(time.Millisecond * 50)
+
+	cancelFirst()
+
+	<-errs
+
+	select {
+	case <-cancelled:
+		t.Fatal("the probe was cancelled while a caller was still waiting for it")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	cancelSecond()
+
+	<-errs
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the probe to be cancelled once every caller left")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// ProtocolError is returned instead of a panic when a response sent by a server crashes one of the protocol parsers.
+type ProtocolError struct {
+	Protocol string
+	Host     string
+	Port     uint16
+	Panic    interface{}
+}
+
+// Error returns the description of the error.
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("%s: malformed response from %s:%d: %v", e.Protocol, e.Host, e.Port, e.Panic)
+}
+
+// RecoverProtocol calls the protocol function and converts any panic into a ProtocolError. Probes run in their own
+// goroutines, out of reach of the recover middleware, so a hostile server would otherwise crash the whole process.
+func RecoverProtocol[T any](protocol, hostname string, port uint16, fn func() (*T, error)) (result *T, err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			result = nil
+			err = &ProtocolError{
+				Protocol: protocol,
+				Host:     hostname,
+				Port:     port,
+				Panic:    value,
+			}
+
+			protocolPanics.WithLabelValues(protocol).Inc()
+
+			log.Printf("Recovered from panic: %v\n%s", err, debug.Stack())
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mcstatus-io/mcutil/v4/options"
+	"github.com/mcstatus-io/mcutil/v4/proto"
+	"github.com/mcstatus-io/mcutil/v4/response"
+	"github.com/mcstatus-io/mcutil/v4/status"
+)
+
+// allowLoopbackTargets lets the target dialer connect to the fake servers of the test on the loopback interface.
+func allowLoopbackTargets(tb testing.TB) {
+	allowedNetworks, _ = parseNetworks([]string{"127.0.0.0/8", "::1"})
+
+	tb.Cleanup(func() {
+		allowedNetworks = nil
+	})
+}
+
+// newJavaPacket returns the packet with the ID and data, prefixed with its length.
+func newJavaPacket(tb testing.TB, id int32, data []byte) []byte {
+	body := &bytes.Buffer{}
+
+	if err := proto.WriteVarInt(id, body); err != nil {
+		tb.Fatal(err)
+	}
+
+	body.Write(data)
+
+	result := &bytes.Buffer{}
+
+	if err := proto.WriteVarInt(int32(body.Len()), result); err != nil {
+		tb.Fatal(err)
+	}
+
+	result.Write(body.Bytes())
+
+	return result.Bytes()
+}
+
+// newJavaStatusPacket returns the status response packet holding the status document.
+func newJavaStatusPacket(tb testing.TB, document string) []byte {
+	data := &bytes.Buffer{}
+
+	if err := proto.WriteString(document, data); err != nil {
+		tb.Fatal(err)
+	}
+
+	return newJavaPacket(tb, 0x00, data.Bytes())
+}
+
+// newUnconnectedPong returns the RakNet unconnected pong packet holding the server ID.
+func newUnconnectedPong(serverID string) []byte {
+	buf := &bytes.Buffer{}
+
+	buf.WriteByte(0x1C)
+	binary.Write(buf, binary.BigEndian, time.Now().UnixMilli())
+	binary.Write(buf, binary.BigEndian, int64(0x0102030405060708))
+	buf.Write(raknetMagic)
+	binary.Write(buf, binary.BigEndian, uint16(len(serverID)))
+	buf.WriteString(serverID)
+
+	return buf.Bytes()
+}
+
+// serveTCP accepts connections on a loopback listener until the test ends, reading the request of each client and
+// answering it with the next response of the channel before closing its side of the connection. It returns the port
+// of the listener.
+func serveTCP(tb testing.TB, readRequest func(io.Reader) error, responses <-chan []byte) uint16 {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			serveResponse(conn, readRequest, <-responses)
+		}
+	}()
+
+	return uint16(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// serveResponse reads the request of the client and answers it with the response, then closes the connection once the
+// client is done with it.
+func serveResponse(conn net.Conn, readRequest func(io.Reader) error, response []byte) {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second * 5))
+
+	if err := readRequest(conn); err != nil {
+		return
+	}
+
+	conn.Write(response)
+
+	// Closing the write side lets the client read the whole response before seeing the end of the stream
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+
+		io.Copy(io.Discard, conn)
+	}
+}
+
+// readJavaStatusRequest reads the handshake and status request packets of a Java Edition status lookup.
+func readJavaStatusRequest(r io.Reader) error {
+	reader := bufio.NewReader(r)
+
+	for i := 0; i < 2; i++ {
+		if _, err := ReadJavaPacket(reader); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readLegacyStatusRequest reads the two bytes of a legacy status request.
+func readLegacyStatusRequest(r io.Reader) error {
+	_, err := io.ReadFull(r, make([]byte, 2))
+
+	return err
+}
+
+func FuzzJavaStatus(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		client, server := net.Pipe()
+
+		defer client.Close()
+
+		go serveResponse(server, readJavaStatusRequest, data)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+		defer cancel()
+
+		result, raw, err := pingJavaConn(ctx, client, "localhost", 25565)
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal("the lookup did not finish once the server closed the connection")
+		}
+
+		// The fake server never answers the ping, so even a status that parses has to end with the error of the pong
+		if err == nil || result != nil {
+			t.Fatalf("expected an error without a pong, got %+v and %v", result, err)
+		}
+
+		if raw != nil && !bytes.Contains(data, raw) {
+			t.Fatal("the raw status is not part of the response")
+		}
+	})
+}
+
+func FuzzLegacyStatus(f *testing.F) {
+	responses := make(chan []byte)
+	port := serveTCP(f, readLegacyStatusRequest, responses)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+		defer cancel()
+
+		go func() {
+			select {
+			case responses <- data:
+			case <-ctx.Done():
+			}
+		}()
+
+		result, err := RecoverProtocol("legacy_status", "127.0.0.1", port, func() (*response.StatusLegacy, error) {
+			return status.Legacy(ctx, "127.0.0.1", port, options.StatusLegacy{
+				EnableSRV:       false,
+				Timeout:         time.Second * 5,
+				ProtocolVersion: -1,
+			})
+		})
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			t.Fatal("the lookup did not finish once the server closed the connection")
+		}
+
+		if (result == nil) == (err == nil) {
+			t.Fatalf("expected either a status or an error, got %v and %v", result, err)
+		}
+	})
+}
+
+func FuzzBedrockPong(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > maxUnconnectedPongSize {
+			t.Skip()
+		}
+
+		client, server := net.Pipe()
+
+		defer client.Close()
+
+		// Every write on a pipe is read as a whole like a datagram. The fuzzed packet is followed by a valid pong, which the
+		// client has to reach if it skips the fuzzed packet.
+		go func() {
+			defer server.Close()
+
+			if _, err := server.Read(make([]byte, 64)); err != nil {
+				return
+			}
+
+			if _, err := server.Write(data); err != nil {
+				return
+			}
+
+			server.Write(newUnconnectedPong("MCPE;Fallback;0;1.0;0;10;1;Fallback;Survival;1;19132;19133;"))
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+
+		defer cancel()
+
+		result, err := pingBedrockConn(ctx, client)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result == nil {
+			t.Fatal("expected a status")
+		}
+	})
+}
+
+func TestPingJava(t *testing.T) {
+	allowLoopbackTargets(t)
+
+	document := `{"version":{"name":"1.21","protocol":767},"players":{"max":20,"online":1,"sample":[{"id":"069a79f4-44e9-4726-a5be-fca90e38aaf5","name":"Notch"}]},"description":{"text":"A Minecraft Server"}}`
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+
+		if err = readJavaStatusRequest(reader); err != nil {
+			return
+		}
+
+		conn.Write(newJavaStatusPacket(t, document))
+
+		// The pong echoes the payload of the ping
+		ping, err := ReadJavaPacket(reader)
+
+		if err != nil {
+			return
+		}
+
+		conn.Write(newJavaPacket(t, 0x01, ping[1:]))
+	}()
+
+	result, raw, err := PingJava(context.Background(), "localhost", 25565, listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(raw) != document {
+		t.Errorf("expected the raw status document, got %s", raw)
+	}
+
+	if result.Version.Protocol != 767 || *result.Players.Online != 1 || result.MOTD.Clean != "A Minecraft Server" {
+		t.Errorf("unexpected status: %+v", result)
+	}
+}
+
+func TestReadJavaPacket(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Data   []byte
+		Packet []byte
+		Err    error
+	}{
+		{"packet", []byte{0x02, 0x00, 0x01}, []byte{0x00, 0x01}, nil},
+		{"empty packet", []byte{0x00}, nil, ErrInvalidJavaPacket},
+		{"oversized packet", []byte{0xFF, 0xFF, 0xFF, 0x7F}, nil, ErrInvalidJavaPacket},
+		{"truncated packet", []byte{0x05, 0x00}, nil, io.ErrUnexpectedEOF},
+		{"no data", nil, nil, io.EOF},
+	}
+
+	for _, test := range tests {
+		packet, err := ReadJavaPacket(bytes.NewReader(test.Data))
+
+		if !errors.Is(err, test.Err) {
+			t.Errorf("%s: expected error %v, got %v", test.Name, test.Err, err)
+		}
+
+		if !bytes.Equal(packet, test.Packet) {
+			t.Errorf("%s: expected packet %X, got %X", test.Name, test.Packet, packet)
+		}
+	}
+}
+
+func TestParseJavaStatusPacket(t *testing.T) {
+	valid := newJavaStatusPacket(t, `{}`)
+
+	tests := []struct {
+		Name   string
+		Packet []byte
+		Status string
+		Err    bool
+	}{
+		{"status", valid[1:], `{}`, false},
+		{"wrong packet ID", []byte{0x01, 0x02, '{', '}'}, "", true},
+		{"status longer than packet", []byte{0x00, 0x10, '{', '}'}, "", true},
+		{"negative status length", []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F}, "", true},
+		{"no status length", []byte{0x00}, "", true},
+		{"empty", nil, "", true},
+	}
+
+	for _, test := range tests {
+		status, err := ParseJavaStatusPacket(test.Packet)
+
+		if (err != nil) != test.Err {
+			t.Errorf("%s: unexpected error %v", test.Name, err)
+		}
+
+		if string(status) != test.Status {
+			t.Errorf("%s: expected status %q, got %q", test.Name, test.Status, status)
+		}
+	}
+}
+
+func TestParseJavaPongPacket(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Packet  []byte
+		Payload int64
+		Err     bool
+	}{
+		{"pong", NewJavaPingRequest(42)[1:], 42, false},
+		{"wrong payload", NewJavaPingRequest(42)[1:], 43, true},
+		{"wrong packet ID", append([]byte{0x02}, NewJavaPingRequest(42)[2:]...), 42, true},
+		{"truncated", NewJavaPingRequest(42)[1:5], 42, true},
+		{"empty", nil, 42, true},
+	}
+
+	for _, test := range tests {
+		if err := ParseJavaPongPacket(test.Packet, test.Payload); (err != nil) != test.Err {
+			t.Errorf("%s: unexpected error %v", test.Name, err)
+		}
+	}
+}
+
+func TestParseJavaStatus(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Document string
+		Err      bool
+		Check    func(*response.StatusModern) bool
+	}{
+		{
+			"vanilla",
+			`{"version":{"name":"1.21","protocol":767},"players":{"max":20,"online":0},"description":"§aHello"}`,
+			false,
+			func(s *response.StatusModern) bool {
+				return s.Version.Name.Clean == "1.21" && *s.Players.Max == 20 && s.MOTD.Clean == "Hello" && s.Mods == nil
+			},
+		},
+		{
+			"integer array player ID",
+			`{"version":{"name":"1.21","protocol":767},"players":{"max":1,"online":1,"sample":[{"id":[1,2,3,-1],"name":"Player"}]},"description":""}`,
+			false,
+			func(s *response.StatusModern) bool {
+				return s.Players.Sample[0].ID == "000000010000000200000003ffffffff"
+			},
+		},
+		{
+			"forge mods",
+			`{"version":{"name":"1.20.1","protocol":763},"players":{"max":1,"online":0},"description":"","forgeData":{"mods":[{"modId":"forge","modmarker":"47.1.0"}]}}`,
+			false,
+			func(s *response.StatusModern) bool {
+				return s.Mods != nil && s.Mods.Type == "FML2" && s.Mods.List[0].ID == "forge"
+			},
+		},
+		{
+			"legacy forge mods",
+			`{"version":{"name":"1.12.2","protocol":340},"players":{"max":1,"online":0},"description":"","modinfo":{"type":"FML","modList":[{"modid":"mcp","version":"9.42"}]}}`,
+			false,
+			func(s *response.StatusModern) bool {
+				return s.Mods != nil && s.Mods.Type == "FML" && s.Mods.List[0].Version == "9.42"
+			},
+		},
+		{"missing players", `{"version":{"name":"1.21","protocol":767},"description":""}`, false, func(s *response.StatusModern) bool {
+			return s.Players.Online == nil && s.Players.Max == nil
+		}},
+		{"invalid player ID", `{"players":{"sample":[{"id":[1,2],"name":"Player"}]}}`, true, nil},
+		{"player ID of the wrong type", `{"players":{"sample":[{"id":true,"name":"Player"}]}}`, true, nil},
+		{"invalid JSON", `{"version":`, true, nil},
+		{"not an object", `[]`, true, nil},
+	}
+
+	for _, test := range tests {
+		status, err := ParseJavaStatus([]byte(test.Document))
+
+		if (err != nil) != test.Err {
+			t.Errorf("%s: unexpected error %v", test.Name, err)
+
+			continue
+		}
+
+		if test.Check != nil && !test.Check(status) {
+			t.Errorf("%s: unexpected status %+v", test.Name, status)
+		}
+	}
+}
+
+func TestParseUnconnectedPong(t *testing.T) {
+	valid := newUnconnectedPong("MCPE;§bBedrock;712;1.21.2;3;10;123456;Second line;Survival;1;19132;19133;")
+
+	tests := []struct {
+		Name  string
+		Data  []byte
+		Err   bool
+		Check func(*response.StatusBedrock) bool
+	}{
+		{"pong", valid, false, func(s *response.StatusBedrock) bool {
+			return *s.Edition == "MCPE" && *s.ProtocolVersion == 712 && *s.OnlinePlayers == 3 && *s.MaxPlayers == 10 &&
+				*s.GamemodeID == 1 && *s.PortIPv4 == 19132 && *s.PortIPv6 == 19133 && s.ServerGUID == 0x0102030405060708 &&
+				s.MOTD.Clean == "Bedrock\nSecond line"
+		}},
+		{"truncated server ID", newUnconnectedPong("MCPE;Bedrock;712"), false, func(s *response.StatusBedrock) bool {
+			return *s.ProtocolVersion == 712 && s.Version == nil && s.OnlinePlayers == nil
+		}},
+		{"fields that are not numbers", newUnconnectedPong("MCPE;Bedrock;new;1.21;some;many;"), false, func(s *response.StatusBedrock) bool {
+			return s.ProtocolVersion == nil && s.OnlinePlayers == nil && s.MaxPlayers == nil && *s.Version == "1.21"
+		}},
+		{"server ID longer than its length", append(newUnconnectedPong("MCPE"), []byte(";Extra")...), false, func(s *response.StatusBedrock) bool {
+			return *s.Edition == "MCPE" && s.MOTD == nil
+		}},
+		{"server ID shorter than its length", valid[:40], false, nil},
+		{"wrong packet ID", append([]byte{0x1D}, valid[1:]...), true, nil},
+		{"wrong magic", append(append(append([]byte{}, valid[:17]...), make([]byte, 16)...), valid[33:]...), true, nil},
+		{"too short", valid[:34], true, nil},
+		{"empty", nil, true, nil},
+	}
+
+	for _, test := range tests {
+		status, err := ParseUnconnectedPong(test.Data)
+
+		if (err != nil) != test.Err {
+			t.Errorf("%s: unexpected error %v", test.Name, err)
+
+			continue
+		}
+
+		if test.Check != nil && !test.Check(status) {
+			t.Errorf("%s: unexpected status %+v", test.Name, status)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mcstatus-io/mcutil/v4/formatting"
+	"github.com/mcstatus-io/mcutil/v4/options"
+	"github.com/mcstatus-io/mcutil/v4/query"
+	"github.com/mcstatus-io/mcutil/v4/response"
+)
+
+// QueryResponse is the response of a full query of a Java Edition server, which includes the data that the regular
+// status hides, such as the map name, the plugins and the complete list of player names.
+type QueryResponse struct {
+	BaseStatus
+	*QueryStatus
+}
+
+// QueryStatus is the data returned by the full query of an online server.
+type QueryStatus struct {
+	MOTD     MOTD         `json:"motd"`
+	GameType *string      `json:"game_type"`
+	GameID   *string      `json:"game_id"`
+	Version  *string      `json:"version"`
+	Map      *string      `json:"map"`
+	HostIP   *string      `json:"host_ip"`
+	HostPort *uint16      `json:"host_port"`
+	Players  QueryPlayers `json:"players"`
+	Software *string      `json:"software"`
+	Plugins  []Plugin     `json:"plugins"`
+}
+
+// QueryPlayers holds the player counts and the complete list of player names of a query response.
+type QueryPlayers struct {
+	Online *int64   `json:"online"`
+	Max    *int64   `json:"max"`
+	List   []string `json:"list"`
+}
+
+// GetQueryStatus returns the full query response of a Java Edition server, either using cache or querying the server.
+func GetQueryStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*QueryResponse, CacheResult, error) {
+	key := fmt.Sprintf("query:%s", GetCacheKey(hostname, port, nil))
+
+	cache, result, err := cacheStore.GetOrSet(ctx, key, func() ([]byte, error) {
+		RecordExperimentProbe("query", hostname, port)
+
+		probe, ipAddress, err := ProbeQuery(ctx, hostname, port, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(BuildQueryResponse(hostname, port, probe, ipAddress, opts.TargetCacheDuration("query", hostname, port)))
+	}, opts.TargetCacheDuration("query", hostname, port), opts.CacheValidator("query"))
+
+	if err != nil {
+		return nil, result, err
+	}
+
+	RecordExperimentLookup("query", hostname, port, result)
+
+	if !result.Hit {
+		RecordCacheEntrySize(ctx, key, hostname, port, len(cache))
+	}
+
+	var response QueryResponse
+
+	return &response, result, json.Unmarshal(cache, &response)
+}
+
+// ProbeQuery performs the full query of a Java Edition server, along with the resolution of its IP address.
+// An error is only returned if the lookup was cancelled before it could finish.
+func ProbeQuery(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*response.QueryFull, *string, error) {
+	ipAddress := ResolveIPAddress(ctx, hostname)
+
+	result, err := CoordinateProbe(ctx, "query", GetCacheKey(hostname, port, nil), opts.SkipProbeInterval, func(ctx context.Context) (*response.QueryFull, error) {
+		if role == RoleAPI {
+			result, err := EnqueueProbe(ctx, "query", hostname, port, opts)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Query, nil
+		}
+
+		return probeQuery(ctx, hostname, port, opts)
+	})
+
+	return result, ipAddress, err
+}
+
+// QueryFull retrieves the full query information of a server. The query protocol does not send the hostname, so the
+// query is sent to the checked address of the target.
+func QueryFull(ctx context.Context, hostname string, port uint16, timeout time.Duration) (*response.QueryFull, error) {
+	address, err := ResolveTarget(ctx, hostname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Full(ctx, address, port, options.Query{
+		Timeout: timeout,
+	})
+}
+
+func probeQuery(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*response.QueryFull, error) {
+	ctx, done := inflight.Start(ctx, "query", hostname, port, opts.Trigger)
+
+	defer done()
+
+	trace := StartProbeTrace(ctx, "query", hostname, port)
+
+	queryContext, cancel := context.WithTimeout(ctx, opts.Timeout)
+
+	defer cancel()
+
+	start := time.Now()
+
+	result, err := RecoverProtocol("query", hostname, port, func() (*response.QueryFull, error) {
+		return QueryFull(queryContext, hostname, port, opts.Timeout-time.Millisecond*100)
+	})
+
+	trace.Step("query", start, err)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	trace.Finish(ctx, result)
+
+	return result, nil
+}
+
+// BuildQueryResponse builds the response data from the full query information, which is nil if the server did not
+// respond to the query.
+func BuildQueryResponse(hostname string, port uint16, result *response.QueryFull, ipAddress *string, cacheDuration time.Duration) *QueryResponse {
+	response := &QueryResponse{
+		BaseStatus: BaseStatus{
+			Online:      false,
+			Host:        hostname,
+			Port:        port,
+			PortSource:  PortSourceExplicit,
+			IPAddress:   ipAddress,
+			EULABlocked: IsBlockedAddress(hostname),
+			Confidence:  1,
+			RetrievedAt: time.Now().UnixMilli(),
+			ExpiresAt:   time.Now().Add(cacheDuration).UnixMilli(),
+		},
+		QueryStatus: nil,
+	}
+
+	if result == nil {
+		return response
+	}
+
+	response.Online = true
+
+	response.QueryStatus = &QueryStatus{
+		GameType: GetQueryValue(result.Data, "gametype"),
+		GameID:   GetQueryValue(result.Data, "game_id"),
+		Version:  GetQueryValue(result.Data, "version"),
+		Map:      GetQueryValue(result.Data, "map"),
+		HostIP:   GetQueryValue(result.Data, "hostip"),
+		Players: QueryPlayers{
+			List: make([]string, 0, len(result.Players)),
+		},
+		Plugins: make([]Plugin, 0),
+	}
+
+	if motd, ok := result.Data["hostname"]; ok {
+		if parsedMOTD, err := formatting.Parse(motd); err == nil {
+			response.MOTD = MOTD{
+				Raw:   parsedMOTD.Raw,
+				Clean: parsedMOTD.Clean,
+				HTML:  ApplyColorPalette(parsedMOTD.HTML),
+			}
+		}
+	}
+
+	if value, ok := result.Data["hostport"]; ok {
+		if hostPort, err := strconv.ParseUint(value, 10, 16); err == nil {
+			response.HostPort = PointerOf(uint16(hostPort))
+		}
+	}
+
+	if value, ok := result.Data["numplayers"]; ok {
+		if onlinePlayers, err := strconv.ParseInt(value, 10, 64); err == nil {
+			response.Players.Online = &onlinePlayers
+		}
+	}
+
+	if value, ok := result.Data["maxplayers"]; ok {
+		if maxPlayers, err := strconv.ParseInt(value, 10, 64); err == nil {
+			response.Players.Max = &maxPlayers
+		}
+	}
+
+	if plugins, ok := result.Data["plugins"]; ok {
+		if software, parsedPlugins := ParseQueryPlugins(plugins); software != nil {
+			response.Software = software
+			response.Plugins = parsedPlugins
+		}
+	}
+
+	response.Players.List = append(response.Players.List, result.Players...)
+
+	return response
+}
+
+// GetQueryValue returns the value of the key in the query data, or nil if it is missing or empty.
+func GetQueryValue(data map[string]string, key string) *string {
+	value, ok := data[key]
+
+	if !ok || len(value) < 1 {
+		return nil
+	}
+
+	return &value
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	ErrRateLimitExceeded error = errors.New("too many requests, please try again later")
+)
+
+// LimitRequestRate is a middleware that limits the rate of requests of each client IP address using a token bucket
+// stored in Redis, so that every instance sharing the Redis server enforces the same limit. Requests of a tenant with
+// a rate limit of its own share the bucket of the tenant instead.
+func LimitRequestRate(ctx *fiber.Ctx) error {
+	if !config.RateLimit.Enable || IsRateLimitExcluded(ctx.Path()) {
+		return ctx.Next()
+	}
+
+	taken, retryAfter, err := TakeRequestToken(ctx.UserContext(), ctx.IP(), GetTenant(ctx))
+
+	if err != nil {
+		return err
+	}
+
+	if !taken {
+		return SendTooManyRequests(ctx, retryAfter)
+	}
+
+	return ctx.Next()
+}
+
+// TakeRequestToken takes a token from the bucket of the tenant if it has a rate limit of its own, or otherwise from
+// the bucket of the client IP address, returning false along with the time until the next token if the bucket is empty.
+func TakeRequestToken(ctx context.Context, ip string, tenant *ConfigTenant) (bool, time.Duration, error) {
+	key, burst, requestsPerMinute := fmt.Sprintf("rate-limit:%s", ip), config.RateLimit.Burst, config.RateLimit.RequestsPerMinute
+
+	if tenant != nil && tenant.RateLimit != nil {
+		key, burst, requestsPerMinute = fmt.Sprintf("rate-limit:tenant:%s", tenant.Name), tenant.RateLimit.Burst, tenant.RateLimit.RequestsPerMinute
+	}
+
+	taken, _, retryAfter, err := r.TakeToken(ctx, key, burst, float64(requestsPerMinute)/60)
+
+	return taken, retryAfter, err
+}
+
+// SendTooManyRequests responds with the error returned when a request exceeds its rate limit, along with the time
+// until it may be retried.
+func SendTooManyRequests(ctx *fiber.Ctx, retryAfter time.Duration) error {
+	ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	return ctx.Status(http.StatusTooManyRequests).SendString("Too many requests, please try again later")
+}
+
+// IsRateLimitExcluded returns whether the path starts with any of the prefixes excluded from rate limiting.
+func IsRateLimitExcluded(path string) bool {
+	for _, prefix := range config.RateLimit.Exclude {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
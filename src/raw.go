@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// GetRawJavaStatus returns the unmodified status JSON of a Java Edition server, either using cache or fetching a fresh
+// status. Nil is returned if the server did not respond or if the status is larger than the configured limit.
+func GetRawJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (RawJSON, error) {
+	key := fmt.Sprintf("java-raw:%s", GetCacheKey(hostname, port, nil))
+
+	cache, result, err := cacheStore.GetOrSet(ctx, key, func() ([]byte, error) {
+		raw, err := ProbeRawJavaStatus(ctx, hostname, port, opts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(raw)
+	}, opts.TargetCacheDuration("java", hostname, port), opts.BypassCacheValidator())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.Hit {
+		RecordCacheEntrySize(ctx, key, hostname, port, len(cache))
+	}
+
+	if string(cache) == "null" {
+		return nil, nil
+	}
+
+	return RawJSON(cache), nil
+}
+
+// ProbeRawJavaStatus retrieves the status JSON of a Java Edition server without parsing it into the known properties.
+// An error is only returned if the lookup was cancelled before it could finish.
+func ProbeRawJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*json.RawMessage, error) {
+	return CoordinateProbe(ctx, "raw", GetCacheKey(hostname, port, nil), opts.SkipProbeInterval, func(ctx context.Context) (*json.RawMessage, error) {
+		if role == RoleAPI {
+			result, err := EnqueueProbe(ctx, "raw", hostname, port, opts)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Raw, nil
+		}
+
+		return probeRawJavaStatus(ctx, hostname, port, opts)
+	})
+}
+
+func probeRawJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*json.RawMessage, error) {
+	ctx, done := inflight.Start(ctx, "raw", hostname, port, opts.Trigger)
+
+	defer done()
+
+	trace := StartProbeTrace(ctx, "raw", hostname, port)
+
+	statusContext, cancel := context.WithTimeout(ctx, opts.Timeout)
+
+	defer cancel()
+
+	start := time.Now()
+
+	result, err := RecoverProtocol("raw", hostname, port, func() (*map[string]interface{}, error) {
+		_, raw, err := PingJava(statusContext, hostname, port, LookupJavaAddress(statusContext, hostname, port))
+
+		// The status is returned even if the properties that are known could not be parsed
+		if raw == nil {
+			return nil, err
+		}
+
+		var result map[string]interface{}
+
+		if err = json.Unmarshal(raw, &result); err != nil {
+			return nil, err
+		}
+
+		return &result, nil
+	})
+
+	trace.Step("status", start, err)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	trace.Finish(ctx, result)
+
+	if result == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(result)
+
+	// Oversized statuses are left out rather than truncated, as truncated JSON would be of no use to anyone
+	if err != nil || len(data) > config.Lookup.MaxRawSize {
+		return nil, nil
+	}
+
+	return PointerOf(json.RawMessage(data)), nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/go-redsync/redsync/v4"
@@ -13,9 +14,85 @@ import (
 
 const defaultTimeout = 5 * time.Second
 
+var (
+	// setIfAbsentScript atomically writes a value unless the key already exists (or ARGV[3] is "1" to overwrite it),
+	// returning the stored value, its remaining TTL in milliseconds and whether it was already present.
+	setIfAbsentScript *redis.Script = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+
+if current and ARGV[3] ~= '1' then
+	return {current, redis.call('PTTL', KEYS[1]), 1}
+end
+
+if ARGV[2] == '0' then
+	redis.call('SET', KEYS[1], ARGV[1])
+
+	return {ARGV[1], -1, 0}
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+
+return {ARGV[1], tonumber(ARGV[2]), 0}
+`)
+
+	// incrementScript increments the key and sets its expiry in milliseconds to ARGV[1] if the key was just created.
+	incrementScript *redis.Script = redis.NewScript(`
+local value = redis.call('INCR', KEYS[1])
+
+if value == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+
+return value
+`)
+
+	// takeTokenScript takes a token from the bucket stored at the key, which holds up to ARGV[1] tokens and refills at
+	// ARGV[2] tokens per millisecond, returning whether a token was taken, the remaining whole tokens and the
+	// milliseconds until the next token is available. The clock of the Redis server is used so that every instance
+	// agrees on the time.
+	takeTokenScript *redis.Script = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or capacity
+local updated = tonumber(bucket[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local taken = 0
+
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+
+return {taken, math.floor(tokens), math.ceil(math.max(0, 1 - tokens) / rate)}
+`)
+)
+
+// CacheResult describes whether a value was served from the cache and how long it remains valid for.
+type CacheResult struct {
+	Hit bool
+	TTL time.Duration
+}
+
+// SortedSetEntry is a member of a sorted set along with its score.
+type SortedSetEntry struct {
+	Member string
+	Score  float64
+}
+
+// CacheValidator decides whether a cached value may still be used, returning its remaining lifetime.
+type CacheValidator func(data []byte, ttl time.Duration) (time.Duration, bool)
+
 // Redis is a wrapper around the Redis client.
 type Redis struct {
-	Client     *redis.Client
+	Client     redis.UniversalClient
 	Pool       *redsyncredis.Pool
 	SyncClient *redsync.Redsync
 }
@@ -36,7 +113,42 @@ func (r *Redis) Connect() error {
 		return err
 	}
 
-	r.Client = redis.NewClient(opts)
+	if len(config.RedisCluster) > 0 && config.RedisSentinel.MasterName != nil {
+		return errors.New("cannot use Redis Cluster and Redis Sentinel together")
+	}
+
+	switch {
+	case len(config.RedisCluster) > 0:
+		r.Client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     config.RedisCluster,
+			Username:  opts.Username,
+			Password:  opts.Password,
+			PoolSize:  opts.PoolSize,
+			TLSConfig: opts.TLSConfig,
+		})
+	case config.RedisSentinel.MasterName != nil:
+		if len(config.RedisSentinel.Addresses) < 1 {
+			return errors.New("missing Redis Sentinel addresses")
+		}
+
+		failoverOpts := &redis.FailoverOptions{
+			MasterName:    *config.RedisSentinel.MasterName,
+			SentinelAddrs: config.RedisSentinel.Addresses,
+			Username:      opts.Username,
+			Password:      opts.Password,
+			DB:            opts.DB,
+			PoolSize:      opts.PoolSize,
+			TLSConfig:     opts.TLSConfig,
+		}
+
+		if config.RedisSentinel.Password != nil {
+			failoverOpts.SentinelPassword = *config.RedisSentinel.Password
+		}
+
+		r.Client = redis.NewFailoverClient(failoverOpts)
+	default:
+		r.Client = redis.NewClient(opts)
+	}
 
 	if err = r.Client.Ping(ctx).Err(); err != nil {
 		return err
@@ -50,12 +162,12 @@ func (r *Redis) Connect() error {
 }
 
 // Get retrieves the value and TTL for a given key.
-func (r *Redis) Get(key string) ([]byte, time.Duration, error) {
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, time.Duration, error) {
 	if r.Client == nil {
 		return nil, 0, nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 
 	defer cancel()
 
@@ -77,32 +189,430 @@ func (r *Redis) Get(key string) ([]byte, time.Duration, error) {
 	return data, ttl.Val(), err
 }
 
+// GetOrSet returns the cached value of the key, or calls fetch and caches its result for the TTL on a miss. The
+// remaining TTL is returned on both paths. If validate is not nil, cached values it rejects are treated as misses and
+// replaced. Concurrent misses are serialized with a lock when enabled, and the write is atomic so that a value stored
+// by another process in the meantime is returned instead of being overwritten.
+func (r *Redis) GetOrSet(ctx context.Context, key string, fetch func() ([]byte, error), ttl time.Duration, validate CacheValidator) ([]byte, CacheResult, error) {
+	if r.Client == nil {
+		data, err := fetch()
+
+		return data, CacheResult{Hit: false, TTL: ttl}, err
+	}
+
+	lookup := func() ([]byte, CacheResult, bool, error) {
+		data, remaining, err := r.Get(ctx, key)
+
+		if err != nil || data == nil {
+			return nil, CacheResult{}, false, err
+		}
+
+		if validate == nil {
+			return data, CacheResult{Hit: true, TTL: remaining}, true, nil
+		}
+
+		remaining, ok := validate(data, remaining)
+
+		return data, CacheResult{Hit: true, TTL: remaining}, ok, nil
+	}
+
+	if data, result, ok, err := lookup(); err != nil || ok {
+		return data, result, err
+	}
+
+	// Wait for any other processes to finish fetching the same value, then check whether they cached it
+	if config.Cache.EnableLocks {
+		mutex := r.NewMutex(fmt.Sprintf("lock:%s", key))
+		mutex.Lock(ctx)
+
+		defer mutex.Unlock()
+
+		if data, result, ok, err := lookup(); err != nil || ok {
+			return data, result, err
+		}
+	}
+
+	data, err := fetch()
+
+	if err != nil {
+		return nil, CacheResult{}, err
+	}
+
+	// A stale value rejected by the validator is overwritten, anything else written in the meantime is kept
+	overwrite := "0"
+
+	if validate != nil {
+		overwrite = "1"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	values, err := setIfAbsentScript.Run(ctx, r.Client, []string{key}, data, ttl.Milliseconds(), overwrite).Slice()
+
+	if err != nil {
+		return nil, CacheResult{}, err
+	}
+
+	if len(values) != 3 {
+		return nil, CacheResult{}, fmt.Errorf("redis: unexpected get-or-set reply length: %d", len(values))
+	}
+
+	stored, _ := values[0].(string)
+	remaining, _ := values[1].(int64)
+	hit, _ := values[2].(int64)
+
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return []byte(stored), CacheResult{Hit: hit == 1, TTL: time.Duration(remaining) * time.Millisecond}, nil
+}
+
 // Set sets the value and TTL for a given key.
-func (r *Redis) Set(key string, value interface{}, ttl time.Duration) error {
+func (r *Redis) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
 	if r.Client == nil {
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 
 	defer cancel()
 
 	return r.Client.Set(ctx, key, value, ttl).Err()
 }
 
+// Swap sets the value and TTL for a given key, returning its previous value or nil if it did not exist.
+func (r *Redis) Swap(ctx context.Context, key string, value interface{}, ttl time.Duration) ([]byte, error) {
+	if r.Client == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	previous, err := r.Client.SetArgs(ctx, key, value, redis.SetArgs{TTL: ttl, Get: true}).Bytes()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	return previous, err
+}
+
+// Delete removes the given keys. Each key is deleted with its own command, as keys in different hash slots cannot be
+// deleted together by a Redis Cluster.
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if r.Client == nil || len(keys) < 1 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	p := r.Client.Pipeline()
+
+	for _, key := range keys {
+		p.Del(ctx, key)
+	}
+
+	_, err := p.Exec(ctx)
+
+	return err
+}
+
 // Increment increments the integer value of a key by 1.
-func (r *Redis) Increment(key string) error {
+func (r *Redis) Increment(ctx context.Context, key string) error {
 	if r.Client == nil {
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 
 	defer cancel()
 
 	return r.Client.Incr(ctx, key).Err()
 }
 
+// IncrementWithExpiry increments the integer value of a key by 1, expiring the key after the TTL if it did not exist,
+// and returns the new value.
+func (r *Redis) IncrementWithExpiry(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if r.Client == nil {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return incrementScript.Run(ctx, r.Client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+// TakeToken takes a token from the token bucket stored at the key, which holds up to the capacity and refills at the
+// rate in tokens per second. It returns whether a token was taken, the number of whole tokens left and the time until
+// the next token is available.
+func (r *Redis) TakeToken(ctx context.Context, key string, capacity uint, rate float64) (bool, int64, time.Duration, error) {
+	if r.Client == nil {
+		return true, int64(capacity), 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	result, err := takeTokenScript.Run(ctx, r.Client, []string{key}, capacity, rate/1000).Int64Slice()
+
+	if err != nil {
+		return false, 0, 0, err
+	}
+
+	return result[0] == 1, result[1], time.Duration(result[2]) * time.Millisecond, nil
+}
+
+// HashGet retrieves the value of a field in the hash stored at the key, returning nil if it does not exist.
+func (r *Redis) HashGet(ctx context.Context, key, field string) ([]byte, error) {
+	if r.Client == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	value, err := r.Client.HGet(ctx, key, field).Bytes()
+
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	return value, err
+}
+
+// HashSet sets the value of a field in the hash stored at the key.
+func (r *Redis) HashSet(ctx context.Context, key, field string, value interface{}) error {
+	if r.Client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return r.Client.HSet(ctx, key, field, value).Err()
+}
+
+// HashGetAll retrieves every field and value of the hash stored at the key.
+func (r *Redis) HashGetAll(ctx context.Context, key string) (map[string]string, error) {
+	if r.Client == nil {
+		return map[string]string{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return r.Client.HGetAll(ctx, key).Result()
+}
+
+// HashDelete removes the given fields from the hash stored at the key, returning the number of fields removed.
+func (r *Redis) HashDelete(ctx context.Context, key string, fields ...string) (int64, error) {
+	if r.Client == nil {
+		return 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return r.Client.HDel(ctx, key, fields...).Result()
+}
+
+// ListPush prepends the value to the list stored at the key, trimming the list to at most the given length.
+func (r *Redis) ListPush(ctx context.Context, key string, value interface{}, length int64) error {
+	if r.Client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	p := r.Client.Pipeline()
+
+	p.LPush(ctx, key, value)
+	p.LTrim(ctx, key, 0, length-1)
+
+	_, err := p.Exec(ctx)
+
+	return err
+}
+
+// ListRange retrieves the values of the list stored at the key between the start and stop indexes, inclusive.
+func (r *Redis) ListRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	if r.Client == nil {
+		return []string{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return r.Client.LRange(ctx, key, start, stop).Result()
+}
+
+// ListBlockingPop removes and returns the last value of the list stored at the key, waiting up to the timeout for a
+// value to be pushed. A nil value is returned if the timeout elapses first.
+func (r *Redis) ListBlockingPop(ctx context.Context, key string, timeout time.Duration) ([]byte, error) {
+	if r.Client == nil {
+		return nil, nil
+	}
+
+	// Redis only accepts whole seconds here, and a timeout of zero would block forever
+	timeout = max((timeout + time.Second - 1).Truncate(time.Second), time.Second)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+defaultTimeout)
+
+	defer cancel()
+
+	values, err := r.Client.BRPop(ctx, timeout, key).Result()
+
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return []byte(values[1]), nil
+}
+
+// Expire sets the TTL of the given key.
+func (r *Redis) Expire(ctx context.Context, key string, ttl time.Duration) error {
+	if r.Client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return r.Client.Expire(ctx, key, ttl).Err()
+}
+
+// SortedSetAdd sets the score of a member in the sorted set stored at the key, then trims the set down to the given
+// number of members with the highest scores.
+func (r *Redis) SortedSetAdd(ctx context.Context, key, member string, score float64, length int64) error {
+	if r.Client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	p := r.Client.Pipeline()
+
+	p.ZAdd(ctx, key, redis.Z{Score: score, Member: member})
+	p.ZRemRangeByRank(ctx, key, 0, -length-1)
+
+	_, err := p.Exec(ctx)
+
+	return err
+}
+
+// SortedSetIncrement increments the score of a member in the sorted set stored at the key by one, and sets the TTL
+// of the key.
+func (r *Redis) SortedSetIncrement(ctx context.Context, key, member string, ttl time.Duration) error {
+	if r.Client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	p := r.Client.Pipeline()
+
+	p.ZIncrBy(ctx, key, 1, member)
+	p.PExpire(ctx, key, ttl)
+
+	_, err := p.Exec(ctx)
+
+	return err
+}
+
+// SortedSetTop returns up to the given number of members with the highest scores in the sorted set stored at the key.
+func (r *Redis) SortedSetTop(ctx context.Context, key string, count int64) ([]SortedSetEntry, error) {
+	if r.Client == nil {
+		return []SortedSetEntry{}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	values, err := r.Client.ZRevRangeWithScores(ctx, key, 0, count-1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]SortedSetEntry, 0, len(values))
+
+	for _, value := range values {
+		member, _ := value.Member.(string)
+
+		result = append(result, SortedSetEntry{
+			Member: member,
+			Score:  value.Score,
+		})
+	}
+
+	return result, nil
+}
+
+// SortedSetRemove removes the given members from the sorted set stored at the key.
+func (r *Redis) SortedSetRemove(ctx context.Context, key string, members ...string) error {
+	if r.Client == nil || len(members) < 1 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return r.Client.ZRem(ctx, key, Map(members, func(v string) interface{} { return v })...).Err()
+}
+
+// TTLs returns the remaining TTL of each of the given keys, which is negative for keys that do not exist.
+func (r *Redis) TTLs(ctx context.Context, keys ...string) ([]time.Duration, error) {
+	if r.Client == nil {
+		return make([]time.Duration, len(keys)), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	p := r.Client.Pipeline()
+
+	commands := make([]*redis.DurationCmd, len(keys))
+
+	for i, key := range keys {
+		commands[i] = p.PTTL(ctx, key)
+	}
+
+	if _, err := p.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return Map(commands, func(v *redis.DurationCmd) time.Duration { return v.Val() }), nil
+}
+
 // NewMutex creates a new mutually exclusive lock that only one process can hold.
 func (r *Redis) NewMutex(name string) *Mutex {
 	if r.Client == nil || r.SyncClient == nil {
@@ -116,6 +626,19 @@ func (r *Redis) NewMutex(name string) *Mutex {
 	}
 }
 
+// Ping checks that the Redis server can be reached.
+func (r *Redis) Ping(ctx context.Context) error {
+	if r.Client == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+
+	defer cancel()
+
+	return r.Client.Ping(ctx).Err()
+}
+
 // Close closes the Redis client connection.
 func (r *Redis) Close() error {
 	if r.Client == nil {
@@ -131,12 +654,12 @@ type Mutex struct {
 }
 
 // Lock will lock the mutex so no other process can hold it.
-func (m *Mutex) Lock() error {
+func (m *Mutex) Lock(ctx context.Context) error {
 	if m.Mutex == nil {
 		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 
 	defer cancel()
 
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// useTestRedis points the Redis client at an in-memory Redis server for the duration of the test.
+func useTestRedis(tb testing.TB) *miniredis.Miniredis {
+	server := miniredis.RunT(tb)
+	previous := r.Client
+
+	r.Client = redis.NewClient(&redis.Options{
+		Addr: server.Addr(),
+	})
+
+	tb.Cleanup(func() {
+		r.Client.Close()
+		r.Client = previous
+	})
+
+	return server
+}
+
+func TestTakeToken(t *testing.T) {
+	server := useTestRedis(t)
+
+	now := time.Now().Truncate(time.Second)
+
+	server.SetTime(now)
+
+	// A bucket of 3 tokens that refills one token per second
+	steps := []struct {
+		Advance    time.Duration
+		Taken      bool
+		Remaining  int64
+		RetryAfter time.Duration
+	}{
+		{0, true, 2, 0},
+		{0, true, 1, 0},
+		{0, true, 0, time.Second},
+		{0, false, 0, time.Second},
+		{time.Millisecond * 500, false, 0, time.Millisecond * 500},
+		{time.Millisecond * 500, true, 0, time.Second},
+		{time.Second * 10, true, 2, 0},
+	}
+
+	for i, step := range steps {
+		now = now.Add(step.Advance)
+
+		server.SetTime(now)
+
+		taken, remaining, retryAfter, err := r.TakeToken(context.Background(), "bucket", 3, 1)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if taken != step.Taken || remaining != step.Remaining || retryAfter != step.RetryAfter {
+			t.Errorf("step %d: got %v, %d, %s, expected %v, %d, %s", i, taken, remaining, retryAfter, step.Taken, step.Remaining, step.RetryAfter)
+		}
+	}
+
+	if ttl := server.TTL("bucket"); ttl <= 0 || ttl > time.Second*3 {
+		t.Errorf("expected the bucket to expire once it is full again, got a TTL of %s", ttl)
+	}
+}
+
+func TestTakeTokenWithoutRedis(t *testing.T) {
+	taken, remaining, _, err := r.TakeToken(context.Background(), "bucket", 3, 1)
+
+	if err != nil || !taken || remaining != 3 {
+		t.Errorf("expected every token to be available without Redis, got %v, %d, %v", taken, remaining, err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mcstatus-io/mcutil/v4/response"
+)
+
+const (
+	// RoleAll serves HTTP requests and probes servers itself.
+	RoleAll = "all"
+	// RoleAPI serves HTTP requests and hands every probe to the probe queue.
+	RoleAPI = "api"
+	// RoleProber consumes the probe queue and writes the results back for the API nodes, only serving the health and
+	// metrics endpoints over HTTP.
+	RoleProber = "prober"
+
+	probeQueueKey = "probe-queue"
+)
+
+var (
+	role string = RoleAll
+
+	ErrProbeQueueTimeout error = errors.New("no prober picked up the probe job in time")
+)
+
+// ProbeJob is a probe requested by an API node, waiting in the probe queue for a prober node.
+type ProbeJob struct {
+	ID         string        `json:"id"`
+	Edition    string        `json:"edition"`
+	Hostname   string        `json:"hostname"`
+	Port       uint16        `json:"port"`
+	Query      bool          `json:"query"`
+	Timeout    time.Duration `json:"timeout"`
+	Trigger    string        `json:"trigger"`
+	EnqueuedAt int64         `json:"enqueued_at"`
+}
+
+// ProbeJobResult is the result of a probe job written back by a prober node.
+type ProbeJobResult struct {
+	Java    *JavaProbeResult    `json:"java,omitempty"`
+	Bedrock *BedrockProbeResult `json:"bedrock,omitempty"`
+	Query   *response.QueryFull `json:"query,omitempty"`
+	Raw     *json.RawMessage    `json:"raw,omitempty"`
+	Error   *string             `json:"error,omitempty"`
+}
+
+// IsValidRole checks if the value is one of the known process roles.
+func IsValidRole(value string) bool {
+	return value == RoleAll || value == RoleAPI || value == RoleProber
+}
+
+// GetProbeResultKey returns the key of the list that the result of a probe job is pushed to.
+func GetProbeResultKey(id string) string {
+	return fmt.Sprintf("probe-result:%s", id)
+}
+
+// EnqueueProbe adds a probe job to the probe queue and waits for a prober node to write back its result.
+func EnqueueProbe(ctx context.Context, edition, hostname string, port uint16, opts *StatusOptions) (*ProbeJobResult, error) {
+	job := ProbeJob{
+		ID:         RandomHexString(16),
+		Edition:    edition,
+		Hostname:   hostname,
+		Port:       port,
+		Query:      opts.Query,
+		Timeout:    opts.Timeout,
+		Trigger:    opts.Trigger,
+		EnqueuedAt: time.Now().UnixMilli(),
+	}
+
+	data, err := json.Marshal(job)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.ListPush(ctx, probeQueueKey, data, int64(config.Prober.MaxQueueLength)); err != nil {
+		return nil, err
+	}
+
+	value, err := r.ListBlockingPop(ctx, GetProbeResultKey(job.ID), config.Prober.QueueTimeout+opts.Timeout)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		return nil, ErrProbeQueueTimeout
+	}
+
+	var result ProbeJobResult
+
+	if err = json.Unmarshal(value, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Error != nil {
+		return nil, errors.New(*result.Error)
+	}
+
+	return &result, nil
+}
+
+// RunProbeJob performs the probe described by the job.
+func RunProbeJob(ctx context.Context, job ProbeJob) (result ProbeJobResult, err error) {
+	opts := &StatusOptions{
+		Query:   job.Query,
+		Timeout: job.Timeout,
+		Trigger: job.Trigger,
+	}
+
+	switch job.Edition {
+	case "java":
+		result.Java, err = probeJavaStatus(ctx, job.Hostname, job.Port, opts)
+	case "bedrock":
+		result.Bedrock, err = probeBedrockStatus(ctx, job.Hostname, job.Port, opts)
+	case "query":
+		result.Query, err = probeQuery(ctx, job.Hostname, job.Port, opts)
+	case "raw":
+		result.Raw, err = probeRawJavaStatus(ctx, job.Hostname, job.Port, opts)
+	default:
+		err = fmt.Errorf("unknown edition: %s", job.Edition)
+	}
+
+	return
+}
+
+// ProcessProbeQueue consumes jobs from the probe queue using the given number of workers until the context is done,
+// writing each result back to the API node that is waiting for it. A single reader pulls jobs only while a worker is
+// free, so that idle workers do not each hold a blocked Redis connection. The jobs being handled are finished before
+// it returns.
+func ProcessProbeQueue(ctx context.Context, workers uint) {
+	var (
+		jobs    chan ProbeJob   = make(chan ProbeJob)
+		running *sync.WaitGroup = &sync.WaitGroup{}
+	)
+
+	defer running.Wait()
+
+	defer close(jobs)
+
+	for i := uint(0); i < workers; i++ {
+		running.Add(1)
+
+		go func() {
+			defer running.Done()
+
+			for job := range jobs {
+				HandleProbeJob(context.Background(), job)
+			}
+		}()
+	}
+
+	for ctx.Err() == nil {
+		value, err := r.ListBlockingPop(ctx, probeQueueKey, time.Second*5)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Printf("Failed to read from probe queue: %v\n", err)
+
+			time.Sleep(time.Second)
+
+			continue
+		}
+
+		if value == nil {
+			continue
+		}
+
+		var job ProbeJob
+
+		if err = json.Unmarshal(value, &job); err != nil {
+			log.Printf("Failed to decode probe job: %v\n", err)
+
+			continue
+		}
+
+		jobs <- job
+	}
+}
+
+// HandleProbeJob runs the probe job and writes its result back, skipping jobs that have waited longer than the API
+// node would.
+func HandleProbeJob(ctx context.Context, job ProbeJob) {
+	deadline := time.UnixMilli(job.EnqueuedAt).Add(config.Prober.QueueTimeout + job.Timeout)
+
+	if time.Now().After(deadline) {
+		return
+	}
+
+	jobContext, cancel := context.WithDeadline(ctx, deadline)
+
+	defer cancel()
+
+	result, err := RunProbeJob(jobContext, job)
+
+	if err != nil {
+		result.Error = PointerOf(err.Error())
+	}
+
+	data, err := json.Marshal(result)
+
+	if err != nil {
+		log.Printf("Failed to encode probe result: %v\n", err)
+
+		return
+	}
+
+	if err = r.ListPush(ctx, GetProbeResultKey(job.ID), data, 1); err != nil {
+		log.Printf("Failed to write probe result: %v\n", err)
+
+		return
+	}
+
+	// The API node may have given up waiting, so the result must not be left behind forever
+	if err = r.Expire(ctx, GetProbeResultKey(job.ID), config.Prober.QueueTimeout); err != nil {
+		log.Printf("Failed to expire probe result: %v\n", err)
+	}
+}
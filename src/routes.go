@@ -1,21 +1,29 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"main/src/assets"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/favicon"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/mcstatus-io/mcutil/v4/options"
-	"github.com/mcstatus-io/mcutil/v4/util"
 	"github.com/mcstatus-io/mcutil/v4/vote"
+	"golang.org/x/net/idna"
 )
 
 func init() {
@@ -23,17 +31,50 @@ func init() {
 		EnableStackTrace: true,
 	}))
 
+	app.Use(RequestContext)
+
+	app.Use(TraceRequests)
+
+	app.Use(requestid.New())
+
+	app.Use(RecordSizeMetrics)
+
+	// Compression is registered after the size metrics so that they observe the compressed bodies actually sent
+	if config.Compression.Enable {
+		app.Use(compress.New(compress.Config{
+			Level: compress.Level(config.Compression.Level),
+		}))
+	}
+
+	if config.Analytics.Enable {
+		app.Use(RecordAnalytics)
+	}
+
+	app.Use(LimitRequestSize)
+
+	app.Use(LimitRequestRate)
+
+	app.Use(DeprecationHeaders)
+
+	app.Use(PublishRequestLogs)
+
 	app.Use(favicon.New(favicon.Config{
 		Data: assets.Favicon,
 	}))
 
-	if config.Environment == "development" {
+	// CORS has always been enabled in development, where the API is usually used from pages served by another origin
+	accessControl := config.AccessControl.Enable || config.Environment == "development"
+
+	if accessControl {
 		app.Use(cors.New(cors.Config{
-			AllowOrigins:  "*",
-			AllowMethods:  "HEAD,OPTIONS,GET,POST",
-			ExposeHeaders: "X-Cache-Hit,X-Cache-Time-Remaining",
+			AllowOrigins:  strings.Join(config.AccessControl.AllowedOrigins, ","),
+			AllowMethods:  "HEAD,OPTIONS,GET,POST,PUT,DELETE",
+			ExposeHeaders: "ETag,X-Cache-Hit,X-Cache-Time-Remaining,X-Online,X-Players-Online,X-Players-Max,X-Request-ID,X-Trace-ID,X-Trace-Sample-ID,traceparent,Deprecation,Sunset,Link,X-RateLimit-Limit,X-RateLimit-Remaining,X-Quota-Limit,X-Quota-Remaining,Retry-After",
+			MaxAge:        int(config.AccessControl.MaxAge.Seconds()),
 		}))
+	}
 
+	if config.Environment == "development" {
 		app.Use(logger.New(logger.Config{
 			Format:     "${time} ${ip}:${port} -> ${status}: ${method} ${path} (${latency})\n",
 			TimeFormat: "2006/01/02 15:04:05",
@@ -41,11 +82,112 @@ func init() {
 	}
 
 	app.Get("/ping", PingHandler)
-	app.Get("/status/java/:address", JavaStatusHandler)
-	app.Get("/status/bedrock/:address", BedrockStatusHandler)
-	app.Get("/icon", DefaultIconHandler)
-	app.Get("/icon/:address", IconHandler)
+	app.Get("/health", HealthHandler)
+	app.Get("/ready", ReadyHandler)
+
+	if config.Metrics.Enable {
+		app.Get("/metrics", MetricsHandler)
+	}
+
+	// Prober processes only serve the endpoints needed to monitor them, as the API nodes serve every other request
+	if role == RoleProber {
+		return
+	}
+
+	app.Get("/status/java/:address", CheckAPIKey, JavaStatusHandler)
+	app.Get("/status/bedrock/:address", CheckAPIKey, BedrockStatusHandler)
+	app.Post("/status/java", CheckAPIKey, ParseStatusRequest("java"), JavaStatusHandler)
+	app.Post("/status/bedrock", CheckAPIKey, ParseStatusRequest("bedrock"), BedrockStatusHandler)
+	app.Get("/query/:host/:port", CheckAPIKey, QueryHandler)
+	app.Get("/simple/:host/:port", CheckAPIKey, SimpleStatusHandler)
+
+	if config.Subscriptions.Enable {
+		app.Get("/ws", RequireWebSocket, CheckAPIKey, RequireSubscriber, SubscribeHandler)
+	}
+
+	if config.GraphQL.Enable {
+		app.Get("/graphql", CheckAPIKey, GraphQLHandler)
+		app.Post("/graphql", CheckAPIKey, GraphQLHandler)
+	}
+
+	if config.LANDiscovery.Enable {
+		app.Get("/discover/lan", LANServersHandler)
+	}
+
+	if config.Aliases.File != nil {
+		app.Get("/status/alias/:alias", CheckAPIKey, AliasStatusHandler)
+		app.Get("/aliases", ListAliasesHandler)
+	}
+
+	app.Get("/icon", RequireImageSignature, DefaultIconHandler)
+	app.Get("/icon/:address", RequireImageSignature, CheckAPIKey, IconHandler)
+
+	if config.Storage.Backend == StorageBackendLocal {
+		app.Get("/artifacts/*", ArtifactHandler)
+	}
+
 	app.Post("/vote", SendVoteHandler)
+	app.Get("/blocked/:host/explain", ExplainBlockedHandler)
+
+	owners := app.Group("/owners/:edition/:address", RequireRedis)
+	owners.Post("/challenge", CreateOwnerChallengeHandler)
+	owners.Post("/verify", ConfirmOwnerChallengeHandler)
+	owners.Put("/opt-out", RequireOwner, OptOutHandler)
+	owners.Delete("/opt-out", RequireOwner, OptInHandler)
+	owners.Put("/icon", RequireOwner, UploadIconOverrideHandler)
+	owners.Delete("/icon", RequireOwner, DeleteIconOverrideHandler)
+	owners.Put("/meta", RequireOwner, SetServerMetaHandler)
+	owners.Delete("/meta", RequireOwner, DeleteServerMetaHandler)
+
+	admin := app.Group("/admin", RequireAdmin)
+	admin.Use(pprof.New(pprof.Config{
+		Prefix: "/admin",
+	}))
+	admin.Post("/fixtures/:edition/:address", RecordFixtureHandler)
+	admin.Get("/sign", SignURLHandler)
+	admin.Get("/signing-keys", ListSigningKeysHandler)
+	admin.Post("/signing-keys/rotate", RequireRedis, RotateSigningKeysHandler)
+	admin.Delete("/signing-keys/:id", RequireRedis, RevokeSigningKeyHandler)
+	admin.Post("/purge/:address", PurgeHandler)
+	admin.Get("/inflight", ListInflightHandler)
+	admin.Delete("/inflight/:id", CancelInflightHandler)
+	admin.Get("/logs/tail", RequireWebSocket, TailLogsHandler)
+	admin.Get("/blocklist", RequireRedis, ListBlocklistHandler)
+	admin.Post("/blocklist", RequireRedis, AddBlocklistHandler)
+	admin.Delete("/blocklist", RequireRedis, RemoveBlocklistHandler)
+	admin.Get("/blocklist/export", RequireRedis, ExportBlocklistHandler)
+	admin.Get("/blocklist/audit", RequireRedis, BlocklistAuditHandler)
+	admin.Get("/cache/largest", RequireRedis, LargestCacheKeysHandler)
+	admin.Get("/debug/runtime", RuntimeStatsHandler)
+	admin.Get("/debug/support-bundle", SupportBundleHandler)
+	admin.Post("/debug/support-bundle", StoreSupportBundleHandler)
+	admin.Get("/debug/goroutines", GoroutineDumpHandler)
+	admin.Post("/debug/profile", CPUProfileHandler)
+	admin.Put("/debug/targets/:hostname", RequireRedis, StartDebugSessionHandler)
+	admin.Get("/debug/targets/:hostname", RequireRedis, GetDebugSessionHandler)
+	admin.Delete("/debug/targets/:hostname", RequireRedis, StopDebugSessionHandler)
+	admin.Get("/api-keys", RequireRedis, ListAPIKeysHandler)
+	admin.Post("/api-keys", RequireRedis, CreateAPIKeyHandler)
+	admin.Delete("/api-keys/:id", RequireRedis, DeleteAPIKeyHandler)
+
+	if config.Analytics.Enable {
+		admin.Get("/analytics", AnalyticsHandler)
+	}
+
+	admin.Get("/features", ListFeatureFlagsHandler)
+	admin.Put("/features/:name", RequireRedis, SetFeatureFlagHandler)
+	admin.Delete("/features/:name", RequireRedis, DeleteFeatureFlagHandler)
+	admin.Get("/subsystems", ListSubsystemsHandler)
+	admin.Get("/traces/:id", RequireRedis, GetRequestTraceHandler)
+	admin.Post("/subsystems/:name/restart", RestartSubsystemHandler)
+
+	if config.Fixtures.EnableReplay {
+		app.Get("/debug/replay/:fixture", ReplayFixtureHandler)
+	}
+
+	if accessControl {
+		app.Options("/*", OptionsHandler)
+	}
 }
 
 // PingHandler responds with a 200 OK status for simple health checks.
@@ -53,6 +195,14 @@ func PingHandler(ctx *fiber.Ctx) error {
 	return ctx.SendStatus(http.StatusOK)
 }
 
+// OptionsHandler answers OPTIONS requests that are not CORS preflight requests, which are answered by the CORS
+// middleware before reaching any route.
+func OptionsHandler(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderAllow, "HEAD,OPTIONS,GET,POST,PUT,DELETE")
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
 // JavaStatusHandler returns the status of the Java edition Minecraft server specified in the address parameter.
 func JavaStatusHandler(ctx *fiber.Ctx) error {
 	opts, err := GetStatusOptions(ctx)
@@ -61,37 +211,82 @@ func JavaStatusHandler(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	hostname, port, err := ParseAddress(strings.ToLower(ctx.Params("address")), util.DefaultJavaPort)
+	hostname, port, portSource, err := ParseTargetAddress(GetAddressParam(ctx), "java")
 
 	if err != nil {
 		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
 	}
 
-	authorized, err := Authenticate(ctx)
-
-	// This check should work for both scenarios, because nil should be returned if the user
-	// is unauthorized, and err will be nil in that case.
-	if err != nil || !authorized {
+	if ok, err := CheckTargetRequest(ctx, opts, "java", hostname, port, true); err != nil || !ok {
 		return err
 	}
 
-	if err = r.Increment(fmt.Sprintf("java-hits:%s", fmt.Sprintf("%s:%d", hostname, port))); err != nil {
+	response, cache, err := GetJavaStatus(ctx.UserContext(), hostname, port, opts)
+
+	if err != nil {
 		return err
 	}
 
-	response, expiresAt, err := GetJavaStatus(hostname, port, opts)
+	response.SetPortSource(portSource)
+	response.Deprecation = GetDeprecationNotice(ctx)
+	response.SetCacheResult(cache)
 
-	if err != nil {
+	if response.Meta, err = GetServerMeta(ctx.UserContext(), "java", hostname, port); err != nil {
 		return err
 	}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(expiresAt != 0))
+	if opts.IncludeRaw && response.Online {
+		if response.Raw, err = GetRawJavaStatus(ctx.UserContext(), hostname, port, opts); err != nil {
+			return err
+		}
+	}
+
+	SetSurrogateKey(ctx, hostname)
+
+	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache.Hit))
+	ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(cache.TTL.Seconds())))
 
-	if expiresAt != 0 {
-		ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(expiresAt.Seconds())))
+	if response.JavaStatus != nil {
+		TranslateMOTD(ctx, &response.MOTD)
+
+		SetStatusHeaders(ctx, response.Online, response.Players.Online, response.Players.Max)
+	} else {
+		SetStatusHeaders(ctx, response.Online, nil, nil)
 	}
 
-	return ctx.JSON(response)
+	return SendStatusResponse(ctx, response)
+}
+
+// ParseStatusRequest returns a middleware that reads the address and options of a status request from its JSON body
+// instead of the route and query parameters, so the POST status routes share the handlers of the GET routes.
+func ParseStatusRequest(edition string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		var (
+			body StatusRequest
+			err  error
+		)
+
+		if err = ctx.BodyParser(&body); err != nil || len(body.Host) < 1 {
+			return ctx.Status(http.StatusBadRequest).SendString("Request body must be a JSON object with a non-empty 'host'")
+		}
+
+		host := strings.Trim(body.Host, "[]")
+
+		if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = fmt.Sprintf("[%s]", host)
+		} else if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
+		}
+
+		if body.Port != nil {
+			host = fmt.Sprintf("%s:%d", host, *body.Port)
+		}
+
+		ctx.Locals("address", host)
+		ctx.Locals("request-options", &body.Options)
+
+		return ctx.Next()
+	}
 }
 
 // BedrockStatusHandler returns the status of the Bedrock edition Minecraft server specified in the address parameter.
@@ -102,29 +297,156 @@ func BedrockStatusHandler(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	hostname, port, err := ParseAddress(strings.ToLower(ctx.Params("address")), util.DefaultBedrockPort)
+	hostname, port, portSource, err := ParseTargetAddress(GetAddressParam(ctx), "bedrock")
 
 	if err != nil {
 		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
 	}
 
-	if err = r.Increment(fmt.Sprintf("bedrock-hits:%s", fmt.Sprintf("%s:%d", hostname, port))); err != nil {
+	if ok, err := CheckTargetRequest(ctx, opts, "bedrock", hostname, port, false); err != nil || !ok {
 		return err
 	}
 
-	response, expiresAt, err := GetBedrockStatus(hostname, port, opts)
+	response, cache, err := GetBedrockStatus(ctx.UserContext(), hostname, port, opts)
 
 	if err != nil {
 		return err
 	}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(expiresAt != 0))
+	response.PortSource = portSource
+	response.Deprecation = GetDeprecationNotice(ctx)
+	response.SetCacheResult(cache)
 
-	if expiresAt != 0 {
-		ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(expiresAt.Seconds())))
+	if response.Meta, err = GetServerMeta(ctx.UserContext(), "bedrock", hostname, port); err != nil {
+		return err
 	}
 
-	return ctx.JSON(response)
+	SetSurrogateKey(ctx, hostname)
+
+	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache.Hit))
+	ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(cache.TTL.Seconds())))
+
+	if response.BedrockStatus != nil {
+		TranslateMOTD(ctx, response.MOTD)
+	}
+
+	if response.BedrockStatus != nil && response.Players != nil {
+		SetStatusHeaders(ctx, response.Online, response.Players.Online, response.Players.Max)
+	} else {
+		SetStatusHeaders(ctx, response.Online, nil, nil)
+	}
+
+	return SendStatusResponse(ctx, response)
+}
+
+// QueryHandler returns the full query response of the Java edition Minecraft server specified in the host and port
+// parameters.
+func QueryHandler(ctx *fiber.Ctx) error {
+	opts, err := GetStatusOptions(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	hostname, port, err := ParseAddress(strings.ToLower(fmt.Sprintf("%s:%s", ctx.Params("host"), ctx.Params("port"))), 0)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
+	}
+
+	opts.Query = true
+	opts.Timeout = config.Lookup.QueryTimeout
+	opts.Trigger = "query"
+
+	if ok, err := CheckTargetRequest(ctx, opts, "java", hostname, port, false); err != nil || !ok {
+		return err
+	}
+
+	response, cache, err := GetQueryStatus(ctx.UserContext(), hostname, port, opts)
+
+	if err != nil {
+		return err
+	}
+
+	response.Deprecation = GetDeprecationNotice(ctx)
+	response.SetCacheResult(cache)
+
+	SetSurrogateKey(ctx, hostname)
+
+	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache.Hit))
+	ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(cache.TTL.Seconds())))
+
+	if response.QueryStatus != nil {
+		SetStatusHeaders(ctx, response.Online, response.Players.Online, response.Players.Max)
+	} else {
+		SetStatusHeaders(ctx, response.Online, nil, nil)
+	}
+
+	return SendStatusResponse(ctx, response)
+}
+
+// SimpleStatusHandler returns only whether the server is online, as a plain text body along with a 200 OK or 503
+// Service Unavailable status for uptime monitors. Java Edition servers are looked up unless the 'edition' query
+// parameter is 'bedrock'.
+func SimpleStatusHandler(ctx *fiber.Ctx) error {
+	opts, err := GetStatusOptions(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// Only whether the server is online is returned, so the query lookup is skipped unless it is asked for
+	opts.Query = ctx.QueryBool("query", false)
+
+	edition := ctx.Query("edition", "java")
+
+	if edition != "java" && edition != "bedrock" {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'edition' query parameter, must be one of 'java' or 'bedrock'")
+	}
+
+	hostname, port, err := ParseAddress(strings.ToLower(fmt.Sprintf("%s:%s", ctx.Params("host"), ctx.Params("port"))), 0)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
+	}
+
+	if ok, err := CheckTargetRequest(ctx, opts, edition, hostname, port, edition == "java"); err != nil || !ok {
+		return err
+	}
+
+	var (
+		online bool
+		cache  CacheResult
+	)
+
+	if edition == "java" {
+		response, result, err := GetJavaStatus(ctx.UserContext(), hostname, port, opts)
+
+		if err != nil {
+			return err
+		}
+
+		online, cache = response.Online, result
+	} else {
+		response, result, err := GetBedrockStatus(ctx.UserContext(), hostname, port, opts)
+
+		if err != nil {
+			return err
+		}
+
+		online, cache = response.Online, result
+	}
+
+	SetSurrogateKey(ctx, hostname)
+
+	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache.Hit))
+	ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(cache.TTL.Seconds())))
+
+	if !online {
+		return ctx.Status(http.StatusServiceUnavailable).SendString("offline")
+	}
+
+	return ctx.SendString("online")
 }
 
 // IconHandler returns the server icon for the specified Java edition Minecraft server.
@@ -135,30 +457,58 @@ func IconHandler(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	hostname, port, err := ParseAddress(strings.ToLower(ctx.Params("address")), util.DefaultJavaPort)
+	hostname, port, _, err := ParseTargetAddress(strings.ToLower(ctx.Params("address")), "java")
 
 	if err != nil {
 		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
 	}
 
-	icon, expiresAt, err := GetServerIcon(hostname, port, opts)
+	// Every icon of the server is tagged, including the overrides and default icons that depend on its owner, so that
+	// they are purged along with the status whenever the owner changes them
+	SetSurrogateKey(ctx, hostname)
+
+	err = CheckTarget(ctx.UserContext(), opts, "java", hostname, port, true)
+
+	// The icons of servers whose owner opted out are replaced by the default icon rather than a privacy notice
+	if errors.Is(err, ErrTargetOptedOut) {
+		return SendIcon(ctx, assets.DefaultIcon, startedAt)
+	}
+
+	if err != nil {
+		return SendTargetError(ctx, err, hostname, port)
+	}
+
+	override, err := GetIconOverride(ctx.UserContext(), hostname, port)
 
 	if err != nil {
 		return err
 	}
 
-	ctx.Set("X-Cache-Hit", strconv.FormatBool(expiresAt != 0))
+	if override != nil && override.Mode == "replace" {
+		return SendIcon(ctx, override.Data, override.UpdatedAt)
+	}
+
+	opts.Trigger = "icon"
+
+	icon, cache, err := GetServerIcon(ctx.UserContext(), hostname, port, opts)
+
+	if err != nil {
+		return err
+	}
 
-	if expiresAt != 0 {
-		ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(expiresAt.Seconds())))
+	if override != nil && bytes.Equal(icon, assets.DefaultIcon) {
+		return SendIcon(ctx, override.Data, override.UpdatedAt)
 	}
 
-	return ctx.Type("png").Send(icon)
+	ctx.Set("X-Cache-Hit", strconv.FormatBool(cache.Hit))
+	ctx.Set("X-Cache-Time-Remaining", strconv.Itoa(int(cache.TTL.Seconds())))
+
+	return SendIcon(ctx, icon, time.Now().Add(cache.TTL-opts.TargetCacheDuration("icon", hostname, port)))
 }
 
 // DefaultIconHandler returns the default server icon.
 func DefaultIconHandler(ctx *fiber.Ctx) error {
-	return ctx.Type("png").Send(assets.DefaultIcon)
+	return SendIcon(ctx, assets.DefaultIcon, startedAt)
 }
 
 // SendVoteHandler allows sending of Votifier votes to the specified server.
@@ -169,11 +519,26 @@ func SendVoteHandler(ctx *fiber.Ctx) error {
 		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
 	}
 
-	c, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	if err = CheckTarget(ctx.UserContext(), nil, "java", opts.Host, opts.Port, false); err != nil {
+		return SendTargetError(ctx, err, opts.Host, opts.Port)
+	}
+
+	c, cancel := context.WithTimeout(ctx.UserContext(), opts.Timeout)
 
 	defer cancel()
 
-	if err = vote.SendVote(c, opts.Host, opts.Port, options.Vote{
+	// The vote is sent to the checked address of the host, as mcutil would otherwise resolve the host again
+	address, err := ResolveTarget(c, opts.Host)
+
+	if errors.Is(err, ErrRestrictedAddress) {
+		return SendRestrictedTarget(ctx)
+	}
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	if err = vote.SendVote(c, address, opts.Port, options.Vote{
 		PublicKey:   opts.PublicKey,
 		Token:       opts.Token,
 		ServiceName: opts.ServiceName,
@@ -187,3 +552,109 @@ func SendVoteHandler(ctx *fiber.Ctx) error {
 
 	return ctx.Status(http.StatusOK).SendString("The vote was successfully sent to the server")
 }
+
+// RecordFixtureHandler records the raw responses of a server as a named fixture.
+func RecordFixtureHandler(ctx *fiber.Ctx) error {
+	if edition := ctx.Params("edition"); edition != "java" && edition != "bedrock" {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid edition, must be one of 'java' or 'bedrock'")
+	}
+
+	opts, err := GetStatusOptions(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	hostname, port, _, err := ParseTargetAddress(strings.ToLower(ctx.Params("address")), ctx.Params("edition"))
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
+	}
+
+	// Fixtures are recorded by administrators, who may record servers that opted out of public lookups
+	if err = CheckTarget(ctx.UserContext(), opts, ctx.Params("edition"), hostname, port, ctx.Params("edition") == "java"); err != nil && !errors.Is(err, ErrTargetOptedOut) {
+		return SendTargetError(ctx, err, hostname, port)
+	}
+
+	fixture, err := RecordFixture(ctx.UserContext(), ctx.Query("name"), ctx.Params("edition"), hostname, port, opts)
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidFixtureName) {
+			return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(fixture)
+}
+
+// ReplayFixtureHandler returns the status response built from a previously recorded fixture.
+func ReplayFixtureHandler(ctx *fiber.Ctx) error {
+	fixture, err := LoadFixture(ctx.Params("fixture"))
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrInvalidFixtureName) {
+			return ctx.SendStatus(http.StatusNotFound)
+		}
+
+		return err
+	}
+
+	response, err := fixture.Replay()
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(response)
+}
+
+// PurgeHandler removes all cached responses of the server from the origin cache and any configured CDN.
+func PurgeHandler(ctx *fiber.Ctx) error {
+	address := strings.ToLower(ctx.Params("address"))
+
+	javaHostname, javaPort, _, err := ParseTargetAddress(address, "java")
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
+	}
+
+	bedrockHostname, bedrockPort, _, err := ParseTargetAddress(address, "bedrock")
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid address value")
+	}
+
+	if err = cacheStore.Delete(
+		ctx.UserContext(),
+		fmt.Sprintf("java:%s", GetCacheKey(javaHostname, javaPort, &StatusOptions{Query: true})),
+		fmt.Sprintf("java:%s", GetCacheKey(javaHostname, javaPort, &StatusOptions{Query: false})),
+		fmt.Sprintf("java-raw:%s", GetCacheKey(javaHostname, javaPort, nil)),
+		fmt.Sprintf("icon:%s", GetCacheKey(javaHostname, javaPort, nil)),
+		fmt.Sprintf("query:%s", GetCacheKey(javaHostname, javaPort, nil)),
+		fmt.Sprintf("bedrock:%s", GetCacheKey(bedrockHostname, bedrockPort, nil)),
+	); err != nil {
+		return err
+	}
+
+	if err = PurgeSurrogateKey(ctx.UserContext(), GetSurrogateKey(javaHostname)); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
+
+// ListInflightHandler returns every lookup that is currently being performed by this process.
+func ListInflightHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(inflight.List())
+}
+
+// CancelInflightHandler aborts a lookup that is currently being performed.
+func CancelInflightHandler(ctx *fiber.Ctx) error {
+	if !inflight.Cancel(ctx.Params("id")) {
+		return ctx.SendStatus(http.StatusNotFound)
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcstatus-io/mcutil/v4/formatting"
+	"github.com/mcstatus-io/mcutil/v4/options"
+	"github.com/mcstatus-io/mcutil/v4/response"
+	"github.com/mcstatus-io/mcutil/v4/status"
+)
+
+const (
+	// ShadowOutcomeMatch is the outcome of a shadow lookup that agreed with the primary lookup.
+	ShadowOutcomeMatch = "match"
+	// ShadowOutcomeDiverged is the outcome of a shadow lookup that disagreed with the primary lookup.
+	ShadowOutcomeDiverged = "diverged"
+)
+
+var (
+	// shadowCandidates are the alternative implementations that shadow lookups can run, by edition and name.
+	shadowCandidates map[string]map[string]ShadowProbe = map[string]map[string]ShadowProbe{
+		"java": {
+			"mcutil-raw": probeShadowJavaRaw,
+		},
+		"bedrock": {
+			"mcutil": probeShadowBedrock,
+		},
+	}
+)
+
+// ShadowProbe retrieves the status of a server with an alternative implementation, summarized for comparison.
+type ShadowProbe func(ctx context.Context, hostname string, port uint16, timeout time.Duration) (*ShadowSummary, error)
+
+// ShadowSummary is the part of a status that shadow lookups compare between the implementations.
+type ShadowSummary struct {
+	Online        bool
+	Version       string
+	Protocol      int64
+	PlayersOnline int64
+	PlayersMax    int64
+	MOTD          string
+}
+
+// ShadowLookup is a lookup of a server by a candidate implementation, running alongside the primary lookup.
+type ShadowLookup struct {
+	Edition   string
+	Hostname  string
+	Port      uint16
+	Candidate string
+	Result    chan *ShadowSummary
+	Error     error
+}
+
+// StartShadowLookup starts a lookup of the server with the configured candidate implementation of the edition for the
+// sampled fraction of lookups, or returns nil otherwise. The candidate runs in the background so that it never
+// affects the primary lookup or its response.
+func StartShadowLookup(ctx context.Context, edition, hostname string, port uint16, opts *StatusOptions) *ShadowLookup {
+	name, ok := config.Shadow.Candidates[edition]
+
+	if !ok || config.Shadow.SampleRate <= 0 || rand.Float64() >= config.Shadow.SampleRate {
+		return nil
+	}
+
+	probe, ok := shadowCandidates[edition][name]
+
+	if !ok {
+		return nil
+	}
+
+	lookup := &ShadowLookup{
+		Edition:   edition,
+		Hostname:  hostname,
+		Port:      port,
+		Candidate: name,
+		Result:    make(chan *ShadowSummary, 1),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opts.Timeout)
+
+		defer cancel()
+
+		var result *ShadowSummary
+
+		result, lookup.Error = RecoverProtocol("shadow_"+edition, hostname, port, func() (*ShadowSummary, error) {
+			return probe(ctx, hostname, port, opts.Timeout)
+		})
+
+		// A failed lookup means the server is offline to the candidate, as it does to the primary implementation
+		if result == nil {
+			result = &ShadowSummary{}
+		}
+
+		lookup.Result <- result
+	}()
+
+	return lookup
+}
+
+// Compare compares the summary of the primary lookup with the result of the candidate once it finishes, recording
+// the outcome and logging any divergence. It does nothing if the lookup was not sampled.
+func (l *ShadowLookup) Compare(primary *ShadowSummary) {
+	if l == nil {
+		return
+	}
+
+	go func() {
+		candidate := <-l.Result
+
+		fields := []struct {
+			Name      string
+			Primary   interface{}
+			Candidate interface{}
+		}{
+			{"online", primary.Online, candidate.Online},
+			{"version", primary.Version, candidate.Version},
+			{"protocol", primary.Protocol, candidate.Protocol},
+			{"players_online", primary.PlayersOnline, candidate.PlayersOnline},
+			{"players_max", primary.PlayersMax, candidate.PlayersMax},
+			{"motd", primary.MOTD, candidate.MOTD},
+		}
+
+		divergences := make([]string, 0)
+
+		for _, field := range fields {
+			if field.Primary == field.Candidate {
+				continue
+			}
+
+			shadowDivergences.WithLabelValues(l.Edition, l.Candidate, field.Name).Inc()
+
+			divergences = append(divergences, fmt.Sprintf("%s: %#v != %#v", field.Name, field.Primary, field.Candidate))
+		}
+
+		if len(divergences) < 1 {
+			shadowLookups.WithLabelValues(l.Edition, l.Candidate, ShadowOutcomeMatch).Inc()
+
+			return
+		}
+
+		shadowLookups.WithLabelValues(l.Edition, l.Candidate, ShadowOutcomeDiverged).Inc()
+
+		if l.Error != nil {
+			divergences = append(divergences, fmt.Sprintf("error: %v", l.Error))
+		}
+
+		log.Printf("Shadow %s lookup of %s:%d by %s diverged: %s\n", l.Edition, l.Hostname, l.Port, l.Candidate, strings.Join(divergences, ", "))
+	}()
+}
+
+// SummarizeJavaStatus returns the summary of the modern status retrieved by the primary Java Edition lookup.
+func SummarizeJavaStatus(status *response.StatusModern) *ShadowSummary {
+	if status == nil {
+		return &ShadowSummary{}
+	}
+
+	result := &ShadowSummary{
+		Online:   true,
+		Version:  status.Version.Name.Clean,
+		Protocol: status.Version.Protocol,
+		MOTD:     status.MOTD.Clean,
+	}
+
+	if status.Players.Online != nil {
+		result.PlayersOnline = *status.Players.Online
+	}
+
+	if status.Players.Max != nil {
+		result.PlayersMax = *status.Players.Max
+	}
+
+	return result
+}
+
+// SummarizeBedrockStatus returns the summary of the status retrieved by the primary Bedrock Edition lookup.
+func SummarizeBedrockStatus(status *response.StatusBedrock) *ShadowSummary {
+	if status == nil {
+		return &ShadowSummary{}
+	}
+
+	result := &ShadowSummary{
+		Online: true,
+	}
+
+	if status.Version != nil {
+		result.Version = *status.Version
+	}
+
+	if status.ProtocolVersion != nil {
+		result.Protocol = *status.ProtocolVersion
+	}
+
+	if status.OnlinePlayers != nil {
+		result.PlayersOnline = *status.OnlinePlayers
+	}
+
+	if status.MaxPlayers != nil {
+		result.PlayersMax = *status.MaxPlayers
+	}
+
+	if status.MOTD != nil {
+		result.MOTD = status.MOTD.Clean
+	}
+
+	return result
+}
+
+// probeShadowJavaRaw retrieves the unparsed status of a Java Edition server with the status library and reads the
+// compared properties from it. The status library connects with its own dialer, so it is pointed at the checked
+// address of the target, which is also sent in the handshake. Servers behind proxies that route by hostname may
+// therefore diverge.
+func probeShadowJavaRaw(ctx context.Context, hostname string, port uint16, timeout time.Duration) (*ShadowSummary, error) {
+	connectionHostname, connectionPort, err := net.SplitHostPort(LookupJavaAddress(ctx, hostname, port))
+
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := ResolveTarget(ctx, connectionHostname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	parsedPort, err := strconv.ParseUint(connectionPort, 10, 16)
+
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := status.ModernRaw(ctx, address, uint16(parsedPort), options.StatusModern{
+		EnableSRV:       false,
+		Timeout:         timeout - time.Millisecond*100,
+		ProtocolVersion: -1,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ShadowSummary{
+		Online: true,
+	}
+
+	if version, ok := raw["version"].(map[string]interface{}); ok {
+		if name, ok := version["name"].(string); ok {
+			if parsedName, err := formatting.Parse(name); err == nil {
+				result.Version = parsedName.Clean
+			}
+		}
+
+		if protocol, ok := version["protocol"].(float64); ok {
+			result.Protocol = int64(protocol)
+		}
+	}
+
+	if players, ok := raw["players"].(map[string]interface{}); ok {
+		if online, ok := players["online"].(float64); ok {
+			result.PlayersOnline = int64(online)
+		}
+
+		if max, ok := players["max"].(float64); ok {
+			result.PlayersMax = int64(max)
+		}
+	}
+
+	if description, ok := raw["description"]; ok {
+		if motd, err := formatting.Parse(description); err == nil {
+			result.MOTD = motd.Clean
+		}
+	}
+
+	return result, nil
+}
+
+// probeShadowBedrock retrieves the status of a Bedrock Edition server with the implementation of the status library.
+func probeShadowBedrock(ctx context.Context, hostname string, port uint16, timeout time.Duration) (*ShadowSummary, error) {
+	address, err := ResolveTarget(ctx, hostname)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := status.Bedrock(ctx, address, port, options.StatusBedrock{
+		Timeout: timeout - time.Millisecond*100,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return SummarizeBedrockStatus(result), nil
+}
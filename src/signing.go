@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	signingKeysKey = "signing-keys"
+
+	// SigningKeySourceConfig is the source of the signing keys defined in the configuration.
+	SigningKeySourceConfig = "config"
+	// SigningKeySourceRuntime is the source of the signing keys created through the admin API.
+	SigningKeySourceRuntime = "runtime"
+)
+
+var (
+	// ErrNoSigningKey is returned when no signing key is currently valid.
+	ErrNoSigningKey error = errors.New("no signing key is currently valid")
+
+	signingKeys *SigningKeys = &SigningKeys{
+		Runtime: make(map[string]ConfigSigningKey),
+		Mutex:   &sync.RWMutex{},
+	}
+	// signingKeySyncInterval is how often every instance reloads the signing keys created through the admin API.
+	signingKeySyncInterval time.Duration = time.Second * 10
+)
+
+// SignedURL is a path with an expiration time and signature appended as query parameters.
+type SignedURL struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// SigningKeyState is a signing key as reported by the admin API, without its secret.
+type SigningKeyState struct {
+	ID        string     `json:"id"`
+	Source    string     `json:"source"`
+	NotBefore *time.Time `json:"not_before"`
+	NotAfter  *time.Time `json:"not_after"`
+	Valid     bool       `json:"valid"`
+	Current   bool       `json:"current"`
+}
+
+// SigningKeys holds the in-memory copy of the signing keys created through the admin API and stored in Redis, which are
+// trusted alongside the keys in the configuration.
+type SigningKeys struct {
+	Runtime map[string]ConfigSigningKey
+	Mutex   *sync.RWMutex
+}
+
+// List returns every signing key along with its source, the legacy secret first as a key without an ID, then the keys
+// in the configuration and finally the runtime keys sorted by the start of their validity window.
+func (k *SigningKeys) List() ([]ConfigSigningKey, []string) {
+	k.Mutex.RLock()
+
+	defer k.Mutex.RUnlock()
+
+	keys := make([]ConfigSigningKey, 0, len(config.SignedURLs.Keys)+len(k.Runtime)+1)
+	sources := make([]string, 0, cap(keys))
+
+	if config.SignedURLs.Secret != nil {
+		keys = append(keys, ConfigSigningKey{
+			ID:     "",
+			Secret: *config.SignedURLs.Secret,
+		})
+		sources = append(sources, SigningKeySourceConfig)
+	}
+
+	for _, key := range config.SignedURLs.Keys {
+		keys = append(keys, key)
+		sources = append(sources, SigningKeySourceConfig)
+	}
+
+	runtimeKeys := make([]ConfigSigningKey, 0, len(k.Runtime))
+
+	for _, key := range k.Runtime {
+		runtimeKeys = append(runtimeKeys, key)
+	}
+
+	sort.Slice(runtimeKeys, func(i, j int) bool {
+		return signingKeyStart(runtimeKeys[i]).Before(signingKeyStart(runtimeKeys[j]))
+	})
+
+	for _, key := range runtimeKeys {
+		keys = append(keys, key)
+		sources = append(sources, SigningKeySourceRuntime)
+	}
+
+	return keys, sources
+}
+
+// Current returns the key that signs new URLs at the given time, which is the valid key whose validity window started
+// last, or nil if no key is valid.
+func (k *SigningKeys) Current(now time.Time) *ConfigSigningKey {
+	keys, _ := k.List()
+
+	var result *ConfigSigningKey
+
+	for i, key := range keys {
+		if !IsSigningKeyValid(key, now) {
+			continue
+		}
+
+		if result == nil || !signingKeyStart(key).Before(signingKeyStart(*result)) {
+			result = &keys[i]
+		}
+	}
+
+	return result
+}
+
+// Find returns the key with the given ID if it is valid at the given time, or nil otherwise. The legacy secret is the
+// key without an ID.
+func (k *SigningKeys) Find(id string, now time.Time) *ConfigSigningKey {
+	keys, _ := k.List()
+
+	for i, key := range keys {
+		if key.ID == id && IsSigningKeyValid(key, now) {
+			return &keys[i]
+		}
+	}
+
+	return nil
+}
+
+// States returns every signing key without its secret, marking the keys that are valid and the key that signs new
+// URLs at the given time.
+func (k *SigningKeys) States(now time.Time) []SigningKeyState {
+	keys, sources := k.List()
+	current := k.Current(now)
+
+	result := make([]SigningKeyState, 0, len(keys))
+
+	for i, key := range keys {
+		result = append(result, SigningKeyState{
+			ID:        key.ID,
+			Source:    sources[i],
+			NotBefore: key.NotBefore,
+			NotAfter:  key.NotAfter,
+			Valid:     IsSigningKeyValid(key, now),
+			Current:   current != nil && current.ID == key.ID,
+		})
+	}
+
+	return result
+}
+
+// Replace swaps the runtime keys with the given ones.
+func (k *SigningKeys) Replace(keys map[string]ConfigSigningKey) {
+	k.Mutex.Lock()
+
+	defer k.Mutex.Unlock()
+
+	k.Runtime = keys
+}
+
+// IsSigningKeyValid checks whether the time falls within the validity window of the key.
+func IsSigningKeyValid(key ConfigSigningKey, now time.Time) bool {
+	if key.NotBefore != nil && now.Before(*key.NotBefore) {
+		return false
+	}
+
+	return key.NotAfter == nil || now.Before(*key.NotAfter)
+}
+
+// signingKeyStart returns the start of the validity window of the key, which is the zero time if it has none.
+func signingKeyStart(key ConfigSigningKey) time.Time {
+	if key.NotBefore == nil {
+		return time.Time{}
+	}
+
+	return *key.NotBefore
+}
+
+// SignPath returns the path with a signature by the current signing key that is valid until the configured TTL has
+// elapsed, or until the validity window of the key ends if that is sooner.
+func SignPath(path string) (*SignedURL, error) {
+	parsedURL, err := url.Parse(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	key := signingKeys.Current(now)
+
+	if key == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	expiresAt := now.Add(config.SignedURLs.TTL).Unix()
+
+	if key.NotAfter != nil {
+		expiresAt = min(expiresAt, key.NotAfter.Unix())
+	}
+
+	query := parsedURL.Query()
+	query.Set("expires", strconv.FormatInt(expiresAt, 10))
+	query.Set("signature", ComputeSignature(key.Secret, parsedURL.Path, query, expiresAt))
+
+	// URLs signed by the legacy secret have no key parameter, so that the URLs signed before keys existed stay valid
+	if len(key.ID) > 0 {
+		query.Set("key", key.ID)
+	}
+
+	parsedURL.RawQuery = query.Encode()
+
+	return &SignedURL{
+		URL:       parsedURL.String(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// ComputeSignature returns the hex encoded HMAC of the path, query parameters and expiration time, so that none of
+// them can be changed without invalidating the signature.
+func ComputeSignature(secret, path string, query url.Values, expiresAt int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "\n" + CanonicalQuery(query) + "\n" + strconv.FormatInt(expiresAt, 10)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CanonicalQuery returns the query parameters sorted by name, leaving out the parameters added when signing.
+func CanonicalQuery(query url.Values) string {
+	result := make(url.Values, len(query))
+
+	for name, values := range query {
+		if name == "expires" || name == "signature" || name == "key" {
+			continue
+		}
+
+		result[name] = values
+	}
+
+	return result.Encode()
+}
+
+// VerifySignature checks that the signature in the query parameters is valid for the path and the other parameters,
+// has not yet expired and that the key that made it is still trusted.
+func VerifySignature(path string, query url.Values) bool {
+	expiresAt, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+
+	key := signingKeys.Find(query.Get("key"), time.Now())
+
+	if key == nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(query.Get("signature")), []byte(ComputeSignature(key.Secret, path, query, expiresAt)))
+}
+
+// VerifyRequestSignature checks that the URL of the request is signed, see VerifySignature.
+func VerifyRequestSignature(ctx *fiber.Ctx) bool {
+	query, err := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+
+	return err == nil && VerifySignature(ctx.Path(), query)
+}
+
+// RequireImageSignature is a middleware that rejects unsigned or expired requests to image routes when enabled.
+func RequireImageSignature(ctx *fiber.Ctx) error {
+	if !config.SignedURLs.RequireForImages {
+		return ctx.Next()
+	}
+
+	if !VerifyRequestSignature(ctx) {
+		return ctx.Status(http.StatusForbidden).SendString("Missing, invalid or expired URL signature")
+	}
+
+	return ctx.Next()
+}
+
+// RefreshSigningKeys reloads the runtime signing keys from Redis.
+func RefreshSigningKeys(ctx context.Context) error {
+	values, err := r.HashGetAll(ctx, signingKeysKey)
+
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]ConfigSigningKey)
+
+	for id, value := range values {
+		var key ConfigSigningKey
+
+		if err = json.Unmarshal([]byte(value), &key); err != nil {
+			return err
+		}
+
+		keys[id] = key
+	}
+
+	signingKeys.Replace(keys)
+
+	return nil
+}
+
+// SyncSigningKeys periodically reloads the runtime signing keys so that keys rotated through other instances are
+// trusted, until the context is done.
+func SyncSigningKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := RefreshSigningKeys(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to refresh signing keys: %v\n", err)
+		}
+	}
+}
+
+// RotateSigningKeys creates a new runtime signing key and schedules the end of the previous runtime keys. The new key
+// only starts signing once every instance has had the time to reload it, and the previous keys stay trusted for the
+// overlap after that, which should be at least the TTL of signed URLs so that the URLs signed by them stay valid.
+// Runtime keys whose validity window has ended are removed.
+func RotateSigningKeys(ctx context.Context, overlap time.Duration) (*ConfigSigningKey, error) {
+	if err := RefreshSigningKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	activeAt := now.Add(signingKeySyncInterval * 2)
+	retireAt := activeAt.Add(overlap)
+
+	signingKeys.Mutex.RLock()
+	previousKeys := signingKeys.Runtime
+	signingKeys.Mutex.RUnlock()
+
+	for id, key := range previousKeys {
+		if key.NotAfter != nil && !now.Before(*key.NotAfter) {
+			if _, err := r.HashDelete(ctx, signingKeysKey, id); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if key.NotAfter != nil && key.NotAfter.Before(retireAt) {
+			continue
+		}
+
+		key.NotAfter = PointerOf(retireAt)
+
+		data, err := json.Marshal(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = r.HashSet(ctx, signingKeysKey, id, data); err != nil {
+			return nil, err
+		}
+	}
+
+	key := ConfigSigningKey{
+		ID:        RandomHexString(8),
+		Secret:    RandomHexString(32),
+		NotBefore: PointerOf(activeAt),
+		NotAfter:  nil,
+	}
+
+	data, err := json.Marshal(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.HashSet(ctx, signingKeysKey, key.ID, data); err != nil {
+		return nil, err
+	}
+
+	if err = RefreshSigningKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// RevokeSigningKey removes the runtime signing key with the given ID, immediately invalidating the URLs signed by it.
+// It returns false if there is no such key.
+func RevokeSigningKey(ctx context.Context, id string) (bool, error) {
+	removed, err := r.HashDelete(ctx, signingKeysKey, id)
+
+	if err != nil {
+		return false, err
+	}
+
+	if err = RefreshSigningKeys(ctx); err != nil {
+		return false, err
+	}
+
+	return removed > 0, nil
+}
+
+// SignURLHandler returns a signed version of the path provided in the query parameters.
+func SignURLHandler(ctx *fiber.Ctx) error {
+	path := ctx.Query("path")
+
+	if len(path) < 1 {
+		return ctx.Status(http.StatusBadRequest).SendString("Missing 'path' query parameter")
+	}
+
+	result, err := SignPath(path)
+
+	if errors.Is(err, ErrNoSigningKey) {
+		return ctx.Status(http.StatusBadRequest).SendString("URL signing is not configured")
+	}
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'path' query parameter")
+	}
+
+	return ctx.JSON(result)
+}
+
+// ListSigningKeysHandler returns every trusted signing key without its secret.
+func ListSigningKeysHandler(ctx *fiber.Ctx) error {
+	return ctx.JSON(signingKeys.States(time.Now()))
+}
+
+// RotateSigningKeysHandler creates a new signing key for every instance, keeping the previous keys trusted for the
+// overlap in the query parameters, which defaults to the TTL of signed URLs.
+func RotateSigningKeysHandler(ctx *fiber.Ctx) error {
+	overlap, err := time.ParseDuration(ctx.Query("overlap", config.SignedURLs.TTL.String()))
+
+	if err != nil || overlap < 0 {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'overlap' query parameter")
+	}
+
+	key, err := RotateSigningKeys(ctx.UserContext(), overlap)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(SigningKeyState{
+		ID:        key.ID,
+		Source:    SigningKeySourceRuntime,
+		NotBefore: key.NotBefore,
+		NotAfter:  key.NotAfter,
+		Valid:     false,
+		Current:   false,
+	})
+}
+
+// RevokeSigningKeyHandler removes the runtime signing key with the ID in the parameters.
+func RevokeSigningKeyHandler(ctx *fiber.Ctx) error {
+	ok, err := RevokeSigningKey(ctx.UserContext(), ctx.Params("id"))
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ctx.Status(http.StatusNotFound).SendString("No runtime signing key exists with this ID")
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// useSigningKeys replaces the signing keys of the configuration and the runtime signing keys for the duration of the
+// test.
+func useSigningKeys(tb testing.TB, secret *string, keys []ConfigSigningKey) {
+	previous := config.SignedURLs
+
+	config.SignedURLs.Secret = secret
+	config.SignedURLs.Keys = keys
+
+	signingKeys.Replace(make(map[string]ConfigSigningKey))
+
+	tb.Cleanup(func() {
+		config.SignedURLs = previous
+
+		signingKeys.Replace(make(map[string]ConfigSigningKey))
+	})
+}
+
+func TestIsSigningKeyValid(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		Name  string
+		Key   ConfigSigningKey
+		Valid bool
+	}{
+		{"no window", ConfigSigningKey{}, true},
+		{"started", ConfigSigningKey{NotBefore: PointerOf(now.Add(-time.Minute))}, true},
+		{"not started", ConfigSigningKey{NotBefore: PointerOf(now.Add(time.Minute))}, false},
+		{"not ended", ConfigSigningKey{NotAfter: PointerOf(now.Add(time.Minute))}, true},
+		{"ended", ConfigSigningKey{NotAfter: PointerOf(now.Add(-time.Minute))}, false},
+		{"ends now", ConfigSigningKey{NotAfter: PointerOf(now)}, false},
+		{"within window", ConfigSigningKey{NotBefore: PointerOf(now.Add(-time.Minute)), NotAfter: PointerOf(now.Add(time.Minute))}, true},
+	}
+
+	for _, test := range tests {
+		if valid := IsSigningKeyValid(test.Key, now); valid != test.Valid {
+			t.Errorf("%s: IsSigningKeyValid = %v, expected %v", test.Name, valid, test.Valid)
+		}
+	}
+}
+
+func TestCurrentSigningKey(t *testing.T) {
+	now := time.Now()
+
+	useSigningKeys(t, PointerOf("legacy"), []ConfigSigningKey{
+		{ID: "old", Secret: "old", NotBefore: PointerOf(now.Add(-time.Hour * 2)), NotAfter: PointerOf(now.Add(time.Hour))},
+		{ID: "new", Secret: "new", NotBefore: PointerOf(now.Add(-time.Hour))},
+		{ID: "next", Secret: "next", NotBefore: PointerOf(now.Add(time.Hour))},
+	})
+
+	tests := []struct {
+		Name    string
+		Time    time.Time
+		Current string
+	}{
+		{"before every window", now.Add(-time.Hour * 3), ""},
+		{"first window", now.Add(-time.Hour*2 + time.Minute), "old"},
+		{"overlap", now, "new"},
+		{"next window", now.Add(time.Hour * 2), "next"},
+	}
+
+	for _, test := range tests {
+		if key := signingKeys.Current(test.Time); key == nil || key.ID != test.Current {
+			t.Errorf("%s: expected %q to be the current key, got %+v", test.Name, test.Current, key)
+		}
+	}
+
+	lookups := []struct {
+		ID    string
+		Found bool
+	}{
+		{"", true},
+		{"old", true},
+		{"new", true},
+		{"next", false},
+		{"unknown", false},
+	}
+
+	for _, test := range lookups {
+		if key := signingKeys.Find(test.ID, now); (key != nil) != test.Found {
+			t.Errorf("Find(%q) = %+v, expected found to be %v", test.ID, key, test.Found)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	useSigningKeys(t, nil, []ConfigSigningKey{
+		{ID: "key", Secret: "secret"},
+	})
+
+	signed, err := SignPath("/icon/example.com?size=64&format=png")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsedURL, err := url.Parse(signed.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// with returns the signed query parameters with the parameter changed
+	with := func(name, value string) url.Values {
+		result := parsedURL.Query()
+
+		result.Set(name, value)
+
+		return result
+	}
+
+	// without returns the signed query parameters without the parameter
+	without := func(name string) url.Values {
+		result := parsedURL.Query()
+
+		result.Del(name)
+
+		return result
+	}
+
+	expiredAt := time.Now().Add(-time.Minute).Unix()
+	expired := with("expires", strconv.FormatInt(expiredAt, 10))
+
+	expired.Set("signature", ComputeSignature("secret", "/icon/example.com", expired, expiredAt))
+
+	tests := []struct {
+		Name  string
+		Path  string
+		Query url.Values
+		Valid bool
+	}{
+		{"signed", "/icon/example.com", parsedURL.Query(), true},
+		{"other path", "/icon/example.org", parsedURL.Query(), false},
+		{"other size", "/icon/example.com", with("size", "512"), false},
+		{"other format", "/icon/example.com", with("format", "webp"), false},
+		{"added parameter", "/icon/example.com", with("bypass_cache", "true"), false},
+		{"removed parameter", "/icon/example.com", without("size"), false},
+		{"other expiry", "/icon/example.com", with("expires", parsedURL.Query().Get("expires")+"0"), false},
+		{"unknown key", "/icon/example.com", with("key", "unknown"), false},
+		{"missing key", "/icon/example.com", without("key"), false},
+		{"expired", "/icon/example.com", expired, false},
+		{"invalid expiry", "/icon/example.com", with("expires", "soon"), false},
+		{"missing signature", "/icon/example.com", without("signature"), false},
+	}
+
+	for _, test := range tests {
+		if valid := VerifySignature(test.Path, test.Query); valid != test.Valid {
+			t.Errorf("%s: VerifySignature = %v, expected %v", test.Name, valid, test.Valid)
+		}
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	first, _ := url.ParseQuery("size=64&format=png&expires=1&signature=abc&key=key")
+	second, _ := url.ParseQuery("format=png&key=other&size=64")
+
+	if CanonicalQuery(first) != "format=png&size=64" || CanonicalQuery(first) != CanonicalQuery(second) {
+		t.Errorf("expected equal canonical queries, got %q and %q", CanonicalQuery(first), CanonicalQuery(second))
+	}
+}
+
+func TestRotateSigningKeys(t *testing.T) {
+	useTestRedis(t)
+	useSigningKeys(t, nil, nil)
+
+	first, err := RotateSigningKeys(context.Background(), time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := RotateSigningKeys(context.Background(), time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activeAt := *second.NotBefore
+	retireAt := activeAt.Add(time.Hour)
+
+	// The first key keeps signing until every instance has loaded the second key, then both are trusted for the overlap
+	tests := []struct {
+		Name    string
+		Time    time.Time
+		Current string
+		Trusted []string
+	}{
+		{"before the second key is active", *first.NotBefore, first.ID, []string{first.ID}},
+		{"during the overlap", activeAt.Add(time.Minute), second.ID, []string{first.ID, second.ID}},
+		{"after the overlap", retireAt.Add(time.Minute), second.ID, []string{second.ID}},
+	}
+
+	for _, test := range tests {
+		if key := signingKeys.Current(test.Time); key == nil || key.ID != test.Current {
+			t.Errorf("%s: expected %s to be the current key, got %+v", test.Name, test.Current, key)
+		}
+
+		trusted := make([]string, 0)
+
+		for _, id := range []string{first.ID, second.ID} {
+			if signingKeys.Find(id, test.Time) != nil {
+				trusted = append(trusted, id)
+			}
+		}
+
+		if fmt.Sprint(trusted) != fmt.Sprint(test.Trusted) {
+			t.Errorf("%s: expected %v to be trusted, got %v", test.Name, test.Trusted, trusted)
+		}
+	}
+
+	if removed, err := RevokeSigningKey(context.Background(), second.ID); err != nil || !removed {
+		t.Fatalf("RevokeSigningKey = %v, %v", removed, err)
+	}
+
+	if signingKeys.Find(second.ID, retireAt.Add(time.Minute)) != nil {
+		t.Error("expected the revoked key to no longer be trusted")
+	}
+}
+
+func TestRequireImageSignature(t *testing.T) {
+	useSigningKeys(t, nil, []ConfigSigningKey{
+		{ID: "key", Secret: "secret"},
+	})
+
+	config.SignedURLs.RequireForImages = true
+
+	app := fiber.New()
+
+	app.Get("/icon/:address", RequireImageSignature, func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	signed, err := SignPath("/icon/example.com?size=64")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		URL    string
+		Status int
+	}{
+		{signed.URL, fiber.StatusOK},
+		{strings.Replace(signed.URL, "size=64", "size=512", 1), fiber.StatusForbidden},
+		{signed.URL + "&format=webp", fiber.StatusForbidden},
+		{"/icon/example.com?size=64", fiber.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", test.URL, nil))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != test.Status {
+			t.Errorf("%s: expected status %d, got %d", test.URL, test.Status, resp.StatusCode)
+		}
+	}
+}
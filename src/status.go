@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"main/src/assets"
 	"net"
 	"strconv"
@@ -14,28 +16,64 @@ import (
 
 	"github.com/mcstatus-io/mcutil/v4/formatting"
 	"github.com/mcstatus-io/mcutil/v4/options"
-	"github.com/mcstatus-io/mcutil/v4/query"
 	"github.com/mcstatus-io/mcutil/v4/response"
 	"github.com/mcstatus-io/mcutil/v4/status"
 	"github.com/mcstatus-io/mcutil/v4/util"
 )
 
+const (
+	// nilUUID is the UUID used by sample players that do not represent a real player.
+	nilUUID = "00000000-0000-0000-0000-000000000000"
+	// anonymousPlayerName is the name vanilla servers give to sample players when player listing is hidden.
+	anonymousPlayerName = "Anonymous Player"
+)
+
 // BaseStatus is the base response properties for returning any status response from the API.
 type BaseStatus struct {
-	Online      bool    `json:"online"`
-	Host        string  `json:"host"`
-	Port        uint16  `json:"port"`
-	IPAddress   *string `json:"ip_address"`
-	EULABlocked bool    `json:"eula_blocked"`
-	RetrievedAt int64   `json:"retrieved_at"`
-	ExpiresAt   int64   `json:"expires_at"`
+	Online      bool               `json:"online"`
+	Host        string             `json:"host"`
+	Port        uint16             `json:"port"`
+	PortSource  string             `json:"port_source"`
+	IPAddress   *string            `json:"ip_address"`
+	ReverseDNS  *string            `json:"reverse_dns"`
+	EULABlocked bool               `json:"eula_blocked"`
+	Confidence  float64            `json:"confidence"`
+	RetrievedAt int64              `json:"retrieved_at"`
+	ExpiresAt   int64              `json:"expires_at"`
+	CacheHit    bool               `json:"cache_hit"`
+	Deprecation *DeprecationNotice `json:"deprecation,omitempty"`
+	Meta        *ServerMeta        `json:"meta,omitempty"`
+}
+
+// Base returns the base status properties, allowing both editions to be handled by the same code.
+func (b *BaseStatus) Base() *BaseStatus {
+	return b
+}
+
+// SetCacheResult sets whether the status was served from cache, and the time the cached status expires at. The
+// expiry is taken from the cache rather than from the stored status, since the cache duration depends on the tenant.
+func (b *BaseStatus) SetCacheResult(result CacheResult) {
+	b.CacheHit = result.Hit
+	b.ExpiresAt = time.Now().Add(result.TTL).UnixMilli()
 }
 
 // JavaStatusResponse is the combined response of the root response and the Java Edition status response.
 type JavaStatusResponse struct {
 	BaseStatus
 	SRVRecord *SRVRecord `json:"srv_record"`
+	Fronting  *Fronting  `json:"fronting"`
 	*JavaStatus
+	Raw RawJSON `json:"raw,omitempty"`
+}
+
+// SetPortSource sets where the port of the server was taken from. The port of the SRV record is reported instead of the
+// default port when the SRV record was followed.
+func (r *JavaStatusResponse) SetPortSource(portSource string) {
+	r.PortSource = portSource
+
+	if portSource == PortSourceDefault && r.SRVRecord != nil {
+		r.PortSource, r.Port = PortSourceSRV, r.SRVRecord.Port
+	}
 }
 
 // JavaStatus is the status response properties for Java Edition.
@@ -57,12 +95,13 @@ type BedrockStatusResponse struct {
 
 // BedrockStatus is the status response properties for Bedrock Edition.
 type BedrockStatus struct {
-	Version  *BedrockVersion `json:"version"`
-	Players  *BedrockPlayers `json:"players"`
-	MOTD     *MOTD           `json:"motd"`
-	Gamemode *string         `json:"gamemode"`
-	ServerID *string         `json:"server_id"`
-	Edition  *string         `json:"edition"`
+	Version       *BedrockVersion `json:"version"`
+	Players       *BedrockPlayers `json:"players"`
+	MOTD          *MOTD           `json:"motd"`
+	Gamemode      *string         `json:"gamemode"`
+	ServerID      *string         `json:"server_id"`
+	Edition       *string         `json:"edition"`
+	FieldsMissing []string        `json:"fields_missing,omitempty"`
 }
 
 // JavaVersion holds the properties for the version of Java Edition responses.
@@ -81,9 +120,10 @@ type BedrockVersion struct {
 
 // JavaPlayers holds the properties for the players of Java Edition responses.
 type JavaPlayers struct {
-	Online *int64   `json:"online"`
-	Max    *int64   `json:"max"`
-	List   []Player `json:"list"`
+	Online     *int64   `json:"online"`
+	Max        *int64   `json:"max"`
+	List       []Player `json:"list"`
+	ListHidden bool     `json:"list_hidden"`
 }
 
 // BedrockPlayers holds the properties for the players of Bedrock Edition responses.
@@ -102,9 +142,10 @@ type Player struct {
 
 // MOTD is a group of formatted and unformatted properties for status responses.
 type MOTD struct {
-	Raw   string `json:"raw"`
-	Clean string `json:"clean"`
-	HTML  string `json:"html"`
+	Raw        string  `json:"raw"`
+	Clean      string  `json:"clean"`
+	HTML       string  `json:"html"`
+	Translated *string `json:"translated,omitempty"`
 }
 
 // Mod is a single Forge mod installed on any Java Edition status response.
@@ -121,167 +162,253 @@ type Plugin struct {
 
 // SRVRecord is the result of the SRV lookup performed during status retrieval
 type SRVRecord struct {
-	Host string `json:"host"`
-	Port uint16 `json:"port"`
+	Host string  `json:"host"`
+	Port uint16  `json:"port"`
+	TTL  *uint32 `json:"ttl"`
 }
 
 // GetJavaStatus returns the status response of a Java Edition server, either using cache or fetching a fresh status.
-func GetJavaStatus(hostname string, port uint16, opts *StatusOptions) (*JavaStatusResponse, time.Duration, error) {
-	cacheKey := GetCacheKey(hostname, port, opts)
+func GetJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*JavaStatusResponse, CacheResult, error) {
+	key := fmt.Sprintf("java:%s", GetCacheKey(hostname, port, opts))
 
-	// Wait for any other processes to finish fetching the status of this server
-	if config.Cache.EnableLocks {
-		mutex := r.NewMutex(fmt.Sprintf("java-lock:%s", cacheKey))
-		mutex.Lock()
+	cache, result, err := cacheStore.GetOrSet(ctx, key, func() ([]byte, error) {
+		RecordExperimentProbe("java", hostname, port)
 
-		defer mutex.Unlock()
-	}
-
-	// Fetch the cached status if it exists
-	{
-		cache, ttl, err := r.Get(fmt.Sprintf("java:%s", cacheKey))
+		response, err := FetchJavaStatus(ctx, hostname, port, opts)
 
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 
-		if cache != nil {
-			var response JavaStatusResponse
+		return json.Marshal(response)
+	}, opts.TargetCacheDuration("java", hostname, port), opts.CacheValidator("java"))
 
-			err = json.Unmarshal(cache, &response)
+	if err != nil {
+		return nil, result, err
+	}
 
-			return &response, ttl, err
-		}
+	RecordExperimentLookup("java", hostname, port, result)
+
+	if !result.Hit {
+		RecordCacheEntrySize(ctx, key, hostname, port, len(cache))
 	}
 
-	// Fetch a fresh status from the server itself
-	{
-		response, err := FetchJavaStatus(hostname, port, opts)
+	var response JavaStatusResponse
 
-		if err != nil {
-			return nil, 0, err
-		}
+	return &response, result, json.Unmarshal(cache, &response)
+}
+
+// GetBedrockStatus returns the status response of a Bedrock Edition server, either using cache or fetching a fresh status.
+func GetBedrockStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*BedrockStatusResponse, CacheResult, error) {
+	key := fmt.Sprintf("bedrock:%s", GetCacheKey(hostname, port, nil))
+
+	cache, result, err := cacheStore.GetOrSet(ctx, key, func() ([]byte, error) {
+		RecordExperimentProbe("bedrock", hostname, port)
 
-		data, err := json.Marshal(response)
+		response, err := FetchBedrockStatus(ctx, hostname, port, opts)
 
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 
-		if err := r.Set(fmt.Sprintf("java:%s", cacheKey), data, config.Cache.JavaStatusDuration); err != nil {
-			return nil, 0, err
-		}
+		return json.Marshal(response)
+	}, opts.TargetCacheDuration("bedrock", hostname, port), opts.CacheValidator("bedrock"))
+
+	if err != nil {
+		return nil, result, err
+	}
+
+	RecordExperimentLookup("bedrock", hostname, port, result)
 
-		return response, 0, nil
+	if !result.Hit {
+		RecordCacheEntrySize(ctx, key, hostname, port, len(cache))
 	}
+
+	var response BedrockStatusResponse
+
+	return &response, result, json.Unmarshal(cache, &response)
 }
 
-// GetBedrockStatus returns the status response of a Bedrock Edition server, either using cache or fetching a fresh status.
-func GetBedrockStatus(hostname string, port uint16, opts *StatusOptions) (*BedrockStatusResponse, time.Duration, error) {
-	cacheKey := GetCacheKey(hostname, port, nil)
+// GetServerIcon returns the icon image of a Java Edition server, either using cache or fetching a fresh image.
+func GetServerIcon(ctx context.Context, hostname string, port uint16, opts *StatusOptions) ([]byte, CacheResult, error) {
+	key := fmt.Sprintf("icon:%s", GetCacheKey(hostname, port, nil))
 
-	// Wait for any other processes to finish fetching the status of this server
-	if config.Cache.EnableLocks {
-		mutex := r.NewMutex(fmt.Sprintf("bedrock-lock:%s", cacheKey))
-		mutex.Lock()
+	icon, result, err := cacheStore.GetOrSet(ctx, key, func() ([]byte, error) {
+		if config.Cache.IconFromStatus && !opts.BypassCache {
+			icon, ok, err := GetCachedJavaIcon(ctx, hostname, port)
 
-		defer mutex.Unlock()
-	}
+			if err != nil || ok {
+				return icon, err
+			}
+		}
 
-	// Fetch the cached status if it exists
-	{
-		cache, ttl, err := r.Get(fmt.Sprintf("bedrock:%s", cacheKey))
+		RecordExperimentProbe("icon", hostname, port)
+
+		probe, err := ProbeJavaStatus(ctx, hostname, port, &StatusOptions{
+			Query:             false,
+			Timeout:           opts.Timeout,
+			Trigger:           opts.Trigger,
+			SkipProbeInterval: opts.SkipProbeInterval,
+		})
 
 		if err != nil {
-			return nil, 0, err
+			return nil, err
 		}
 
-		if cache != nil {
-			var response BedrockStatusResponse
+		if status := probe.Status; status != nil && status.Favicon != nil && strings.HasPrefix(*status.Favicon, "data:image/png;base64,") {
+			return base64.StdEncoding.DecodeString(strings.TrimPrefix(*status.Favicon, "data:image/png;base64,"))
+		}
 
-			err = json.Unmarshal(cache, &response)
+		return assets.DefaultIcon, nil
+	}, opts.TargetCacheDuration("icon", hostname, port), opts.BypassCacheValidator())
 
-			return &response, ttl, err
-		}
+	if err == nil {
+		RecordExperimentLookup("icon", hostname, port, result)
 	}
 
-	// Fetch a fresh status from the server itself
-	{
-		response, err := FetchBedrockStatus(hostname, port, opts)
+	if err == nil && !result.Hit {
+		RecordCacheEntrySize(ctx, key, hostname, port, len(icon))
+	}
+
+	return icon, result, err
+}
+
+// GetCachedJavaIcon returns the icon from the cached Java Edition status of the server, or false if no status is
+// cached. The default icon is returned if the cached status has no icon.
+func GetCachedJavaIcon(ctx context.Context, hostname string, port uint16) ([]byte, bool, error) {
+	for _, query := range []bool{false, true} {
+		cache, _, err := cacheStore.Get(ctx, fmt.Sprintf("java:%s", GetCacheKey(hostname, port, &StatusOptions{Query: query})))
 
 		if err != nil {
-			return nil, 0, err
+			return nil, false, err
 		}
 
-		data, err := json.Marshal(response)
+		if cache == nil {
+			continue
+		}
 
-		if err != nil {
-			return nil, 0, err
+		var response JavaStatusResponse
+
+		if err = json.Unmarshal(cache, &response); err != nil {
+			return nil, false, err
 		}
 
-		if err = r.Set(fmt.Sprintf("bedrock:%s", cacheKey), data, config.Cache.BedrockStatusDuration); err != nil {
-			return nil, 0, err
+		if response.JavaStatus != nil && response.Icon != nil && strings.HasPrefix(*response.Icon, "data:image/png;base64,") {
+			icon, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*response.Icon, "data:image/png;base64,"))
+
+			return icon, err == nil, err
 		}
 
-		return response, 0, nil
+		return assets.DefaultIcon, true, nil
 	}
+
+	return nil, false, nil
 }
 
-// GetServerIcon returns the icon image of a Java Edition server, either using cache or fetching a fresh image.
-func GetServerIcon(hostname string, port uint16, opts *StatusOptions) ([]byte, time.Duration, error) {
-	cacheKey := GetCacheKey(hostname, port, nil)
+// JavaProbeResult is the unprocessed result of every probe made against a Java Edition server.
+type JavaProbeResult struct {
+	Status       *response.StatusModern `json:"status"`
+	LegacyStatus *response.StatusLegacy `json:"legacy_status"`
+	Query        *response.QueryFull    `json:"query"`
+	SRVRecord    *net.SRV               `json:"srv_record"`
+	SRVTTL       *uint32                `json:"srv_ttl"`
+	IPAddress    *string                `json:"ip_address"`
+	ReverseDNS   *string                `json:"reverse_dns"`
+	Fronting     *Fronting              `json:"fronting"`
+}
 
-	// Fetch the cached icon if it exists
-	{
-		cache, ttl, err := r.Get(fmt.Sprintf("icon:%s", cacheKey))
+// BedrockProbeResult is the unprocessed result of the probe made against a Bedrock Edition server.
+type BedrockProbeResult struct {
+	Status     *response.StatusBedrock `json:"status"`
+	IPAddress  *string                 `json:"ip_address"`
+	ReverseDNS *string                 `json:"reverse_dns"`
+}
 
-		if err != nil {
-			return nil, 0, err
-		}
+// FetchJavaStatus fetches fresh information about a Java Edition Minecraft server.
+func FetchJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*JavaStatusResponse, error) {
+	result, err := fetchJavaStatus(ctx, hostname, port, opts)
 
-		if cache != nil {
-			return cache, ttl, err
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	var (
-		icon []byte = nil
-	)
+	result, err = ConfirmOffline(ctx, "java", hostname, port, result, func() (*JavaStatusResponse, error) {
+		return fetchJavaStatus(ctx, hostname, port, opts.WithSkipProbeInterval())
+	})
 
-	// Fetch the icon from the server itself
-	{
-		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	if err == nil {
+		PublishStatusEvents(ctx, "java", hostname, port, result)
+	}
 
-		defer cancel()
+	return result, err
+}
+
+func fetchJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*JavaStatusResponse, error) {
+	probe, err := ProbeJavaStatus(ctx, hostname, port, opts)
 
-		status, err := status.Modern(ctx, hostname, port)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := BuildJavaResponse(hostname, port, probe.Status, probe.LegacyStatus, probe.Query, probe.SRVRecord, probe.IPAddress)
+
+	if err != nil {
+		return nil, err
+	}
 
-		if err == nil && status.Favicon != nil && strings.HasPrefix(*status.Favicon, "data:image/png;base64,") {
-			data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*status.Favicon, "data:image/png;base64,"))
+	result.ReverseDNS = probe.ReverseDNS
+	result.Fronting = probe.Fronting
+
+	if result.SRVRecord != nil {
+		result.SRVRecord.TTL = probe.SRVTTL
+	}
+
+	return result, nil
+}
+
+// ProbeJavaStatus performs all of the network requests needed to build a Java Edition status response.
+// An error is only returned if the lookup was cancelled before it could finish.
+func ProbeJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*JavaProbeResult, error) {
+	return CoordinateProbe(ctx, "java", GetCacheKey(hostname, port, opts), opts.SkipProbeInterval, func(ctx context.Context) (*JavaProbeResult, error) {
+		if role == RoleAPI {
+			result, err := EnqueueProbe(ctx, "java", hostname, port, opts)
 
 			if err != nil {
-				return nil, 0, err
+				return nil, err
 			}
 
-			icon = data
-		} else {
-			icon = assets.DefaultIcon
+			return result.Java, nil
 		}
+
+		return probeJavaStatus(ctx, hostname, port, opts)
+	})
+}
+
+func probeJavaStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*JavaProbeResult, error) {
+	ctx, done := inflight.Start(ctx, "java", hostname, port, opts.Trigger)
+
+	defer done()
+
+	tarpit, err := IsTarpit(ctx, "java", hostname, port)
+
+	if err != nil {
+		return nil, err
 	}
 
-	// Put the icon into the cache for future requests
-	if err := r.Set(fmt.Sprintf("icon:%s", cacheKey), icon, config.Cache.IconDuration); err != nil {
-		return nil, 0, err
+	// A server detected as a tarpit would tie up the probe until it times out, so it is reported offline right away
+	if tarpit {
+		tarpitSkips.WithLabelValues("java").Inc()
+
+		return &JavaProbeResult{}, nil
 	}
 
-	return icon, 0, nil
-}
+	trace := StartProbeTrace(ctx, "java", hostname, port)
+	shadow := StartShadowLookup(ctx, "java", hostname, port, opts)
 
-// FetchJavaStatus fetches fresh information about a Java Edition Minecraft server.
-func FetchJavaStatus(hostname string, port uint16, opts *StatusOptions) (*JavaStatusResponse, error) {
 	var (
-		err                error
+		statusErr          error
 		srvRecord          *net.SRV
+		srvTTL             *uint32
 		resolvedHostname   string = hostname
 		ipAddress          *string
 		statusResult       *response.StatusModern
@@ -299,9 +426,13 @@ func FetchJavaStatus(hostname string, port uint16, opts *StatusOptions) (*JavaSt
 		}
 	}
 
-	// Lookup the SRV record
-	{
-		srvRecord, err = util.LookupSRV(hostname)
+	// Lookup the SRV record, which is only followed for the default port, as it is by the game
+	if port == util.DefaultJavaPort && net.ParseIP(hostname) == nil {
+		start := time.Now()
+
+		srvRecord, srvTTL, err = LookupSRV(ctx, hostname)
+
+		trace.Step("srv", start, err)
 
 		if err == nil && srvRecord != nil {
 			resolvedHostname = strings.Trim(srvRecord.Target, ".")
@@ -310,16 +441,18 @@ func FetchJavaStatus(hostname string, port uint16, opts *StatusOptions) (*JavaSt
 
 	// Resolve the connection hostname to an IP address
 	{
-		addr, err := net.ResolveIPAddr("ip", resolvedHostname)
+		ipAddress = ResolveIPAddress(ctx, resolvedHostname)
+	}
 
-		if err == nil && addr != nil {
-			ipAddress = PointerOf(addr.IP.String())
-		}
+	connectionHostname, connectionPort := hostname, port
+
+	if srvRecord != nil {
+		connectionHostname, connectionPort = resolvedHostname, srvRecord.Port
 	}
 
-	statusContext, statusCancel := context.WithTimeout(context.Background(), opts.Timeout)
-	legacyContext, legacyCancel := context.WithTimeout(context.Background(), opts.Timeout)
-	queryContext, queryCancel := context.WithTimeout(context.Background(), opts.Timeout)
+	statusContext, statusCancel := context.WithTimeout(ctx, opts.Timeout)
+	legacyContext, legacyCancel := context.WithTimeout(ctx, opts.Timeout)
+	queryContext, queryCancel := context.WithTimeout(ctx, opts.Timeout)
 
 	defer statusCancel()
 	defer legacyCancel()
@@ -328,13 +461,16 @@ func FetchJavaStatus(hostname string, port uint16, opts *StatusOptions) (*JavaSt
 	// Retrieve the post-netty rewrite Java Edition status (Minecraft 1.8+)
 	{
 		go func() {
-			statusResult, _ = status.Modern(statusContext, hostname, port, options.StatusModern{
-				EnableSRV:       true,
-				Timeout:         opts.Timeout - time.Millisecond*100,
-				ProtocolVersion: -1,
-				Ping:            true,
+			start := time.Now()
+
+			statusResult, statusErr = RecoverProtocol("status", hostname, port, func() (*response.StatusModern, error) {
+				result, _, err := PingJava(statusContext, hostname, port, net.JoinHostPort(connectionHostname, strconv.Itoa(int(connectionPort))))
+
+				return result, err
 			})
 
+			trace.Step("status", start, statusErr)
+
 			wg.Done()
 
 			legacyCancel()
@@ -352,12 +488,27 @@ func FetchJavaStatus(hostname string, port uint16, opts *StatusOptions) (*JavaSt
 	// Retrieve the pre-netty rewrite Java Edition status (Minecraft 1.7 and below)
 	{
 		go func() {
-			legacyStatusResult, _ = status.Legacy(legacyContext, hostname, port, options.StatusLegacy{
-				EnableSRV:       true,
-				Timeout:         opts.Timeout - time.Millisecond*100,
-				ProtocolVersion: -1,
+			start := time.Now()
+
+			var err error
+
+			legacyStatusResult, err = RecoverProtocol("legacy_status", hostname, port, func() (*response.StatusLegacy, error) {
+				// The legacy ping does not send the hostname, so it connects to the checked address of the target
+				address, err := ResolveTarget(legacyContext, connectionHostname)
+
+				if err != nil {
+					return nil, err
+				}
+
+				return status.Legacy(legacyContext, address, connectionPort, options.StatusLegacy{
+					EnableSRV:       false,
+					Timeout:         opts.Timeout - time.Millisecond*100,
+					ProtocolVersion: -1,
+				})
 			})
 
+			trace.Step("legacy_status", start, err)
+
 			wg.Done()
 
 			time.Sleep(time.Millisecond * 250)
@@ -371,45 +522,253 @@ func FetchJavaStatus(hostname string, port uint16, opts *StatusOptions) (*JavaSt
 	// Retrieve the query information (if it is available)
 	if opts.Query {
 		go func() {
-			queryResult, _ = query.Full(queryContext, hostname, port, options.Query{
-				Timeout: opts.Timeout - time.Millisecond*100,
+			start := time.Now()
+
+			var err error
+
+			queryResult, err = RecoverProtocol("query", hostname, port, func() (*response.QueryFull, error) {
+				return QueryFull(queryContext, hostname, port, opts.Timeout-time.Millisecond*100)
 			})
 
+			trace.Step("query", start, err)
+
 			wg.Done()
 		}()
 	}
 
 	wg.Wait()
 
-	return BuildJavaResponse(hostname, port, statusResult, legacyStatusResult, queryResult, srvRecord, ipAddress)
+	var (
+		reverseDNS *string   = LookupReverseDNS(ctx, hostname)
+		fronting   *Fronting = nil
+	)
+
+	// Detect any TLS terminating proxy in front of the server
+	if srvRecord != nil {
+		fronting = DetectFronting(ctx, hostname, resolvedHostname, srvRecord.Port)
+	} else {
+		fronting = DetectFronting(ctx, hostname, hostname, port)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &JavaProbeResult{
+		Status:       statusResult,
+		LegacyStatus: legacyStatusResult,
+		Query:        queryResult,
+		SRVRecord:    srvRecord,
+		SRVTTL:       srvTTL,
+		IPAddress:    ipAddress,
+		ReverseDNS:   reverseDNS,
+		Fronting:     fronting,
+	}
+
+	if statusResult == nil && legacyStatusResult == nil {
+		trace.CheckICMP(ctx, ipAddress)
+
+		if errors.Is(statusErr, ErrTarpit) {
+			if err := FlagTarpit(ctx, "java", hostname, port); err != nil {
+				log.Printf("Failed to flag %s:%d as a tarpit: %v\n", hostname, port, err)
+			}
+		}
+	}
+
+	shadow.Compare(SummarizeJavaStatus(statusResult))
+	trace.Finish(ctx, result)
+
+	return result, nil
 }
 
 // FetchBedrockStatus fetches a fresh status of a Bedrock Edition server.
-func FetchBedrockStatus(hostname string, port uint16, opts *StatusOptions) (*BedrockStatusResponse, error) {
+func FetchBedrockStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*BedrockStatusResponse, error) {
+	result, err := fetchBedrockStatus(ctx, hostname, port, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = ConfirmOffline(ctx, "bedrock", hostname, port, result, func() (*BedrockStatusResponse, error) {
+		return fetchBedrockStatus(ctx, hostname, port, opts.WithSkipProbeInterval())
+	})
+
+	if err == nil {
+		PublishStatusEvents(ctx, "bedrock", hostname, port, result)
+	}
+
+	return result, err
+}
+
+func fetchBedrockStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*BedrockStatusResponse, error) {
+	probe, err := ProbeBedrockStatus(ctx, hostname, port, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := BuildBedrockResponse(hostname, port, probe.Status, probe.IPAddress)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response.ReverseDNS = probe.ReverseDNS
+
+	return response, nil
+}
+
+// ProbeBedrockStatus performs the network requests needed to build a Bedrock Edition status response.
+// An error is only returned if the lookup was cancelled before it could finish.
+func ProbeBedrockStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*BedrockProbeResult, error) {
+	return CoordinateProbe(ctx, "bedrock", GetCacheKey(hostname, port, nil), opts.SkipProbeInterval, func(ctx context.Context) (*BedrockProbeResult, error) {
+		if role == RoleAPI {
+			result, err := EnqueueProbe(ctx, "bedrock", hostname, port, opts)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Bedrock, nil
+		}
+
+		return probeBedrockStatus(ctx, hostname, port, opts)
+	})
+}
+
+func probeBedrockStatus(ctx context.Context, hostname string, port uint16, opts *StatusOptions) (*BedrockProbeResult, error) {
+	ctx, done := inflight.Start(ctx, "bedrock", hostname, port, opts.Trigger)
+
+	defer done()
+
+	trace := StartProbeTrace(ctx, "bedrock", hostname, port)
+	shadow := StartShadowLookup(ctx, "bedrock", hostname, port, opts)
+
 	var (
+		err       error
 		ipAddress *string
 		result    *response.StatusBedrock
 	)
 
 	// Resolve the connection hostname to an IP address
 	{
-		ipAddr, err := net.ResolveIPAddr("ip", hostname)
-
-		if err == nil && ipAddr != nil {
-			ipAddress = PointerOf(ipAddr.IP.String())
-		}
+		ipAddress = ResolveIPAddress(ctx, hostname)
 	}
 
 	// Retrieve the Bedrock Edition status
 	{
-		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+		ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
 
 		defer cancel()
 
-		result, _ = status.Bedrock(ctx, hostname, port)
+		start := time.Now()
+
+		result, err = RecoverProtocol("bedrock_status", hostname, port, func() (*response.StatusBedrock, error) {
+			return PingBedrock(ctx, hostname, port)
+		})
+
+		trace.Step("bedrock_status", start, err)
+	}
+
+	reverseDNS := LookupReverseDNS(ctx, hostname)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	probeResult := &BedrockProbeResult{
+		Status:     result,
+		IPAddress:  ipAddress,
+		ReverseDNS: reverseDNS,
+	}
+
+	if result == nil {
+		trace.CheckICMP(ctx, ipAddress)
+	}
+
+	shadow.Compare(SummarizeBedrockStatus(result))
+	trace.Finish(ctx, probeResult)
+
+	return probeResult, nil
+}
+
+// ConfirmOffline re-probes a server that was online during a recent lookup before accepting an offline result, and
+// only reports it as offline if a quorum of the re-probes also fail. The confidence of the result is the fraction of
+// all probes that agreed with the returned verdict.
+func ConfirmOffline[T interface{ Base() *BaseStatus }](ctx context.Context, edition, hostname string, port uint16, result T, fetch func() (T, error)) (T, error) {
+	onlineKey := fmt.Sprintf("%s-online:%s", edition, GetCacheKey(hostname, port, nil))
+
+	// Servers are only remembered as online while offline results are being confirmed
+	if config.Lookup.OfflineReprobes < 1 {
+		return result, nil
+	}
+
+	if result.Base().Online {
+		markRecentlyOnline(ctx, onlineKey)
+
+		return result, nil
+	}
+
+	wasOnline, _, err := r.Get(ctx, onlineKey)
+
+	if err != nil {
+		log.Printf("Failed to check whether %s:%d was recently online: %v\n", hostname, port, err)
+
+		return result, nil
+	}
+
+	if wasOnline == nil {
+		return result, nil
+	}
+
+	var (
+		failures uint
+		probes   uint = 1
+		online   T
+		found    bool
+	)
+
+	for i := uint(0); i < config.Lookup.OfflineReprobes && failures < config.Lookup.OfflineQuorum; i++ {
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(config.Lookup.OfflineReprobeDelay):
+		}
+
+		reprobe, err := fetch()
+
+		if err != nil {
+			return result, err
+		}
+
+		probes++
+
+		if !reprobe.Base().Online {
+			failures++
+
+			continue
+		}
+
+		if !found {
+			online, found = reprobe, true
+		}
+
+		if config.Lookup.OfflineReprobes-(i+1) < config.Lookup.OfflineQuorum-failures {
+			break
+		}
+	}
+
+	if failures >= config.Lookup.OfflineQuorum || !found {
+		result.Base().Confidence = float64(failures+1) / float64(probes)
+
+		return result, nil
 	}
 
-	return BuildBedrockResponse(hostname, port, result, ipAddress)
+	online.Base().Confidence = float64(probes-failures-1) / float64(probes)
+
+	markRecentlyOnline(ctx, onlineKey)
+
+	return online, nil
 }
 
 // BuildJavaResponse builds the response data from the status and query information.
@@ -421,6 +780,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 			Port:        port,
 			IPAddress:   ipAddress,
 			EULABlocked: IsBlockedAddress(hostname),
+			Confidence:  1,
 			RetrievedAt: time.Now().UnixMilli(),
 			ExpiresAt:   time.Now().Add(config.Cache.JavaStatusDuration).UnixMilli(),
 		},
@@ -435,7 +795,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 			Version: &JavaVersion{
 				NameRaw:   status.Version.Name.Raw,
 				NameClean: status.Version.Name.Clean,
-				NameHTML:  status.Version.Name.HTML,
+				NameHTML:  ApplyColorPalette(status.Version.Name.HTML),
 				Protocol:  status.Version.Protocol,
 			},
 			Players: JavaPlayers{
@@ -446,7 +806,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 			MOTD: MOTD{
 				Raw:   status.MOTD.Raw,
 				Clean: status.MOTD.Clean,
-				HTML:  status.MOTD.HTML,
+				HTML:  ApplyColorPalette(status.MOTD.HTML),
 			},
 			Icon:    nil,
 			Mods:    make([]Mod, 0),
@@ -459,7 +819,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 					UUID:      player.ID,
 					NameRaw:   player.Name.Raw,
 					NameClean: player.Name.Clean,
-					NameHTML:  player.Name.HTML,
+					NameHTML:  ApplyColorPalette(player.Name.HTML),
 				})
 			}
 		}
@@ -489,7 +849,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 			MOTD: MOTD{
 				Raw:   legacyStatus.MOTD.Raw,
 				Clean: legacyStatus.MOTD.Clean,
-				HTML:  legacyStatus.MOTD.HTML,
+				HTML:  ApplyColorPalette(legacyStatus.MOTD.HTML),
 			},
 			Icon:    nil,
 			Mods:    make([]Mod, 0),
@@ -500,7 +860,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 			result.Version = &JavaVersion{
 				NameRaw:   legacyStatus.Version.Name.Raw,
 				NameClean: legacyStatus.Version.Name.Clean,
-				NameHTML:  legacyStatus.Version.Name.HTML,
+				NameHTML:  ApplyColorPalette(legacyStatus.Version.Name.HTML),
 				Protocol:  legacyStatus.Version.Protocol,
 			}
 		}
@@ -524,7 +884,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 					result.MOTD = MOTD{
 						Raw:   parsedMOTD.Raw,
 						Clean: parsedMOTD.Clean,
-						HTML:  parsedMOTD.HTML,
+						HTML:  ApplyColorPalette(parsedMOTD.HTML),
 					}
 				}
 			}
@@ -552,7 +912,7 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 					result.Version = &JavaVersion{
 						NameRaw:   parsedValue.Raw,
 						NameClean: parsedValue.Clean,
-						NameHTML:  parsedValue.HTML,
+						NameHTML:  ApplyColorPalette(parsedValue.HTML),
 						Protocol:  0,
 					}
 				}
@@ -560,24 +920,9 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 		}
 
 		if plugins, ok := query.Data["plugins"]; ok {
-			if softwareSplit := strings.Split(strings.Trim(plugins, " "), ":"); len(softwareSplit) > 1 {
-				result.Software = PointerOf(strings.Trim(softwareSplit[0], " "))
-
-				for _, plugin := range strings.Split(softwareSplit[1], ";") {
-					pluginSplit := strings.Split(strings.Trim(plugin, " "), " ")
-
-					if len(pluginSplit) > 1 {
-						result.Plugins = append(result.Plugins, Plugin{
-							Name:    pluginSplit[0],
-							Version: PointerOf(pluginSplit[1]),
-						})
-					} else {
-						result.Plugins = append(result.Plugins, Plugin{
-							Name:    pluginSplit[0],
-							Version: nil,
-						})
-					}
-				}
+			if software, parsedPlugins := ParseQueryPlugins(plugins); software != nil {
+				result.Software = software
+				result.Plugins = append(result.Plugins, parsedPlugins...)
 			}
 		}
 
@@ -593,22 +938,99 @@ func BuildJavaResponse(hostname string, port uint16, status *response.StatusMode
 					UUID:      "",
 					NameRaw:   parsedName.Raw,
 					NameClean: parsedName.Clean,
-					NameHTML:  parsedName.HTML,
+					NameHTML:  ApplyColorPalette(parsedName.HTML),
 				})
 			}
 		}
 	}
 
+	if result.JavaStatus != nil {
+		result.Players.List, result.Players.ListHidden = CleanPlayerSample(result.Players.List)
+	}
+
+	if maxPlayerList := config.Performance.MaxPlayerList; maxPlayerList > 0 && uint(len(result.Players.List)) > maxPlayerList {
+		result.Players.List = result.Players.List[:maxPlayerList]
+	}
+
 	if srvRecord != nil {
 		result.SRVRecord = &SRVRecord{
 			Host: strings.Trim(srvRecord.Target, "."),
 			Port: srvRecord.Port,
+			TTL:  nil,
 		}
 	}
 
 	return
 }
 
+// ParseQueryPlugins parses the 'plugins' value of a query response, formatted as `Software: Plugin 1.0; Other 2.0`,
+// into the server software and its plugins. The software is nil if the value is not in this format.
+func ParseQueryPlugins(value string) (*string, []Plugin) {
+	softwareSplit := strings.Split(strings.Trim(value, " "), ":")
+
+	if len(softwareSplit) < 2 {
+		return nil, nil
+	}
+
+	result := make([]Plugin, 0)
+
+	for _, plugin := range strings.Split(softwareSplit[1], ";") {
+		pluginSplit := strings.Split(strings.Trim(plugin, " "), " ")
+
+		if len(pluginSplit) > 1 {
+			result = append(result, Plugin{
+				Name:    pluginSplit[0],
+				Version: PointerOf(pluginSplit[1]),
+			})
+		} else {
+			result = append(result, Plugin{
+				Name:    pluginSplit[0],
+				Version: nil,
+			})
+		}
+	}
+
+	return PointerOf(strings.Trim(softwareSplit[0], " ")), result
+}
+
+// CleanPlayerSample removes the placeholder entries that servers hiding their player list send, as well as duplicated
+// players, and reports whether any placeholder was found. Entries without a UUID that are not placeholders are kept, as
+// servers commonly use them to show custom text when hovering over the player count.
+func CleanPlayerSample(list []Player) ([]Player, bool) {
+	var (
+		result []Player            = make([]Player, 0, len(list))
+		seen   map[string]struct{} = make(map[string]struct{})
+		hidden bool                = false
+	)
+
+	for _, player := range list {
+		isNilUUID := len(player.UUID) < 1 || player.UUID == nilUUID
+
+		if isNilUUID && player.NameClean == anonymousPlayerName {
+			hidden = true
+
+			continue
+		}
+
+		// Players without a UUID can only be told apart by their name
+		key := player.UUID
+
+		if isNilUUID {
+			key = "name:" + player.NameRaw
+		}
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+
+		result = append(result, player)
+	}
+
+	return result, hidden
+}
+
 // BuildBedrockResponse builds the response data from the status information.
 func BuildBedrockResponse(hostname string, port uint16, status *response.StatusBedrock, ipAddress *string) (result *BedrockStatusResponse, err error) {
 	result = &BedrockStatusResponse{
@@ -618,6 +1040,7 @@ func BuildBedrockResponse(hostname string, port uint16, status *response.StatusB
 			Port:        port,
 			IPAddress:   ipAddress,
 			EULABlocked: IsBlockedAddress(hostname),
+			Confidence:  1,
 			RetrievedAt: time.Now().UnixMilli(),
 			ExpiresAt:   time.Now().Add(config.Cache.BedrockStatusDuration).UnixMilli(),
 		},
@@ -684,10 +1107,22 @@ func BuildBedrockResponse(hostname string, port uint16, status *response.StatusB
 			result.MOTD = &MOTD{
 				Raw:   status.MOTD.Raw,
 				Clean: status.MOTD.Clean,
-				HTML:  status.MOTD.HTML,
+				HTML:  ApplyColorPalette(status.MOTD.HTML),
 			}
 		}
+
+		if missing := GetMissingBedrockFields(status); len(missing) > 0 {
+			result.FieldsMissing = missing
+		}
 	}
 
 	return
 }
+
+// markRecentlyOnline remembers that a server was online, so that an offline result shortly after is confirmed. Failing
+// to do so only skips that confirmation, so it does not fail the lookup.
+func markRecentlyOnline(ctx context.Context, onlineKey string) {
+	if err := r.Set(ctx, onlineKey, 1, config.Lookup.RecentlyOnlineDuration); err != nil {
+		log.Printf("Failed to mark %s as recently online: %v\n", onlineKey, err)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// StorageBackendLocal stores artifacts in a directory on the local disk.
+	StorageBackendLocal = "local"
+	// StorageBackendS3 stores artifacts in the bucket of an S3-compatible object storage service.
+	StorageBackendS3 = "s3"
+)
+
+var (
+	artifacts ArtifactStore = nil
+
+	ErrArtifactNotFound   error = errors.New("artifact not found")
+	ErrInvalidArtifactKey error = errors.New("invalid artifact key")
+)
+
+// ArtifactStore stores large artifacts outside of Redis, and delivers them through URLs that expire.
+type ArtifactStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	URL(ctx context.Context, key string) (*SignedURL, error)
+}
+
+// NewArtifactStore connects to the configured artifact storage backend.
+func NewArtifactStore(ctx context.Context) (ArtifactStore, error) {
+	switch config.Storage.Backend {
+	case StorageBackendLocal:
+		if err := os.MkdirAll(config.Storage.Directory, 0755); err != nil {
+			return nil, err
+		}
+
+		return &LocalArtifactStore{
+			Directory: config.Storage.Directory,
+		}, nil
+	case StorageBackendS3:
+		s3 := config.Storage.S3
+
+		if s3 == nil {
+			return nil, errors.New("the s3 storage backend requires the s3 settings")
+		}
+
+		bucketLookup := minio.BucketLookupAuto
+
+		if s3.PathStyle {
+			bucketLookup = minio.BucketLookupPath
+		}
+
+		client, err := minio.New(s3.Endpoint, &minio.Options{
+			Creds:        credentials.NewStaticV4(s3.AccessKeyID, s3.SecretAccessKey, ""),
+			Secure:       s3.UseSSL,
+			Region:       s3.Region,
+			BucketLookup: bucketLookup,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		exists, err := client.BucketExists(ctx, s3.Bucket)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			return nil, fmt.Errorf("bucket does not exist: %s", s3.Bucket)
+		}
+
+		return &S3ArtifactStore{
+			Client: client,
+			Bucket: s3.Bucket,
+			Prefix: s3.Prefix,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid storage backend: %s", config.Storage.Backend)
+	}
+}
+
+// LocalArtifactStore stores artifacts as files in a directory, delivered by this server through signed URLs.
+type LocalArtifactStore struct {
+	Directory string
+}
+
+// Put writes the artifact to its file, replacing any previous version.
+func (s *LocalArtifactStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	file, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	// The artifact is written to a temporary file first so that readers never see a partially written artifact
+	temporaryFile := fmt.Sprintf("%s.%s.tmp", file, RandomHexString(4))
+
+	if err = os.WriteFile(temporaryFile, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(temporaryFile, file)
+}
+
+// Get reads the artifact from its file.
+func (s *LocalArtifactStore) Get(ctx context.Context, key string) ([]byte, error) {
+	file, err := s.path(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrArtifactNotFound
+	}
+
+	return data, err
+}
+
+// Delete removes the file of the artifact, if it exists.
+func (s *LocalArtifactStore) Delete(ctx context.Context, key string) error {
+	file, err := s.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// URL returns the signed URL that this server delivers the artifact at, which requires URL signing to be configured.
+func (s *LocalArtifactStore) URL(ctx context.Context, key string) (*SignedURL, error) {
+	if _, err := s.path(key); err != nil {
+		return nil, err
+	}
+
+	return SignPath(path.Join("/artifacts", key))
+}
+
+// path returns the file of the artifact, rejecting keys that would escape the directory.
+func (s *LocalArtifactStore) path(key string) (string, error) {
+	if !filepath.IsLocal(key) {
+		return "", ErrInvalidArtifactKey
+	}
+
+	return filepath.Join(s.Directory, filepath.FromSlash(key)), nil
+}
+
+// S3ArtifactStore stores artifacts as objects in a bucket, delivered directly by the storage service through presigned
+// URLs.
+type S3ArtifactStore struct {
+	Client *minio.Client
+	Bucket string
+	Prefix string
+}
+
+// Put uploads the artifact to its object, replacing any previous version.
+func (s *S3ArtifactStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.Client.PutObject(ctx, s.Bucket, s.Prefix+key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+
+	return err
+}
+
+// Get downloads the artifact from its object.
+func (s *S3ArtifactStore) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.Client.GetObject(ctx, s.Bucket, s.Prefix+key, minio.GetObjectOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+
+	if minio.ToErrorResponse(err).StatusCode == http.StatusNotFound {
+		return nil, ErrArtifactNotFound
+	}
+
+	return data, err
+}
+
+// Delete removes the object of the artifact, if it exists.
+func (s *S3ArtifactStore) Delete(ctx context.Context, key string) error {
+	return s.Client.RemoveObject(ctx, s.Bucket, s.Prefix+key, minio.RemoveObjectOptions{})
+}
+
+// URL returns a presigned URL of the object of the artifact that is valid for the configured TTL.
+func (s *S3ArtifactStore) URL(ctx context.Context, key string) (*SignedURL, error) {
+	result, err := s.Client.PresignedGetObject(ctx, s.Bucket, s.Prefix+key, config.Storage.URLTTL, url.Values{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedURL{
+		URL:       result.String(),
+		ExpiresAt: time.Now().Add(config.Storage.URLTTL).Unix(),
+	}, nil
+}
+
+// ArtifactHandler delivers an artifact of the local storage backend to the holder of a signed URL of it.
+func ArtifactHandler(ctx *fiber.Ctx) error {
+	if !VerifyRequestSignature(ctx) {
+		return ctx.Status(http.StatusForbidden).SendString("Missing, invalid or expired URL signature")
+	}
+
+	key := ctx.Params("*")
+
+	data, err := artifacts.Get(ctx.UserContext(), key)
+
+	if errors.Is(err, ErrArtifactNotFound) || errors.Is(err, ErrInvalidArtifactKey) {
+		return ctx.Status(http.StatusNotFound).SendString("Artifact not found")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ctx.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(key)))
+
+	return ctx.Type(path.Ext(key)).Send(data)
+}
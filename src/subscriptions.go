@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	subscriberBuffer           = 64
+	subscriptionRefreshers     = 16
+	subscriptionReadLimit      = 4096
+	subscriptionPingInterval   = time.Second * 30
+	subscriptionIdleTimeout    = time.Second * 75
+	subscriptionControlTimeout = time.Second * 10
+)
+
+var (
+	subscriptions *SubscriptionRegistry = &SubscriptionRegistry{
+		Targets:     make(map[string]*SubscriptionTarget),
+		Connections: make(map[string]uint),
+		Mutex:       &sync.Mutex{},
+	}
+)
+
+// SubscriptionRequest is a message sent by WebSocket clients to subscribe to or unsubscribe from a server.
+type SubscriptionRequest struct {
+	Action  string `json:"action"`
+	Edition string `json:"edition"`
+	Address string `json:"address"`
+}
+
+// StatusUpdate is a message pushed to WebSocket clients, either with the latest status of a subscribed server or
+// with the reason a request could not be fulfilled.
+type StatusUpdate struct {
+	Type    string      `json:"type"`
+	Edition string      `json:"edition"`
+	Address string      `json:"address"`
+	Status  interface{} `json:"status,omitempty"`
+	Error   *string     `json:"error,omitempty"`
+}
+
+// SubscriptionTarget is a server that at least one WebSocket client is subscribed to.
+type SubscriptionTarget struct {
+	Edition     string
+	Address     string
+	Hostname    string
+	Port        uint16
+	PortSource  string
+	RetrievedAt int64
+	Subscribers map[chan StatusUpdate]struct{}
+}
+
+// SubscriptionRegistry keeps track of the servers that WebSocket clients are subscribed to, and pushes their status
+// to the subscribers whenever it is refreshed. It also counts the open connections of every client IP address.
+type SubscriptionRegistry struct {
+	Targets          map[string]*SubscriptionTarget
+	Connections      map[string]uint
+	TotalConnections uint
+	Mutex            *sync.Mutex
+}
+
+// GetSubscriptionKey returns the key identifying a subscribed server in the registry.
+func GetSubscriptionKey(edition, address string) string {
+	return fmt.Sprintf("%s:%s", edition, strings.ToLower(address))
+}
+
+// Connect counts a new connection from the IP address, returning false without counting it if either the total or the
+// per IP address connection limit has been reached.
+func (s *SubscriptionRegistry) Connect(ip string) bool {
+	s.Mutex.Lock()
+
+	defer s.Mutex.Unlock()
+
+	if config.Subscriptions.MaxConnections > 0 && s.TotalConnections >= config.Subscriptions.MaxConnections {
+		return false
+	}
+
+	if config.Subscriptions.MaxConnectionsPerIP > 0 && s.Connections[ip] >= config.Subscriptions.MaxConnectionsPerIP {
+		return false
+	}
+
+	s.Connections[ip]++
+	s.TotalConnections++
+
+	return true
+}
+
+// Disconnect stops counting a connection from the IP address that was counted by Connect.
+func (s *SubscriptionRegistry) Disconnect(ip string) {
+	s.Mutex.Lock()
+
+	defer s.Mutex.Unlock()
+
+	s.TotalConnections--
+
+	if s.Connections[ip]--; s.Connections[ip] < 1 {
+		delete(s.Connections, ip)
+	}
+}
+
+// Subscribe adds the subscriber to the server, registering the server if nobody was subscribed to it yet.
+func (s *SubscriptionRegistry) Subscribe(edition, address, hostname string, port uint16, portSource string, subscriber chan StatusUpdate) {
+	s.Mutex.Lock()
+
+	defer s.Mutex.Unlock()
+
+	key := GetSubscriptionKey(edition, address)
+
+	target, ok := s.Targets[key]
+
+	if !ok {
+		target = &SubscriptionTarget{
+			Edition:     edition,
+			Address:     address,
+			Hostname:    hostname,
+			Port:        port,
+			PortSource:  portSource,
+			RetrievedAt: 0,
+			Subscribers: make(map[chan StatusUpdate]struct{}),
+		}
+
+		s.Targets[key] = target
+	}
+
+	target.Subscribers[subscriber] = struct{}{}
+}
+
+// Unsubscribe removes the subscriber from the server, forgetting the server once nobody is subscribed to it.
+func (s *SubscriptionRegistry) Unsubscribe(key string, subscriber chan StatusUpdate) {
+	s.Mutex.Lock()
+
+	defer s.Mutex.Unlock()
+
+	target, ok := s.Targets[key]
+
+	if !ok {
+		return
+	}
+
+	delete(target.Subscribers, subscriber)
+
+	if len(target.Subscribers) < 1 {
+		delete(s.Targets, key)
+	}
+}
+
+// Publish sends the update to every subscriber of the server, dropping it for subscribers that cannot keep up. The
+// update is only sent if the status was retrieved after the last published status of the server, and false is
+// returned if it was not sent.
+func (s *SubscriptionRegistry) Publish(key string, retrievedAt int64, update StatusUpdate) bool {
+	s.Mutex.Lock()
+
+	defer s.Mutex.Unlock()
+
+	target, ok := s.Targets[key]
+
+	if !ok || target.RetrievedAt >= retrievedAt {
+		return false
+	}
+
+	target.RetrievedAt = retrievedAt
+
+	for subscriber := range target.Subscribers {
+		select {
+		case subscriber <- update:
+		default:
+		}
+	}
+
+	return true
+}
+
+// List returns a copy of every subscribed server, without its subscribers.
+func (s *SubscriptionRegistry) List() map[string]SubscriptionTarget {
+	s.Mutex.Lock()
+
+	defer s.Mutex.Unlock()
+
+	result := make(map[string]SubscriptionTarget, len(s.Targets))
+
+	for key, target := range s.Targets {
+		result[key] = SubscriptionTarget{
+			Edition:     target.Edition,
+			Address:     target.Address,
+			Hostname:    target.Hostname,
+			Port:        target.Port,
+			PortSource:  target.PortSource,
+			RetrievedAt: target.RetrievedAt,
+			Subscribers: nil,
+		}
+	}
+
+	return result
+}
+
+// Refresh retrieves the status of every subscribed server, either using cache or fetching a fresh status, and pushes
+// it to the subscribers of the server if it was retrieved since the last push.
+func (s *SubscriptionRegistry) Refresh(ctx context.Context) {
+	var group errgroup.Group
+
+	group.SetLimit(subscriptionRefreshers)
+
+	for key, target := range s.List() {
+		group.Go(func() error {
+			status, retrievedAt, err := GetSubscriptionStatus(ctx, target.Edition, target.Hostname, target.Port, target.PortSource)
+
+			if err != nil {
+				log.Printf("Failed to refresh subscribed %s server %s: %v\n", target.Edition, target.Address, err)
+
+				return nil
+			}
+
+			s.Publish(key, retrievedAt, StatusUpdate{
+				Type:    "status",
+				Edition: target.Edition,
+				Address: target.Address,
+				Status:  status,
+				Error:   nil,
+			})
+
+			return nil
+		})
+	}
+
+	group.Wait()
+}
+
+// RefreshSubscriptions refreshes the status of every subscribed server at the given interval until the context is done.
+func RefreshSubscriptions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		subscriptions.Refresh(ctx)
+	}
+}
+
+// GetSubscriptionStatus returns the status of the server using the default status options, along with the time it was
+// retrieved at.
+func GetSubscriptionStatus(ctx context.Context, edition, hostname string, port uint16, portSource string) (interface{}, int64, error) {
+	opts := &StatusOptions{
+		Query:   true,
+		Timeout: time.Second * 5,
+		Trigger: "subscription",
+	}
+
+	switch edition {
+	case "java":
+		response, cache, err := GetJavaStatus(ctx, hostname, port, opts)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		response.SetPortSource(portSource)
+		response.SetCacheResult(cache)
+
+		return response, response.RetrievedAt, nil
+	case "bedrock":
+		response, cache, err := GetBedrockStatus(ctx, hostname, port, opts)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		response.PortSource = portSource
+		response.SetCacheResult(cache)
+
+		return response, response.RetrievedAt, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown edition: %s", edition)
+	}
+}
+
+// RequireSubscriber is a middleware that authenticates WebSocket subscription requests before they are upgraded, and
+// keeps the status options of the request for the connection.
+func RequireSubscriber(ctx *fiber.Ctx) error {
+	opts, err := GetStatusOptions(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	authorized, err := Authenticate(ctx)
+
+	// This check should work for both scenarios, because nil should be returned if the user
+	// is unauthorized, and err will be nil in that case.
+	if err != nil || !authorized {
+		return err
+	}
+
+	ctx.Locals("options", opts)
+
+	return ctx.Next()
+}
+
+// SubscribeHandler lets clients subscribe to servers over a WebSocket by sending subscription requests, and pushes the
+// status of every subscribed server whenever it is refreshed. Connections are pinged to keep them alive, and closed once
+// the client stops responding.
+var SubscribeHandler = websocket.New(func(conn *websocket.Conn) {
+	opts := conn.Locals("options").(*StatusOptions)
+	ip := conn.IP()
+
+	if !subscriptions.Connect(ip) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too many connections"), time.Now().Add(subscriptionControlTimeout))
+
+		return
+	}
+
+	defer subscriptions.Disconnect(ip)
+
+	conn.SetReadLimit(subscriptionReadLimit)
+	conn.SetReadDeadline(time.Now().Add(subscriptionIdleTimeout))
+
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(subscriptionIdleTimeout))
+	})
+
+	ticker := time.NewTicker(subscriptionPingInterval)
+
+	defer ticker.Stop()
+
+	var (
+		updates    chan StatusUpdate        = make(chan StatusUpdate, subscriberBuffer)
+		requests   chan SubscriptionRequest = make(chan SubscriptionRequest)
+		subscribed map[string]struct{}      = make(map[string]struct{})
+		done       chan struct{}            = make(chan struct{})
+	)
+
+	defer close(done)
+
+	defer func() {
+		for key := range subscribed {
+			subscriptions.Unsubscribe(key, updates)
+		}
+	}()
+
+	// Read subscription requests until the client closes the connection, as writes must only happen on this goroutine
+	go func() {
+		defer close(requests)
+
+		for {
+			_, data, err := conn.ReadMessage()
+
+			if err != nil {
+				return
+			}
+
+			if err = conn.SetReadDeadline(time.Now().Add(subscriptionIdleTimeout)); err != nil {
+				return
+			}
+
+			var request SubscriptionRequest
+
+			if err = json.Unmarshal(data, &request); err != nil {
+				request = SubscriptionRequest{}
+			}
+
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case request, ok := <-requests:
+			if !ok {
+				return
+			}
+
+			err := handleSubscriptionRequest(opts, request, subscribed, updates)
+
+			if err == nil {
+				continue
+			}
+
+			if err = conn.WriteJSON(StatusUpdate{
+				Type:    "error",
+				Edition: request.Edition,
+				Address: request.Address,
+				Status:  nil,
+				Error:   PointerOf(err.Error()),
+			}); err != nil {
+				return
+			}
+		case update := <-updates:
+			if err := conn.WriteJSON(update); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(subscriptionControlTimeout)); err != nil {
+				return
+			}
+		}
+	}
+})
+
+func handleSubscriptionRequest(opts *StatusOptions, request SubscriptionRequest, subscribed map[string]struct{}, updates chan StatusUpdate) error {
+	if request.Edition != "java" && request.Edition != "bedrock" {
+		return errors.New("'edition' must be either 'java' or 'bedrock'")
+	}
+
+	key := GetSubscriptionKey(request.Edition, request.Address)
+
+	switch request.Action {
+	case "subscribe":
+		if _, ok := subscribed[key]; ok {
+			return nil
+		}
+
+		if uint(len(subscribed)) >= config.Subscriptions.MaxPerConnection {
+			return fmt.Errorf("a connection may only subscribe to %d servers", config.Subscriptions.MaxPerConnection)
+		}
+
+		hostname, port, portSource, err := ParseTargetAddress(request.Address, request.Edition)
+
+		if err != nil {
+			return errors.New("invalid address value")
+		}
+
+		if err = CheckTarget(context.Background(), opts, request.Edition, hostname, port, request.Edition == "java"); err != nil {
+			return err
+		}
+
+		if err = CountTargetLookup(context.Background(), opts, request.Edition, hostname, port); err != nil {
+			return err
+		}
+
+		subscribed[key] = struct{}{}
+
+		subscriptions.Subscribe(request.Edition, request.Address, hostname, port, portSource, updates)
+
+		// Send the current status right away instead of waiting for it to be refreshed, which also reaches the other
+		// subscribers of the server if the status is newer than the one they were sent
+		go func() {
+			status, retrievedAt, err := GetSubscriptionStatus(context.Background(), request.Edition, hostname, port, portSource)
+
+			update := StatusUpdate{
+				Type:    "status",
+				Edition: request.Edition,
+				Address: request.Address,
+				Status:  status,
+				Error:   nil,
+			}
+
+			if err != nil {
+				update.Type = "error"
+				update.Status = nil
+				update.Error = PointerOf(err.Error())
+			} else if subscriptions.Publish(key, retrievedAt, update) {
+				return
+			}
+
+			select {
+			case updates <- update:
+			default:
+			}
+		}()
+
+		return nil
+	case "unsubscribe":
+		delete(subscribed, key)
+
+		subscriptions.Unsubscribe(key, updates)
+
+		return nil
+	default:
+		return errors.New("'action' must be either 'subscribe' or 'unsubscribe'")
+	}
+}
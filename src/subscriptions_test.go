@@ -0,0 +1,51 @@
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSubscriptionConnectionLimits(t *testing.T) {
+	registry := &SubscriptionRegistry{
+		Targets:     make(map[string]*SubscriptionTarget),
+		Connections: make(map[string]uint),
+		Mutex:       &sync.Mutex{},
+	}
+
+	maxConnections, maxConnectionsPerIP := config.Subscriptions.MaxConnections, config.Subscriptions.MaxConnectionsPerIP
+
+	config.Subscriptions.MaxConnections, config.Subscriptions.MaxConnectionsPerIP = 3, 2
+
+	defer func() {
+		config.Subscriptions.MaxConnections, config.Subscriptions.MaxConnectionsPerIP = maxConnections, maxConnectionsPerIP
+	}()
+
+	tests := []struct {
+		IP        string
+		Connected bool
+	}{
+		{"192.0.2.1", true},
+		{"192.0.2.1", true},
+		{"192.0.2.1", false},
+		{"192.0.2.2", true},
+		{"192.0.2.3", false},
+	}
+
+	for i, test := range tests {
+		if connected := registry.Connect(test.IP); connected != test.Connected {
+			t.Fatalf("connection %d from %s: Connect() = %v, expected %v", i, test.IP, connected, test.Connected)
+		}
+	}
+
+	registry.Disconnect("192.0.2.1")
+
+	if !registry.Connect("192.0.2.3") {
+		t.Errorf("expected a connection to be allowed once another one was closed")
+	}
+
+	registry.Disconnect("192.0.2.2")
+
+	if _, ok := registry.Connections["192.0.2.2"]; ok {
+		t.Errorf("expected the IP address to be forgotten once all of its connections were closed")
+	}
+}
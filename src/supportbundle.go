@@ -0,0 +1,353 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const supportBundleSelfTestKey = "support-bundle-self-test"
+
+// SupportBundleVersion is the build and process information included in a support bundle.
+type SupportBundleVersion struct {
+	GoVersion    string            `json:"go_version"`
+	Module       string            `json:"module"`
+	Revision     *string           `json:"revision"`
+	RevisionAt   *string           `json:"revision_at"`
+	Modified     bool              `json:"modified"`
+	Environment  string            `json:"environment"`
+	Role         string            `json:"role"`
+	InstanceID   uint16            `json:"instance_id"`
+	StartedAt    time.Time         `json:"started_at"`
+	GeneratedAt  time.Time         `json:"generated_at"`
+	Dependencies map[string]string `json:"dependencies"`
+}
+
+// SupportBundleBlocklists is the state of the blocklists included in a support bundle.
+type SupportBundleBlocklists struct {
+	MojangEntries    int        `json:"mojang_entries"`
+	MojangFetchedAt  *time.Time `json:"mojang_fetched_at"`
+	MojangAge        *string    `json:"mojang_age"`
+	LocalEntries     int        `json:"local_entries"`
+	LocalRefreshedAt *time.Time `json:"local_refreshed_at"`
+	LocalAge         *string    `json:"local_age"`
+}
+
+// SupportBundleCache is the state of the cache included in a support bundle.
+type SupportBundleCache struct {
+	Backend     string         `json:"backend"`
+	LargestKeys []CacheKeySize `json:"largest_keys"`
+	Error       *string        `json:"error"`
+}
+
+// SelfTest is a check of a single dependency of this instance, which is skipped unless it is enabled.
+type SelfTest struct {
+	Name    string
+	Enabled bool
+	Run     func(ctx context.Context) error
+}
+
+// SelfTestResult is the result of a single self-test, as included in a support bundle or the readiness report.
+type SelfTestResult struct {
+	Name     string  `json:"name"`
+	OK       bool    `json:"ok"`
+	Duration float64 `json:"duration_ms"`
+	Error    *string `json:"error"`
+}
+
+// GetSupportBundle assembles a ZIP archive describing the state of this instance, meant to be attached to bug
+// reports. Secrets are redacted from the configuration it contains.
+func GetSupportBundle(ctx context.Context) ([]byte, error) {
+	redactedConfig, err := config.Redacted()
+
+	if err != nil {
+		return nil, err
+	}
+
+	configData, err := yaml.Marshal(redactedConfig)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+
+	files := []struct {
+		Name  string
+		Value interface{}
+	}{
+		{"version.json", GetSupportBundleVersion()},
+		{"config.yml", configData},
+		{"errors.json", logs.GetRecentErrors()},
+		{"runtime.json", GetRuntimeStats()},
+		{"subsystems.json", lifecycle.List()},
+		{"blocklists.json", GetSupportBundleBlocklists()},
+		{"cache.json", GetSupportBundleCache(ctx)},
+		{"self-test.json", RunSelfTests(ctx, GetSupportBundleSelfTests())},
+	}
+
+	for _, file := range files {
+		data, ok := file.Value.([]byte)
+
+		if !ok {
+			if data, err = json.MarshalIndent(file.Value, "", "\t"); err != nil {
+				return nil, fmt.Errorf("%s: %w", file.Name, err)
+			}
+		}
+
+		w, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.Name,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err = w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GetSupportBundleVersion returns the build information of the binary and the identity of this process.
+func GetSupportBundleVersion() SupportBundleVersion {
+	result := SupportBundleVersion{
+		Environment:  config.Environment,
+		Role:         role,
+		InstanceID:   instanceID,
+		StartedAt:    startedAt,
+		GeneratedAt:  time.Now(),
+		Dependencies: make(map[string]string),
+	}
+
+	info, ok := debug.ReadBuildInfo()
+
+	if !ok {
+		return result
+	}
+
+	result.GoVersion = info.GoVersion
+	result.Module = info.Main.Path
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			result.Revision = PointerOf(setting.Value)
+		case "vcs.time":
+			result.RevisionAt = PointerOf(setting.Value)
+		case "vcs.modified":
+			result.Modified = setting.Value == "true"
+		}
+	}
+
+	for _, dependency := range info.Deps {
+		result.Dependencies[dependency.Path] = dependency.Version
+	}
+
+	return result
+}
+
+// GetSupportBundleBlocklists returns the size and age of Mojang's list of blocked servers and the local blocklist.
+func GetSupportBundleBlocklists() SupportBundleBlocklists {
+	var result SupportBundleBlocklists
+
+	if blockedServers != nil {
+		blockedServers.Mutex.Lock()
+		result.MojangEntries = len(blockedServers.List)
+		blockedServers.Mutex.Unlock()
+	}
+
+	if !blockedServersFetchedAt.IsZero() {
+		result.MojangFetchedAt = PointerOf(blockedServersFetchedAt)
+		result.MojangAge = PointerOf(time.Since(blockedServersFetchedAt).Round(time.Second).String())
+	}
+
+	localBlocklist.Mutex.RLock()
+
+	defer localBlocklist.Mutex.RUnlock()
+
+	result.LocalEntries = len(localBlocklist.Entries)
+
+	if !localBlocklist.RefreshedAt.IsZero() {
+		result.LocalRefreshedAt = PointerOf(localBlocklist.RefreshedAt)
+		result.LocalAge = PointerOf(time.Since(localBlocklist.RefreshedAt).Round(time.Second).String())
+	}
+
+	return result
+}
+
+// GetSupportBundleCache returns the cache backend and, if they are tracked, the largest values in the cache.
+func GetSupportBundleCache(ctx context.Context) SupportBundleCache {
+	result := SupportBundleCache{
+		Backend:     config.Cache.Backend,
+		LargestKeys: make([]CacheKeySize, 0),
+	}
+
+	if config.Redis == nil || config.Metrics.LargestCacheKeys < 1 {
+		return result
+	}
+
+	largestKeys, err := GetLargestCacheKeys(ctx, int64(min(config.Metrics.LargestCacheKeys, 25)))
+
+	if err != nil {
+		result.Error = PointerOf(err.Error())
+
+		return result
+	}
+
+	result.LargestKeys = largestKeys
+
+	return result
+}
+
+// GetSupportBundleSelfTests returns the self-tests of the support bundle, which check that every dependency of this
+// instance can be reached and that the cache stores values.
+func GetSupportBundleSelfTests() []SelfTest {
+	return []SelfTest{
+		{"redis", config.Redis != nil, r.Ping},
+		{"mongodb", config.MongoDB != nil, db.Ping},
+		{"cache", config.Cache.Backend != CacheBackendRedis || config.Redis != nil, selfTestCache},
+		{"blocked-servers", true, selfTestBlockedServers},
+		{"dns", true, selfTestDNS},
+	}
+}
+
+// RunSelfTests runs every enabled self-test in order and returns their results.
+func RunSelfTests(ctx context.Context, checks []SelfTest) []SelfTestResult {
+	result := make([]SelfTestResult, 0, len(checks))
+
+	for _, check := range checks {
+		if !check.Enabled {
+			continue
+		}
+
+		start := time.Now()
+		err := check.Run(ctx)
+
+		value := SelfTestResult{
+			Name:     check.Name,
+			OK:       err == nil,
+			Duration: float64(time.Since(start).Microseconds()) / 1000,
+			Error:    nil,
+		}
+
+		if err != nil {
+			value.Error = PointerOf(err.Error())
+		}
+
+		result = append(result, value)
+	}
+
+	return result
+}
+
+// selfTestCache writes a value to the cache and reads it back.
+func selfTestCache(ctx context.Context) error {
+	expected := fmt.Sprintf("%d", time.Now().UnixNano())
+	key := fmt.Sprintf("%s:%d", supportBundleSelfTestKey, instanceID)
+
+	if err := cacheStore.Set(ctx, key, expected, time.Minute); err != nil {
+		return err
+	}
+
+	defer cacheStore.Delete(ctx, key)
+
+	value, _, err := cacheStore.Get(ctx, key)
+
+	if err != nil {
+		return err
+	}
+
+	if string(value) != expected {
+		return errors.New("the value read from the cache does not match the value written")
+	}
+
+	return nil
+}
+
+// selfTestBlockedServers checks that Mojang's list of blocked servers has been retrieved.
+func selfTestBlockedServers(ctx context.Context) error {
+	if blockedServers == nil {
+		return errors.New("the blocked servers list has not been retrieved")
+	}
+
+	return nil
+}
+
+// selfTestDNS resolves the hostname of Mojang's session server, which every status lookup relies on DNS for as well.
+func selfTestDNS(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+
+	defer cancel()
+
+	_, err := net.DefaultResolver.LookupHost(ctx, "sessionserver.mojang.com")
+
+	return err
+}
+
+// SupportBundleHandler returns a ZIP archive of the state of this instance to attach to bug reports.
+func SupportBundleHandler(ctx *fiber.Ctx) error {
+	data, err := GetSupportBundle(ctx.UserContext())
+
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("support-bundle-%s.zip", strings.ReplaceAll(time.Now().UTC().Format(time.RFC3339), ":", ""))
+
+	ctx.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	return ctx.Type("zip").Send(data)
+}
+
+// StoreSupportBundleHandler stores a support bundle in artifact storage and returns a temporary URL to download it
+// from, for bundles that are shared with someone without admin access.
+func StoreSupportBundleHandler(ctx *fiber.Ctx) error {
+	data, err := GetSupportBundle(ctx.UserContext())
+
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("support-bundles/support-bundle-%s.zip", strings.ReplaceAll(time.Now().UTC().Format(time.RFC3339), ":", ""))
+
+	if err = artifacts.Put(ctx.UserContext(), key, data, "application/zip"); err != nil {
+		return err
+	}
+
+	signedURL, err := artifacts.URL(ctx.UserContext(), key)
+
+	if errors.Is(err, ErrNoSigningKey) {
+		return ctx.Status(http.StatusConflict).SendString("The support bundle was stored, but URL signing is not configured")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(fiber.Map{
+		"key":        key,
+		"url":        signedURL.URL,
+		"expires_at": signedURL.ExpiresAt,
+	})
+}
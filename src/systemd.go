@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemdListenFDStart is the first file descriptor passed by systemd socket activation.
+const systemdListenFDStart = 3
+
+// SystemdListener returns the socket passed by systemd socket activation, or nil if the process was not started by
+// socket activation.
+func SystemdListener() (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	if count > 1 {
+		return nil, fmt.Errorf("systemd: expected a single socket, got %d", count)
+	}
+
+	// The variables must not be inherited by child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	file := os.NewFile(uintptr(systemdListenFDStart), "systemd-socket")
+
+	defer file.Close()
+
+	return net.FileListener(file)
+}
+
+// SystemdNotify sends the state to the systemd service manager, doing nothing if the process is not managed by a
+// service with notifications enabled.
+func SystemdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+
+	if len(socket) < 1 {
+		return nil
+	}
+
+	// Abstract sockets are given with a leading '@' that stands for a null byte
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+
+	return err
+}
+
+// SystemdWatchdogInterval returns the interval at which the watchdog expects to be notified, or zero if the
+// watchdog is not enabled for this process.
+func SystemdWatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+
+	if err != nil || usec < 1 {
+		return 0
+	}
+
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunSystemdWatchdog notifies the systemd watchdog at half of its interval for as long as the server keeps answering
+// its own health check at the given address. Once the server stalls the notifications stop, and systemd restarts the
+// service when the watchdog interval elapses.
+func RunSystemdWatchdog(address string, interval time.Duration) {
+	client := &http.Client{
+		Timeout: interval / 2,
+	}
+
+	for range time.Tick(interval / 2) {
+		if err := checkHealth(client, address); err != nil {
+			log.Printf("Skipping watchdog notification, health check failed: %v\n", err)
+
+			continue
+		}
+
+		if err := SystemdNotify("WATCHDOG=1"); err != nil {
+			log.Printf("Failed to notify watchdog: %v\n", err)
+		}
+	}
+}
+
+func checkHealth(client *http.Client, address string) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, fmt.Sprintf("http://%s/ping", address), nil)
+
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	allowedNetworks []*net.IPNet = nil
+	blockedNetworks []*net.IPNet = nil
+	ownAddresses    []net.IP     = nil
+	// The "this network", carrier-grade NAT and limited broadcast networks, which the net package has no checks for
+	restrictedNetworks []*net.IPNet = []*net.IPNet{
+		{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+		{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+		{IP: net.IPv4bcast, Mask: net.CIDRMask(32, 32)},
+	}
+
+	ErrRestrictedAddress error = errors.New("address is restricted by target protection")
+	ErrTargetNotAllowed  error = errors.New("this target is not allowed")
+	ErrRestrictedTarget  error = errors.New("this address resolves to a network that lookups are not allowed to reach")
+	ErrTargetOptedOut    error = errors.New("the owner of this server has opted out of public status lookups")
+)
+
+// LoadTargetProtection parses the configured allowed and blocked networks, and collects the addresses of the network
+// interfaces of this machine so that lookups cannot be pointed back at it.
+func LoadTargetProtection(protection ConfigTargetProtection) (err error) {
+	if allowedNetworks, err = parseNetworks(protection.AllowedNetworks); err != nil {
+		return err
+	}
+
+	if blockedNetworks, err = parseNetworks(protection.BlockedNetworks); err != nil {
+		return err
+	}
+
+	addresses, err := net.InterfaceAddrs()
+
+	if err != nil {
+		return err
+	}
+
+	ownAddresses = make([]net.IP, 0, len(addresses))
+
+	for _, address := range addresses {
+		if network, ok := address.(*net.IPNet); ok {
+			ownAddresses = append(ownAddresses, network.IP)
+		}
+	}
+
+	return nil
+}
+
+// IsRestrictedAddress returns whether status lookups are not allowed to connect to the IP address, which is the case
+// for loopback, link-local, private, carrier-grade NAT, multicast, broadcast and unspecified addresses, the addresses of
+// this machine and the configured blocked networks, unless the address is within one of the configured allowed networks.
+func IsRestrictedAddress(ip net.IP) bool {
+	for _, network := range allowedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsPrivate() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, network := range restrictedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	for _, address := range ownAddresses {
+		if address.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsRestrictedTarget returns whether the hostname, or the target of its SRV record if srv is true, resolves to an
+// address that status lookups are not allowed to connect to. Hostnames that fail to resolve are not restricted, as
+// the lookup itself will fail. The check only lets handlers refuse a lookup early, as DNS records may change before
+// the lookup connects, which is why probes also connect through NewTargetDialer or to an address from ResolveTarget.
+func IsRestrictedTarget(ctx context.Context, hostname string, srv bool) (bool, error) {
+	if !config.TargetProtection.Enable {
+		return false, nil
+	}
+
+	hosts := []string{hostname}
+
+	if srv {
+		record, _, err := LookupSRV(ctx, hostname)
+
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		if err == nil && record != nil {
+			hosts = append(hosts, strings.TrimSuffix(record.Target, "."))
+		}
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			if IsRestrictedAddress(ip) {
+				return true, nil
+			}
+
+			continue
+		}
+
+		addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		if err != nil {
+			continue
+		}
+
+		for _, address := range addresses {
+			if IsRestrictedAddress(address.IP) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// NewTargetDialer returns a dialer for connections to lookup targets, which refuses restricted addresses at the moment
+// of connecting, after any DNS resolution, so that a hostname cannot resolve to an allowed address when checked and to
+// a restricted address when connected to.
+func NewTargetDialer() *net.Dialer {
+	dialer := &net.Dialer{}
+
+	if config.TargetProtection.Enable {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || IsRestrictedAddress(ip) {
+				return fmt.Errorf("%w: %s", ErrRestrictedAddress, host)
+			}
+
+			return nil
+		}
+	}
+
+	return dialer
+}
+
+// ResolveTarget resolves the hostname to the IP address that a lookup made by mcutil must connect to, as mcutil
+// connects with its own dialer. The hostname is returned unchanged if target protection is disabled, and an error
+// wrapping ErrRestrictedAddress is returned if it resolves to a restricted address. Only protocols that do not send
+// the hostname to the server can connect to the IP address instead.
+func ResolveTarget(ctx context.Context, hostname string) (string, error) {
+	if !config.TargetProtection.Enable {
+		return hostname, nil
+	}
+
+	if ip := net.ParseIP(hostname); ip != nil {
+		if IsRestrictedAddress(ip) {
+			return "", fmt.Errorf("%w: %s", ErrRestrictedAddress, hostname)
+		}
+
+		return hostname, nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, address := range addresses {
+		if IsRestrictedAddress(address.IP) {
+			return "", fmt.Errorf("%w: %s resolves to %s", ErrRestrictedAddress, hostname, address.IP)
+		}
+	}
+
+	if len(addresses) < 1 {
+		return "", fmt.Errorf("no addresses found for %s", hostname)
+	}
+
+	return addresses[0].IP.String(), nil
+}
+
+// CheckTarget checks whether the server may be looked up, which everything that probes a server on behalf of a client
+// has to do first. The target of the SRV record is also checked if srv is true. ErrTargetNotAllowed is returned if the
+// tenant of the options may not look up the hostname, ErrRestrictedTarget if it resolves to a restricted address, and
+// ErrTargetOptedOut if the owner of the server opted out of public lookups. The options may be nil for lookups that are
+// not made on behalf of a tenant.
+func CheckTarget(ctx context.Context, opts *StatusOptions, edition, hostname string, port uint16, srv bool) error {
+	if opts != nil && !opts.IsAllowedTarget(hostname) {
+		return ErrTargetNotAllowed
+	}
+
+	restricted, err := IsRestrictedTarget(ctx, hostname, srv)
+
+	if err != nil {
+		return err
+	}
+
+	if restricted {
+		return ErrRestrictedTarget
+	}
+
+	optedOut, err := IsOptedOut(ctx, edition, hostname, port)
+
+	if err != nil {
+		return err
+	}
+
+	if optedOut {
+		return ErrTargetOptedOut
+	}
+
+	return nil
+}
+
+// CountTargetLookup counts a lookup of the server towards its hits and its hot target score.
+func CountTargetLookup(ctx context.Context, opts *StatusOptions, edition, hostname string, port uint16) error {
+	if err := r.Increment(ctx, fmt.Sprintf("%s-hits:%s", edition, fmt.Sprintf("%s:%d", hostname, port))); err != nil {
+		return err
+	}
+
+	return TrackHotTarget(ctx, edition, hostname, port, opts)
+}
+
+// CheckTargetRequest checks the server with CheckTarget, authenticates the request and counts the lookup, in that order
+// so that refused lookups are neither billed nor counted. False is returned if the lookup may not go ahead, in which
+// case a response has already been sent unless an error is returned.
+func CheckTargetRequest(ctx *fiber.Ctx, opts *StatusOptions, edition, hostname string, port uint16, srv bool) (bool, error) {
+	if err := CheckTarget(ctx.UserContext(), opts, edition, hostname, port, srv); err != nil {
+		return false, SendTargetError(ctx, err, hostname, port)
+	}
+
+	authorized, err := Authenticate(ctx)
+
+	// This check should work for both scenarios, because nil should be returned if the user
+	// is unauthorized, and err will be nil in that case.
+	if err != nil || !authorized {
+		return false, err
+	}
+
+	return true, CountTargetLookup(ctx.UserContext(), opts, edition, hostname, port)
+}
+
+// SendTargetError responds with the matching response for an error returned by CheckTarget, or returns any other error.
+func SendTargetError(ctx *fiber.Ctx, err error, hostname string, port uint16) error {
+	switch {
+	case errors.Is(err, ErrTargetNotAllowed):
+		return SendTargetNotAllowed(ctx)
+	case errors.Is(err, ErrRestrictedTarget):
+		return SendRestrictedTarget(ctx)
+	case errors.Is(err, ErrTargetOptedOut):
+		return SendPrivacyNotice(ctx, hostname, port)
+	default:
+		return err
+	}
+}
+
+// SendRestrictedTarget responds with the error returned when a lookup targets an address that is not allowed.
+func SendRestrictedTarget(ctx *fiber.Ctx) error {
+	return ctx.Status(http.StatusForbidden).SendString("This address resolves to a network that lookups are not allowed to reach")
+}
+
+func parseNetworks(values []string) ([]*net.IPNet, error) {
+	result := make([]*net.IPNet, 0, len(values))
+
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid network '%s': %w", value, err)
+		}
+
+		result = append(result, network)
+	}
+
+	return result, nil
+}
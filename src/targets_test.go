@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestIsRestrictedAddress(t *testing.T) {
+	tests := []struct {
+		Address    string
+		Restricted bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"192.168.0.10", true},
+		{"169.254.169.254", true},
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.127.255.254", true},
+		{"224.0.0.1", true},
+		{"239.1.2.3", true},
+		{"ff02::1", true},
+		{"ff0e::1", true},
+		{"255.255.255.255", true},
+		{"100.128.0.1", false},
+		{"1.1.1.1", false},
+		{"2606:4700:4700::1111", false},
+	}
+
+	for _, test := range tests {
+		if restricted := IsRestrictedAddress(net.ParseIP(test.Address)); restricted != test.Restricted {
+			t.Errorf("IsRestrictedAddress(%s) = %v, expected %v", test.Address, restricted, test.Restricted)
+		}
+	}
+}
+
+func TestTargetDialerRefusesRestrictedAddresses(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	// The hostname passes through the resolver, as a rebound DNS record would, before the dialer sees the address
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	for _, address := range []string{listener.Addr().String(), net.JoinHostPort("localhost", port)} {
+		conn, err := NewTargetDialer().DialContext(context.Background(), "tcp", address)
+
+		if err == nil {
+			conn.Close()
+		}
+
+		if !errors.Is(err, ErrRestrictedAddress) {
+			t.Errorf("dialing %s: expected ErrRestrictedAddress, got %v", address, err)
+		}
+	}
+
+	allowedNetworks, _ = parseNetworks([]string{"127.0.0.0/8", "::1"})
+
+	defer func() {
+		allowedNetworks = nil
+	}()
+
+	conn, err := NewTargetDialer().DialContext(context.Background(), "tcp", listener.Addr().String())
+
+	if err != nil {
+		t.Fatalf("dialing an allowed network: %v", err)
+	}
+
+	conn.Close()
+}
+
+func TestResolveTarget(t *testing.T) {
+	if _, err := ResolveTarget(context.Background(), "127.0.0.1"); !errors.Is(err, ErrRestrictedAddress) {
+		t.Errorf("expected ErrRestrictedAddress for a loopback address, got %v", err)
+	}
+
+	if _, err := ResolveTarget(context.Background(), "localhost"); !errors.Is(err, ErrRestrictedAddress) {
+		t.Errorf("expected ErrRestrictedAddress for localhost, got %v", err)
+	}
+
+	if address, err := ResolveTarget(context.Background(), "1.1.1.1"); err != nil || address != "1.1.1.1" {
+		t.Errorf("ResolveTarget(1.1.1.1) = %s, %v", address, err)
+	}
+}
+
+func TestCheckTarget(t *testing.T) {
+	opts := &StatusOptions{
+		Tenant: &ConfigTenant{
+			Name:           "test",
+			AllowedTargets: []string{"*.example.com", "127.0.0.1", "1.1.1.1"},
+		},
+	}
+
+	tests := []struct {
+		Options  *StatusOptions
+		Hostname string
+		Err      error
+	}{
+		{opts, "1.1.1.1", nil},
+		{opts, "8.8.8.8", ErrTargetNotAllowed},
+		{opts, "127.0.0.1", ErrRestrictedTarget},
+		{nil, "8.8.8.8", nil},
+		{nil, "10.0.0.1", ErrRestrictedTarget},
+	}
+
+	for _, test := range tests {
+		if err := CheckTarget(context.Background(), test.Options, "bedrock", test.Hostname, 19132, false); !errors.Is(err, test.Err) {
+			t.Errorf("CheckTarget(%s) = %v, expected %v", test.Hostname, err, test.Err)
+		}
+	}
+}
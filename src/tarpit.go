@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTarpit error = errors.New("server sent its response below the minimum throughput")
+)
+
+// IsTarpit checks whether the server was recently detected as a tarpit, in which case it must not be probed until the
+// cooldown ends.
+func IsTarpit(ctx context.Context, edition, hostname string, port uint16) (bool, error) {
+	if !config.Tarpit.Enable {
+		return false, nil
+	}
+
+	value, _, err := r.Get(ctx, fmt.Sprintf("tarpit:%s", GetOwnerKey(edition, hostname, port)))
+
+	return value != nil, err
+}
+
+// FlagTarpit flags the server as a tarpit, skipping its probes for the cooldown. It is meant for servers whose probe
+// was aborted with ErrTarpit.
+func FlagTarpit(ctx context.Context, edition, hostname string, port uint16) error {
+	tarpitDetections.WithLabelValues(edition).Inc()
+
+	log.Printf("Detected %s:%d as a tarpit, skipping its probes for %s\n", hostname, port, config.Tarpit.Cooldown)
+
+	return r.Set(ctx, fmt.Sprintf("tarpit:%s", GetOwnerKey(edition, hostname, port)), time.Now().Unix(), config.Tarpit.Cooldown)
+}
+
+// throughputConn is a connection that measures the throughput of the data read from it in windows of fixed length, and
+// fails the reads with ErrTarpit as soon as the server sends some, but fewer than the minimum bytes within a window.
+// A window without any data is not counted against the server, as it is unresponsive rather than hostile, and is left
+// to time out as usual.
+type throughputConn struct {
+	net.Conn
+	minBytes    int
+	window      time.Duration
+	windowStart time.Time
+	windowBytes int
+	deadline    time.Time
+	mutex       *sync.Mutex
+}
+
+// newThroughputConn wraps the connection to check the throughput of its reads against the minimum throughput in bytes
+// per second.
+func newThroughputConn(conn net.Conn, minThroughput uint, window time.Duration) *throughputConn {
+	return &throughputConn{
+		Conn:     conn,
+		minBytes: int(float64(minThroughput) * window.Seconds()),
+		window:   window,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// Read reads data from the connection, ending the underlying reads at the end of every window to check its throughput.
+func (c *throughputConn) Read(b []byte) (int, error) {
+	if c.windowStart.IsZero() {
+		c.windowStart = time.Now()
+	}
+
+	for {
+		windowEnd := c.windowStart.Add(c.window)
+		deadline := c.readDeadline()
+
+		readDeadline := windowEnd
+
+		if !deadline.IsZero() && deadline.Before(windowEnd) {
+			readDeadline = deadline
+		}
+
+		if err := c.Conn.SetReadDeadline(readDeadline); err != nil {
+			return 0, err
+		}
+
+		n, err := c.Conn.Read(b)
+
+		now := time.Now()
+
+		if now.Before(windowEnd) {
+			c.windowBytes += n
+
+			return n, err
+		}
+
+		// The window is over, so its throughput is checked before the bytes just read count towards the next one
+		if c.windowBytes > 0 && c.windowBytes < c.minBytes {
+			return n, ErrTarpit
+		}
+
+		c.windowStart, c.windowBytes = now, n
+
+		if n > 0 || !IsTimeoutError(err) || (!deadline.IsZero() && !now.Before(deadline)) {
+			return n, err
+		}
+	}
+}
+
+// SetDeadline sets the read and write deadlines of the connection.
+func (c *throughputConn) SetDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the connection.
+func (c *throughputConn) SetReadDeadline(t time.Time) error {
+	c.setReadDeadline(t)
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *throughputConn) readDeadline() time.Time {
+	c.mutex.Lock()
+
+	defer c.mutex.Unlock()
+
+	return c.deadline
+}
+
+func (c *throughputConn) setReadDeadline(t time.Time) {
+	c.mutex.Lock()
+
+	defer c.mutex.Unlock()
+
+	c.deadline = t
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestThroughputConn(t *testing.T) {
+	tests := []struct {
+		Name  string
+		Write func(conn net.Conn)
+		Err   error
+	}{
+		{"fast", func(conn net.Conn) {
+			conn.Write(make([]byte, 512))
+		}, nil},
+		{"dripping", func(conn net.Conn) {
+			for i := 0; i < 512; i++ {
+				if _, err := conn.Write([]byte{0}); err != nil {
+					return
+				}
+
+				time.Sleep(time.Millisecond * 20)
+			}
+		}, ErrTarpit},
+		{"silent", func(conn net.Conn) {}, os.ErrDeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		client, server := net.Pipe()
+
+		go func() {
+			test.Write(server)
+		}()
+
+		// A window of 100ms with 1000 bytes per second requires at least 100 bytes per window
+		conn := newThroughputConn(client, 1000, time.Millisecond*100)
+
+		conn.SetDeadline(time.Now().Add(time.Second))
+
+		_, err := io.ReadFull(conn, make([]byte, 512))
+
+		client.Close()
+		server.Close()
+
+		if !errors.Is(err, test.Err) {
+			t.Errorf("%s: expected %v, got %v", test.Name, test.Err, err)
+		}
+	}
+}
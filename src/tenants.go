@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetTenant returns the tenant profile selected by the API key or Host header of the request, or nil if the
+// request does not belong to any tenant. API keys take precedence over the Host header.
+func GetTenant(ctx *fiber.Ctx) *ConfigTenant {
+	if tenant := GetTenantByAPIKey(ctx.Get("X-API-Key")); tenant != nil {
+		return tenant
+	}
+
+	hostname := strings.ToLower(ctx.Hostname())
+
+	for i, tenant := range config.Tenants {
+		if Contains(tenant.Hosts, hostname) {
+			return &config.Tenants[i]
+		}
+	}
+
+	return nil
+}
+
+// GetTenantByAPIKey returns the tenant profile that the API key belongs to, or nil if there is none.
+func GetTenantByAPIKey(apiKey string) *ConfigTenant {
+	if len(apiKey) < 1 {
+		return nil
+	}
+
+	for i, tenant := range config.Tenants {
+		for _, key := range tenant.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+				return &config.Tenants[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// CacheDuration returns the cache duration of the resource for the tenant of the request, falling back to the
+// global cache configuration for every duration that the tenant leaves out.
+func (o *StatusOptions) CacheDuration(resource string) time.Duration {
+	if o.Tenant != nil && o.Tenant.Cache != nil {
+		if duration := getCacheDuration(*o.Tenant.Cache, resource); duration > 0 {
+			return duration
+		}
+	}
+
+	return getCacheDuration(config.Cache, resource)
+}
+
+// CacheFreshness returns the remaining lifetime of a cached resource under the cache durations of the tenant, as
+// entries written by other tenants may have been cached for longer than this tenant allows.
+func (o *StatusOptions) CacheFreshness(resource string, retrievedAt int64, ttl time.Duration) (time.Duration, bool) {
+	if o.Tenant == nil || o.Tenant.Cache == nil {
+		return ttl, true
+	}
+
+	remaining := time.Until(time.UnixMilli(retrievedAt).Add(o.CacheDuration(resource)))
+
+	if remaining <= 0 {
+		return 0, false
+	}
+
+	return min(ttl, remaining), true
+}
+
+// CacheValidator returns the validator that applies the cache durations of the tenant to cached statuses, or nil if
+// the tenant uses the global cache durations.
+func (o *StatusOptions) CacheValidator(resource string) CacheValidator {
+	if o.BypassCache || o.RefreshBefore > 0 {
+		return o.BypassCacheValidator()
+	}
+
+	if o.Tenant == nil || o.Tenant.Cache == nil {
+		return nil
+	}
+
+	return func(data []byte, ttl time.Duration) (time.Duration, bool) {
+		var status BaseStatus
+
+		if err := json.Unmarshal(data, &status); err != nil {
+			return 0, false
+		}
+
+		return o.CacheFreshness(resource, status.RetrievedAt, ttl)
+	}
+}
+
+// BypassCacheValidator returns the validator that rejects every cached value when the cache is bypassed, and cached
+// values that expire within the refresh window of a background refresh, so that a fresh value is fetched and
+// overwrites them. Nil is returned otherwise.
+func (o *StatusOptions) BypassCacheValidator() CacheValidator {
+	if !o.BypassCache && o.RefreshBefore <= 0 {
+		return nil
+	}
+
+	return func(data []byte, ttl time.Duration) (time.Duration, bool) {
+		if o.BypassCache || ttl < o.RefreshBefore {
+			return 0, false
+		}
+
+		return ttl, true
+	}
+}
+
+// IsAllowedTarget checks whether the tenant of the request is allowed to look up the hostname.
+func (o *StatusOptions) IsAllowedTarget(hostname string) bool {
+	if o.Tenant == nil || len(o.Tenant.AllowedTargets) < 1 {
+		return true
+	}
+
+	for _, pattern := range o.Tenant.AllowedTargets {
+		if pattern == hostname || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(hostname, pattern[1:])) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SendTargetNotAllowed responds with the error returned when a tenant requests a target it is not allowed to look up.
+func SendTargetNotAllowed(ctx *fiber.Ctx) error {
+	return ctx.Status(http.StatusForbidden).SendString("This address is not allowed for your tenant")
+}
+
+// getCacheDuration returns the cache duration of the resource in the cache configuration.
+func getCacheDuration(cache ConfigCache, resource string) time.Duration {
+	switch resource {
+	case "java":
+		return cache.JavaStatusDuration
+	case "bedrock":
+		return cache.BedrockStatusDuration
+	case "icon":
+		return cache.IconDuration
+	case "query":
+		return cache.QueryDuration
+	default:
+		return 0
+	}
+}
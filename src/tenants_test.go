@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCacheDuration(t *testing.T) {
+	partial := &StatusOptions{
+		Tenant: &ConfigTenant{
+			Name: "partial",
+			Cache: &ConfigCache{
+				JavaStatusDuration: time.Second * 10,
+			},
+		},
+	}
+
+	tests := []struct {
+		Name     string
+		Options  *StatusOptions
+		Resource string
+		Duration time.Duration
+	}{
+		{"no tenant", &StatusOptions{}, "java", config.Cache.JavaStatusDuration},
+		{"tenant without cache", &StatusOptions{Tenant: &ConfigTenant{Name: "empty"}}, "bedrock", config.Cache.BedrockStatusDuration},
+		{"tenant duration", partial, "java", time.Second * 10},
+		{"missing tenant duration", partial, "bedrock", config.Cache.BedrockStatusDuration},
+		{"missing tenant icon duration", partial, "icon", config.Cache.IconDuration},
+		{"missing tenant query duration", partial, "query", config.Cache.QueryDuration},
+		{"unknown resource", partial, "unknown", 0},
+	}
+
+	for _, test := range tests {
+		if duration := test.Options.CacheDuration(test.Resource); duration != test.Duration {
+			t.Errorf("%s: CacheDuration(%s) = %s, expected %s", test.Name, test.Resource, duration, test.Duration)
+		}
+	}
+}
+
+func TestCacheFreshness(t *testing.T) {
+	opts := &StatusOptions{
+		Tenant: &ConfigTenant{
+			Name: "partial",
+			Cache: &ConfigCache{
+				JavaStatusDuration: time.Second * 10,
+			},
+		},
+	}
+
+	now := time.Now()
+
+	tests := []struct {
+		Name        string
+		Options     *StatusOptions
+		Resource    string
+		RetrievedAt time.Time
+		TTL         time.Duration
+		Fresh       bool
+		MaxTTL      time.Duration
+	}{
+		{"no tenant", &StatusOptions{}, "java", now.Add(-time.Hour), time.Minute, true, time.Minute},
+		{"fresh", opts, "java", now.Add(-time.Second * 5), time.Minute, true, time.Second * 5},
+		{"stale", opts, "java", now.Add(-time.Second * 11), time.Minute, false, 0},
+		{"shorter ttl", opts, "java", now, time.Second * 2, true, time.Second * 2},
+		{"global fallback", opts, "bedrock", now.Add(-time.Second * 30), time.Minute, true, config.Cache.BedrockStatusDuration - time.Second*30},
+		{"global fallback stale", opts, "bedrock", now.Add(-config.Cache.BedrockStatusDuration - time.Second), time.Minute, false, 0},
+	}
+
+	for _, test := range tests {
+		ttl, fresh := test.Options.CacheFreshness(test.Resource, test.RetrievedAt.UnixMilli(), test.TTL)
+
+		if fresh != test.Fresh {
+			t.Errorf("%s: expected fresh to be %v", test.Name, test.Fresh)
+
+			continue
+		}
+
+		if ttl > test.MaxTTL || (fresh && ttl <= 0) {
+			t.Errorf("%s: remaining lifetime of %s, expected at most %s", test.Name, ttl, test.MaxTTL)
+		}
+	}
+}
+
+func TestTenantRateLimit(t *testing.T) {
+	useTestRedis(t)
+
+	previousTenants, previousAPIKeys, previousRateLimit := config.Tenants, config.APIKeys, config.RateLimit
+
+	config.Tenants = []ConfigTenant{{
+		Name:    "limited",
+		APIKeys: []string{"tenant-key"},
+		RateLimit: &ConfigTenantRateLimit{
+			RequestsPerMinute: 1,
+			Burst:             2,
+		},
+	}}
+	config.APIKeys.Enable = true
+	config.RateLimit.Burst = 1
+	config.RateLimit.RequestsPerMinute = 1
+
+	t.Cleanup(func() {
+		config.Tenants, config.APIKeys, config.RateLimit = previousTenants, previousAPIKeys, previousRateLimit
+	})
+
+	app := fiber.New()
+
+	app.Get("/", LimitRequestRate, CheckAPIKey, func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		Name     string
+		Enable   bool
+		APIKey   string
+		Statuses []int
+	}{
+		{"tenant key without rate limiting", false, "tenant-key", []int{200, 200, 429}},
+		{"tenant key with rate limiting", true, "tenant-key", []int{429}},
+		{"client with rate limiting", true, "", []int{200, 429}},
+	}
+
+	for _, test := range tests {
+		config.RateLimit.Enable = test.Enable
+
+		for i, status := range test.Statuses {
+			req := httptest.NewRequest("GET", "/", nil)
+
+			if len(test.APIKey) > 0 {
+				req.Header.Set("X-API-Key", test.APIKey)
+			}
+
+			resp, err := app.Test(req)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != status {
+				t.Errorf("%s: request %d returned status %d, expected %d", test.Name, i+1, resp.StatusCode, status)
+			}
+		}
+	}
+}
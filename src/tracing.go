@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const debugCapturesMax = 50
+
+var (
+	traceParentRegEx *regexp.Regexp = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+	ErrDebugSessionNotFound error = errors.New("debug mode is not enabled for this host")
+	ErrTraceNotFound        error = errors.New("no sampled trace exists with this ID")
+)
+
+type traceContextKey struct{}
+
+// TraceContext is the W3C trace context of a request. The trace ID is taken from the traceparent header of the
+// request if it has one, and every request is its own span within the trace. Sampled requests are stored under a
+// sample ID generated by the server, as the trace ID is chosen by the client.
+type TraceContext struct {
+	TraceID  string
+	ParentID *string
+	SpanID   string
+	Sampled  bool
+	SampleID string
+	Probes   []ProbeTrace
+	Mutex    *sync.Mutex
+}
+
+// RequestTrace is a sampled request along with the probes made on its behalf, stored so that it can be looked up by
+// its sample ID.
+type RequestTrace struct {
+	SampleID  string       `json:"sample_id"`
+	TraceID   string       `json:"trace_id"`
+	ParentID  *string      `json:"parent_id"`
+	SpanID    string       `json:"span_id"`
+	Method    string       `json:"method"`
+	Path      string       `json:"path"`
+	Status    int          `json:"status"`
+	CacheHit  *bool        `json:"cache_hit"`
+	StartedAt int64        `json:"started_at"`
+	Duration  int64        `json:"duration"`
+	Probes    []ProbeTrace `json:"probes"`
+}
+
+// DebugSession enables verbose probe logging and payload capture for a single host until it expires.
+type DebugSession struct {
+	Hostname  string `json:"hostname"`
+	StartedAt int64  `json:"started_at"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// DebugSessionResponse is the debug session of a host along with the probes captured during it, newest first.
+type DebugSessionResponse struct {
+	DebugSession
+	Captures []ProbeTrace `json:"captures"`
+}
+
+// ProbeTrace is the detailed record of a single probe made while debug mode was enabled for its host, or on behalf
+// of a sampled request.
+type ProbeTrace struct {
+	TraceID       *string          `json:"trace_id"`
+	Edition       string           `json:"edition"`
+	Hostname      string           `json:"hostname"`
+	Port          uint16           `json:"port"`
+	StartedAt     int64            `json:"started_at"`
+	Duration      int64            `json:"duration"`
+	Steps         []ProbeTraceStep `json:"steps"`
+	ICMPReachable *bool            `json:"icmp_reachable"`
+	Result        interface{}      `json:"result"`
+	Mutex         *sync.Mutex      `json:"-"`
+}
+
+// ProbeTraceStep is a single network request made during a traced probe.
+type ProbeTraceStep struct {
+	Name     string  `json:"name"`
+	Duration int64   `json:"duration"`
+	Error    *string `json:"error"`
+	TimedOut bool    `json:"timed_out"`
+}
+
+// GetDebugSessionKey returns the key of the debug session of the hostname.
+func GetDebugSessionKey(hostname string) string {
+	return fmt.Sprintf("debug-session:%s", strings.ToLower(hostname))
+}
+
+// GetDebugCapturesKey returns the key of the probes captured during the debug session of the hostname.
+func GetDebugCapturesKey(hostname string) string {
+	return fmt.Sprintf("debug-captures:%s", strings.ToLower(hostname))
+}
+
+// GetDebugSession returns the active debug session of the hostname, or nil if debug mode is not enabled for it.
+func GetDebugSession(ctx context.Context, hostname string) (*DebugSession, error) {
+	data, _, err := r.Get(ctx, GetDebugSessionKey(hostname))
+
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var session DebugSession
+
+	return &session, json.Unmarshal(data, &session)
+}
+
+// StartDebugSession enables debug mode for the hostname for the given duration, replacing any active session.
+func StartDebugSession(ctx context.Context, hostname string, duration time.Duration) (*DebugSession, error) {
+	session := &DebugSession{
+		Hostname:  strings.ToLower(hostname),
+		StartedAt: time.Now().UnixMilli(),
+		ExpiresAt: time.Now().Add(duration).UnixMilli(),
+	}
+
+	data, err := json.Marshal(session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.Delete(ctx, GetDebugCapturesKey(hostname)); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Enabled debug mode for %s until %s\n", session.Hostname, time.UnixMilli(session.ExpiresAt).UTC().Format(time.RFC3339))
+
+	return session, r.Set(ctx, GetDebugSessionKey(hostname), data, duration)
+}
+
+// StopDebugSession disables debug mode for the hostname and discards its captured probes.
+func StopDebugSession(ctx context.Context, hostname string) error {
+	log.Printf("Disabled debug mode for %s\n", strings.ToLower(hostname))
+
+	return r.Delete(ctx, GetDebugSessionKey(hostname), GetDebugCapturesKey(hostname))
+}
+
+// StartProbeTrace returns a new trace for the probe if debug mode is enabled for the hostname or the request it is
+// made for is sampled, or nil otherwise. Every method of ProbeTrace can safely be called on nil, so callers do not
+// need to check whether tracing is enabled.
+func StartProbeTrace(ctx context.Context, edition, hostname string, port uint16) *ProbeTrace {
+	var traceID *string = nil
+
+	if trace := GetTraceContext(ctx); trace != nil {
+		traceID = &trace.TraceID
+
+		if !trace.Sampled {
+			session, err := GetDebugSession(ctx, hostname)
+
+			if err != nil || session == nil {
+				return nil
+			}
+		}
+	} else if session, err := GetDebugSession(ctx, hostname); err != nil || session == nil {
+		return nil
+	}
+
+	return &ProbeTrace{
+		TraceID:       traceID,
+		Edition:       edition,
+		Hostname:      hostname,
+		Port:          port,
+		StartedAt:     time.Now().UnixMilli(),
+		Steps:         make([]ProbeTraceStep, 0),
+		ICMPReachable: nil,
+		Result:        nil,
+		Mutex:         &sync.Mutex{},
+	}
+}
+
+// Step records a network request that started at the given time and finished with the error, which may be nil.
+func (t *ProbeTrace) Step(name string, start time.Time, err error) {
+	if t == nil {
+		return
+	}
+
+	step := ProbeTraceStep{
+		Name:     name,
+		Duration: time.Since(start).Milliseconds(),
+		Error:    nil,
+		TimedOut: IsTimeoutError(err),
+	}
+
+	if err != nil {
+		step.Error = PointerOf(err.Error())
+	}
+
+	log.Printf("Debug: %s %s:%d: %s took %dms (error: %v, trace: %s)\n", t.Edition, t.Hostname, t.Port, name, step.Duration, err, FormatTraceID(t.TraceID))
+
+	t.Mutex.Lock()
+
+	defer t.Mutex.Unlock()
+
+	t.Steps = append(t.Steps, step)
+}
+
+// CheckICMP sends an ICMP echo request to the resolved IP address of the server if enabled and any status request of
+// the probe timed out, recording whether the host replied. This tells a host that is down apart from a host that is up
+// but where the server is not running or is firewalled.
+func (t *ProbeTrace) CheckICMP(ctx context.Context, ipAddress *string) {
+	if t == nil || !config.Diagnostics.ICMPCheck || ipAddress == nil {
+		return
+	}
+
+	t.Mutex.Lock()
+
+	timedOut := false
+
+	for _, step := range t.Steps {
+		timedOut = timedOut || (step.TimedOut && step.Name != "srv")
+	}
+
+	t.Mutex.Unlock()
+
+	if !timedOut {
+		return
+	}
+
+	// The address was resolved after the status requests, so it is checked again rather than trusted
+	if ip := net.ParseIP(*ipAddress); config.TargetProtection.Enable && (ip == nil || IsRestrictedAddress(ip)) {
+		return
+	}
+
+	start := time.Now()
+
+	reachable, err := PingICMP(ctx, *ipAddress, config.Diagnostics.ICMPTimeout)
+
+	t.Step("icmp", start, err)
+
+	if err == nil {
+		t.ICMPReachable = &reachable
+	}
+}
+
+// Finish records the unprocessed result of the probe and stores the trace with the captures of the debug session.
+func (t *ProbeTrace) Finish(ctx context.Context, result interface{}) {
+	if t == nil {
+		return
+	}
+
+	t.Result = result
+	t.Duration = time.Now().UnixMilli() - t.StartedAt
+
+	if trace := GetTraceContext(ctx); trace != nil && trace.Sampled {
+		trace.Mutex.Lock()
+		trace.Probes = append(trace.Probes, *t)
+		trace.Mutex.Unlock()
+	}
+
+	// The probe context may have been cancelled, but the capture should still be stored
+	ctx = context.WithoutCancel(ctx)
+
+	session, err := GetDebugSession(ctx, t.Hostname)
+
+	if err != nil || session == nil {
+		return
+	}
+
+	data, err := json.Marshal(t)
+
+	if err != nil {
+		log.Printf("Failed to encode probe trace: %v\n", err)
+
+		return
+	}
+
+	log.Printf("Debug: %s %s:%d: probe finished in %dms: %s\n", t.Edition, t.Hostname, t.Port, t.Duration, data)
+
+	if err = r.ListPush(ctx, GetDebugCapturesKey(t.Hostname), data, debugCapturesMax); err != nil {
+		log.Printf("Failed to store probe trace: %v\n", err)
+
+		return
+	}
+
+	if err = r.Expire(ctx, GetDebugCapturesKey(t.Hostname), time.Until(time.UnixMilli(session.ExpiresAt))); err != nil {
+		log.Printf("Failed to expire probe traces: %v\n", err)
+	}
+}
+
+// GetTraceContext returns the trace context of the request that the context belongs to, or nil if there is none.
+func GetTraceContext(ctx context.Context) *TraceContext {
+	trace, _ := ctx.Value(traceContextKey{}).(*TraceContext)
+
+	return trace
+}
+
+// GetRequestTraceID returns the trace ID of the request, or nil if it is not traced.
+func GetRequestTraceID(ctx *fiber.Ctx) *string {
+	if trace := GetTraceContext(ctx.UserContext()); trace != nil {
+		return &trace.TraceID
+	}
+
+	return nil
+}
+
+// FormatTraceID returns the trace ID for use in log messages.
+func FormatTraceID(traceID *string) string {
+	if traceID == nil {
+		return "none"
+	}
+
+	return *traceID
+}
+
+// TraceParent returns the traceparent header value identifying the span of the request.
+func (t *TraceContext) TraceParent() string {
+	flags := "00"
+
+	if t.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%s-%s-%s", t.TraceID, t.SpanID, flags)
+}
+
+// ParseTraceParent returns the trace ID and parent span ID of a W3C traceparent header value, or false if the value is
+// not a valid traceparent header.
+func ParseTraceParent(value string) (string, string, bool) {
+	match := traceParentRegEx.FindStringSubmatch(strings.TrimSpace(value))
+
+	if match == nil || match[1] == "ff" || strings.Trim(match[2], "0") == "" || strings.Trim(match[3], "0") == "" {
+		return "", "", false
+	}
+
+	return match[2], match[3], true
+}
+
+// TraceRequests is a middleware that continues the trace of the traceparent header of the request, or starts a new
+// one, and echoes the span of the request in the traceparent and X-Trace-ID response headers. Clients may force the
+// request to be sampled with the 'trace' query parameter, within the hourly budget of their API key or IP address,
+// in which case the request and the probes made for it are stored and can be looked up by the sample ID in the
+// X-Trace-Sample-ID response header.
+func TraceRequests(ctx *fiber.Ctx) error {
+	trace := &TraceContext{
+		TraceID:  RandomHexString(16),
+		ParentID: nil,
+		SpanID:   RandomHexString(8),
+		Sampled:  false,
+		Probes:   make([]ProbeTrace, 0),
+		Mutex:    &sync.Mutex{},
+	}
+
+	if traceID, parentID, ok := ParseTraceParent(ctx.Get("traceparent")); ok {
+		trace.TraceID = traceID
+		trace.ParentID = &parentID
+	}
+
+	if ctx.QueryBool("trace", false) {
+		sampled, err := TakeForcedSample(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		trace.Sampled = sampled
+	}
+
+	if trace.Sampled {
+		trace.SampleID = RandomHexString(16)
+
+		ctx.Set("X-Trace-Sample-ID", trace.SampleID)
+	}
+
+	ctx.SetUserContext(context.WithValue(ctx.UserContext(), traceContextKey{}, trace))
+
+	ctx.Set("traceparent", trace.TraceParent())
+	ctx.Set("X-Trace-ID", trace.TraceID)
+
+	start := time.Now()
+	err := ctx.Next()
+
+	if !trace.Sampled {
+		return err
+	}
+
+	status := ctx.Response().StatusCode()
+
+	if err != nil {
+		status = http.StatusInternalServerError
+
+		var fiberError *fiber.Error
+
+		if errors.As(err, &fiberError) {
+			status = fiberError.Code
+		}
+	}
+
+	var cacheHit *bool = nil
+
+	if value, parseErr := strconv.ParseBool(ctx.GetRespHeader("X-Cache-Hit")); parseErr == nil {
+		cacheHit = &value
+	}
+
+	trace.Mutex.Lock()
+
+	defer trace.Mutex.Unlock()
+
+	data, marshalErr := json.Marshal(RequestTrace{
+		SampleID:  trace.SampleID,
+		TraceID:   trace.TraceID,
+		ParentID:  trace.ParentID,
+		SpanID:    trace.SpanID,
+		Method:    ctx.Method(),
+		Path:      ctx.OriginalURL(),
+		Status:    status,
+		CacheHit:  cacheHit,
+		StartedAt: start.UnixMilli(),
+		Duration:  time.Since(start).Milliseconds(),
+		Probes:    trace.Probes,
+	})
+
+	if marshalErr != nil {
+		log.Printf("Failed to encode request trace: %v\n", marshalErr)
+
+		return err
+	}
+
+	if setErr := r.Set(context.WithoutCancel(ctx.UserContext()), GetTraceKey(trace.SampleID), data, config.Tracing.Retention); setErr != nil {
+		log.Printf("Failed to store request trace: %v\n", setErr)
+	}
+
+	return err
+}
+
+// TakeForcedSample counts a forced sample against the hourly budget of the API key of the request, or of its IP
+// address if it has no valid one, and returns whether the budget allows the request to be sampled.
+func TakeForcedSample(ctx *fiber.Ctx) (bool, error) {
+	if config.Tracing.ForcedSamplesPerHour < 1 {
+		return false, nil
+	}
+
+	client := ctx.IP()
+
+	// Only provisioned and tenant keys get a budget of their own, as made up keys would otherwise get a fresh one each
+	if apiKey := ctx.Get("X-API-Key"); len(apiKey) > 0 {
+		key, err := GetAPIKey(ctx.UserContext(), apiKey)
+
+		if err != nil {
+			return false, err
+		}
+
+		if key != nil || GetTenantByAPIKey(apiKey) != nil {
+			client = SHA256(apiKey)
+		}
+	}
+
+	count, err := r.IncrementWithExpiry(ctx.UserContext(), fmt.Sprintf("trace-budget:%s:%d", client, time.Now().Unix()/3600), time.Hour)
+
+	if err != nil {
+		return false, err
+	}
+
+	return count <= int64(config.Tracing.ForcedSamplesPerHour), nil
+}
+
+// GetTraceKey returns the key of the stored sampled request with the sample ID.
+func GetTraceKey(sampleID string) string {
+	return fmt.Sprintf("trace:%s", strings.ToLower(sampleID))
+}
+
+// GetRequestTraceHandler returns the sampled request with the sample ID in the parameters.
+func GetRequestTraceHandler(ctx *fiber.Ctx) error {
+	data, _, err := r.Get(ctx.UserContext(), GetTraceKey(ctx.Params("id")))
+
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		return ctx.Status(http.StatusNotFound).SendString(ErrTraceNotFound.Error())
+	}
+
+	return ctx.Type("json").Send(data)
+}
+
+// StartDebugSessionHandler enables debug mode for the hostname for the duration in the query parameters.
+func StartDebugSessionHandler(ctx *fiber.Ctx) error {
+	duration, err := time.ParseDuration(ctx.Query("duration", "10m"))
+
+	if err != nil || duration <= 0 || duration > config.Diagnostics.MaxDebugSessionDuration {
+		return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Invalid 'duration' query parameter, must be between 0s and %s", config.Diagnostics.MaxDebugSessionDuration))
+	}
+
+	session, err := StartDebugSession(ctx.UserContext(), ctx.Params("hostname"), duration)
+
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(http.StatusCreated).JSON(session)
+}
+
+// GetDebugSessionHandler returns the debug session of the hostname and the probes captured during it.
+func GetDebugSessionHandler(ctx *fiber.Ctx) error {
+	session, err := GetDebugSession(ctx.UserContext(), ctx.Params("hostname"))
+
+	if err != nil {
+		return err
+	}
+
+	if session == nil {
+		return ctx.Status(http.StatusNotFound).SendString(ErrDebugSessionNotFound.Error())
+	}
+
+	values, err := r.ListRange(ctx.UserContext(), GetDebugCapturesKey(session.Hostname), 0, debugCapturesMax-1)
+
+	if err != nil {
+		return err
+	}
+
+	result := DebugSessionResponse{
+		DebugSession: *session,
+		Captures:     make([]ProbeTrace, 0, len(values)),
+	}
+
+	for _, value := range values {
+		var trace ProbeTrace
+
+		if err = json.Unmarshal([]byte(value), &trace); err != nil {
+			return err
+		}
+
+		result.Captures = append(result.Captures, trace)
+	}
+
+	return ctx.JSON(result)
+}
+
+// StopDebugSessionHandler disables debug mode for the hostname before its session expires.
+func StopDebugSessionHandler(ctx *fiber.Ctx) error {
+	if err := StopDebugSession(ctx.UserContext(), ctx.Params("hostname")); err != nil {
+		return err
+	}
+
+	return ctx.SendStatus(http.StatusNoContent)
+}
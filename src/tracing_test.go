@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTakeForcedSample(t *testing.T) {
+	useTestRedis(t)
+
+	previous := config.Tracing
+
+	config.Tracing.ForcedSamplesPerHour = 1
+
+	t.Cleanup(func() {
+		config.Tracing = previous
+	})
+
+	validKey, err := CreateAPIKey(context.Background(), "tracing", 0, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+
+	app.Get("/", TraceRequests, func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusOK)
+	})
+
+	// Made up keys share the budget of the IP address, while a valid key has its own
+	tests := []struct {
+		Name    string
+		Key     string
+		Sampled bool
+	}{
+		{"ip address", "", true},
+		{"made up key", "made-up", false},
+		{"other made up key", "other-made-up", false},
+		{"valid key", validKey.Key, true},
+		{"valid key over budget", validKey.Key, false},
+	}
+
+	sampleIDs := make(map[string]bool)
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/?trace=true", nil)
+
+		req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+
+		if len(test.Key) > 0 {
+			req.Header.Set("X-API-Key", test.Key)
+		}
+
+		resp, err := app.Test(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sampleID := resp.Header.Get("X-Trace-Sample-ID")
+
+		if sampled := len(sampleID) > 0; sampled != test.Sampled {
+			t.Errorf("%s: expected sampled to be %v", test.Name, test.Sampled)
+
+			continue
+		}
+
+		if !test.Sampled {
+			continue
+		}
+
+		// The client chooses the trace ID, so the sample is stored under an ID of its own
+		if sampleID == "0af7651916cd43dd8448eb211c80319c" || sampleIDs[sampleID] {
+			t.Errorf("%s: expected a new sample ID, got %s", test.Name, sampleID)
+		}
+
+		sampleIDs[sampleID] = true
+
+		if data, _, err := r.Get(context.Background(), GetTraceKey(sampleID)); err != nil || data == nil {
+			t.Errorf("%s: expected the sample to be stored, got %v", test.Name, err)
+		}
+	}
+}
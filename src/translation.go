@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	translator Translator = nil
+)
+
+// Translator translates text into another language.
+type Translator interface {
+	// Name returns the name of the provider, used in cache keys and logs.
+	Name() string
+	// Translate returns the text translated into the language, given as an ISO 639-1 code.
+	Translate(ctx context.Context, text, language string) (string, error)
+}
+
+// LibreTranslate is a Translator using a LibreTranslate instance.
+type LibreTranslate struct {
+	URL    string
+	APIKey string
+}
+
+// Name returns the name of the provider.
+func (t *LibreTranslate) Name() string {
+	return "libretranslate"
+}
+
+// Translate returns the text translated into the language, letting LibreTranslate detect the source language.
+func (t *LibreTranslate) Translate(ctx context.Context, text, language string) (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"q":       text,
+		"source":  "auto",
+		"target":  language,
+		"format":  "text",
+		"api_key": t.APIKey,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/translate", strings.TrimSuffix(t.URL, "/")), bytes.NewReader(body))
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("libretranslate: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		TranslatedText string `json:"translatedText"`
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	return result.TranslatedText, nil
+}
+
+// NewTranslator returns the translator configured in the translation settings, or nil if translation is disabled.
+func NewTranslator() Translator {
+	if config.Translation.LibreTranslate != nil {
+		return &LibreTranslate{
+			URL:    config.Translation.LibreTranslate.URL,
+			APIKey: config.Translation.LibreTranslate.APIKey,
+		}
+	}
+
+	return nil
+}
+
+// GetRequestLanguage returns the primary language subtag of the most preferred language in the Accept-Language header
+// that translations are allowed for, or an empty string if there is none.
+func GetRequestLanguage(ctx *fiber.Ctx) string {
+	var (
+		result  string  = ""
+		quality float64 = 0
+	)
+
+	for _, value := range strings.Split(ctx.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(value), ";")
+
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		if len(language) < 2 || language == "*" {
+			continue
+		}
+
+		if len(config.Translation.Languages) > 0 && !Contains(config.Translation.Languages, language) {
+			continue
+		}
+
+		q := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if _, err := fmt.Sscanf(value, "%g", &q); err != nil {
+				continue
+			}
+		}
+
+		if q > quality {
+			result = language
+			quality = q
+		}
+	}
+
+	return result
+}
+
+// TranslateText translates the text into the language using the configured translator, caching the result.
+func TranslateText(ctx context.Context, text, language string) (string, error) {
+	data, _, err := cacheStore.GetOrSet(ctx, fmt.Sprintf("translation:%s:%s:%s", translator.Name(), language, SHA256(text)), func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(ctx, config.Translation.Timeout)
+
+		defer cancel()
+
+		result, err := translator.Translate(ctx, text, language)
+
+		return []byte(result), err
+	}, config.Translation.CacheDuration, nil)
+
+	return string(data), err
+}
+
+// TranslateMOTD sets the translated property of the MOTD to the clean MOTD translated into the language requested in
+// the Accept-Language header. Translation failures are logged rather than failing the request.
+func TranslateMOTD(ctx *fiber.Ctx, motd *MOTD) {
+	if translator == nil {
+		return
+	}
+
+	ctx.Vary(fiber.HeaderAcceptLanguage)
+
+	if motd == nil || len(strings.TrimSpace(motd.Clean)) < 1 {
+		return
+	}
+
+	language := GetRequestLanguage(ctx)
+
+	if len(language) < 1 {
+		return
+	}
+
+	result, err := TranslateText(ctx.UserContext(), motd.Clean, language)
+
+	if err != nil {
+		log.Printf("Failed to translate MOTD: %v\n", err)
+
+		return
+	}
+
+	motd.Translated = &result
+}
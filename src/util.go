@@ -1,15 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/subtle"
 	_ "embed"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -20,15 +25,51 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/mcstatus-io/mcutil/v4/util"
 	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/net/dns/dnsmessage"
 )
 
 var (
-	blockedServers *MutexArray[string] = nil
-	hostRegEx      *regexp.Regexp      = regexp.MustCompile(`^[A-Za-z0-9-_]+(\.[A-Za-z0-9-_]+)+(:\d{1,5})?$`)
-	ipAddressRegEx *regexp.Regexp      = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}$`)
+	blockedServers          *MutexArray[string] = nil
+	blockedServersFetchedAt time.Time           = time.Time{}
+	hostRegEx               *regexp.Regexp      = regexp.MustCompile(`^[A-Za-z0-9-_]+(\.[A-Za-z0-9-_]+)+(:\d{1,5})?$`)
+	ipAddressRegEx          *regexp.Regexp      = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}$`)
+	startedAt               time.Time           = time.Now()
 )
 
+const (
+	// PortSourceExplicit is used when the port was specified in the requested address.
+	PortSourceExplicit = "explicit"
+	// PortSourceDefault is used when the edition's default port was used.
+	PortSourceDefault = "default"
+	// PortSourceSRV is used when the port was taken from the SRV record of the hostname.
+	PortSourceSRV = "srv"
+	// PortSourceOverride is used when the port was taken from the configured port overrides.
+	PortSourceOverride = "override"
+)
+
+const (
+	// BlocklistSourceMojang is used when an address is blocked by Mojang's list of blocked servers.
+	BlocklistSourceMojang = "mojang"
+	// BlocklistSourceLocal is used when an address is blocked by the local blocklist of this instance.
+	BlocklistSourceLocal = "local"
+
+	// BlocklistMatchExact is used when the blocklist contains the address itself.
+	BlocklistMatchExact = "exact"
+	// BlocklistMatchWildcard is used when the blocklist contains a wildcard covering the address.
+	BlocklistMatchWildcard = "wildcard"
+	// BlocklistMatchNetwork is used when the blocklist contains a network that the IP address is part of.
+	BlocklistMatchNetwork = "network"
+)
+
+// BlocklistMatch is the single blocklist pattern that caused an address to be blocked.
+type BlocklistMatch struct {
+	Source  string `json:"source"`
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+}
+
 // VoteOptions is the options provided as query parameters to the vote route.
 type VoteOptions struct {
 	IPAddress   string
@@ -45,8 +86,38 @@ type VoteOptions struct {
 
 // StatusOptions is the options provided as query parameters to the status route.
 type StatusOptions struct {
-	Query   bool
-	Timeout time.Duration
+	Query             bool
+	Timeout           time.Duration
+	Trigger           string
+	SkipProbeInterval bool
+	BypassCache       bool
+	RefreshBefore     time.Duration
+	IncludeRaw        bool
+	Tenant            *ConfigTenant
+}
+
+// StatusRequest is the body accepted by the POST status routes, an alternative to the address route parameter for
+// clients that cannot easily encode IPv6 literals or internationalized hostnames in a URL.
+type StatusRequest struct {
+	Host    string               `json:"host"`
+	Port    *uint16              `json:"port"`
+	Options StatusRequestOptions `json:"options"`
+}
+
+// StatusRequestOptions is the options of a status request body, with the same meaning as the query parameters.
+type StatusRequestOptions struct {
+	Query       *bool    `json:"query"`
+	Timeout     *float64 `json:"timeout"`
+	IncludeRaw  *bool    `json:"include_raw"`
+	BypassCache *bool    `json:"bypass_cache"`
+}
+
+// WithSkipProbeInterval returns a copy of the options that always results in a fresh probe.
+func (o *StatusOptions) WithSkipProbeInterval() *StatusOptions {
+	result := *o
+	result.SkipProbeInterval = true
+
+	return &result
 }
 
 // MutexArray is a thread-safe array for storing and retrieving values.
@@ -94,20 +165,35 @@ func GetBlockedServerList() error {
 		List:  strings.Split(string(body), "\n"),
 		Mutex: &sync.Mutex{},
 	}
+	blockedServersFetchedAt = time.Now()
 
 	return nil
 }
 
-// IsBlockedAddress checks if the given address is in the blocked servers list.
+// IsBlockedAddress checks if the given address is in the blocked servers list or the local blocklist.
 func IsBlockedAddress(address string) bool {
+	return MatchBlockedAddress(address) != nil
+}
+
+// MatchBlockedAddress returns the pattern of the local blocklist or the blocked servers list that the address matches,
+// or nil if the address is not blocked.
+func MatchBlockedAddress(address string) *BlocklistMatch {
+	if match := MatchLocallyBlockedAddress(address); match != nil {
+		return match
+	}
+
 	addressSegments := strings.Split(strings.ToLower(address), ".")
 	isIPv4Address := ipAddressRegEx.MatchString(address)
 
 	for i := range addressSegments {
-		var checkAddress string
+		var (
+			checkAddress string
+			matchType    string = BlocklistMatchWildcard
+		)
 
 		if i == 0 {
 			checkAddress = strings.Join(addressSegments, ".")
+			matchType = BlocklistMatchExact
 		} else if isIPv4Address {
 			checkAddress = fmt.Sprintf("%s.*", strings.Join(addressSegments[0:len(addressSegments)-i], "."))
 		} else {
@@ -115,15 +201,185 @@ func IsBlockedAddress(address string) bool {
 		}
 
 		if blockedServers.Has(SHA256(checkAddress)) {
-			return true
+			return &BlocklistMatch{
+				Source:  BlocklistSourceMojang,
+				Pattern: checkAddress,
+				Type:    matchType,
+			}
 		}
 	}
 
-	return false
+	return nil
+}
+
+// LookupSRV resolves the Minecraft SRV record of the hostname along with its TTL in seconds, returning nil if there is
+// no record. The TTL is nil if it could not be determined.
+func LookupSRV(ctx context.Context, hostname string) (*net.SRV, *uint32, error) {
+	_, records, err := net.DefaultResolver.LookupSRV(ctx, "minecraft", "tcp", hostname)
+
+	if err != nil || len(records) < 1 {
+		return nil, nil, err
+	}
+
+	return records[0], LookupSRVTTL(ctx, hostname), nil
+}
+
+// LookupSRVTTL queries the first nameserver in /etc/resolv.conf for the Minecraft SRV record of the hostname and
+// returns the lowest TTL of the answers, as the standard resolver does not expose TTLs. Nil is returned if the
+// nameserver cannot be queried or has no answer.
+func LookupSRVTTL(ctx context.Context, hostname string) *uint32 {
+	nameserver := getNameserver()
+
+	if nameserver == nil {
+		return nil
+	}
+
+	name, err := dnsmessage.NewName(fmt.Sprintf("_minecraft._tcp.%s.", strings.TrimSuffix(hostname, ".")))
+
+	if err != nil {
+		return nil
+	}
+
+	id := uint16(time.Now().UnixNano())
+
+	query, err := (&dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               id,
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{
+			{
+				Name:  name,
+				Type:  dnsmessage.TypeSRV,
+				Class: dnsmessage.ClassINET,
+			},
+		},
+	}).Pack()
+
+	if err != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", net.JoinHostPort(*nameserver, "53"))
+
+	if err != nil {
+		return nil
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err = conn.Write(query); err != nil {
+		return nil
+	}
+
+	buf := make([]byte, 4096)
+
+	n, err := conn.Read(buf)
+
+	if err != nil {
+		return nil
+	}
+
+	var message dnsmessage.Message
+
+	if err = message.Unpack(buf[:n]); err != nil || message.ID != id {
+		return nil
+	}
+
+	var result *uint32 = nil
+
+	for _, answer := range message.Answers {
+		if answer.Header.Type != dnsmessage.TypeSRV {
+			continue
+		}
+
+		if result == nil || answer.Header.TTL < *result {
+			result = PointerOf(answer.Header.TTL)
+		}
+	}
+
+	return result
+}
+
+func getNameserver() *string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+
+	if err != nil {
+		return nil
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+
+		if len(fields) > 1 && fields[0] == "nameserver" {
+			return &fields[1]
+		}
+	}
+
+	return nil
+}
+
+// ResolveIPAddress resolves the hostname to its first IP address, returning nil if it cannot be resolved.
+func ResolveIPAddress(ctx context.Context, hostname string) *string {
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
+
+	if err != nil || len(addresses) < 1 {
+		return nil
+	}
+
+	return PointerOf(addresses[0].IP.String())
+}
+
+// LookupReverseDNS returns the PTR record of the address if it is an IP literal and reverse DNS lookups are enabled.
+func LookupReverseDNS(ctx context.Context, address string) *string {
+	if !config.Lookup.ReverseDNS || net.ParseIP(address) == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Lookup.ReverseDNSTimeout)
+
+	defer cancel()
+
+	names, err := net.DefaultResolver.LookupAddr(ctx, address)
+
+	if err != nil || len(names) < 1 {
+		return nil
+	}
+
+	return PointerOf(strings.TrimSuffix(names[0], "."))
 }
 
 // ParseAddress extracts the hostname and port from the given address string, and returns the default port if none is provided.
 func ParseAddress(address string, defaultPort uint16) (string, uint16, error) {
+	// IPv6 literals are enclosed in brackets, as their colons would otherwise be mistaken for the port separator
+	if strings.HasPrefix(address, "[") {
+		host, portValue, ok := strings.Cut(address[1:], "]")
+
+		if ip := net.ParseIP(host); !ok || ip == nil || ip.To4() != nil {
+			return "", 0, fmt.Errorf("'%s' does not match any known address", address)
+		}
+
+		if len(portValue) < 1 {
+			return host, defaultPort, nil
+		}
+
+		port, err := strconv.ParseUint(strings.TrimPrefix(portValue, ":"), 10, 16)
+
+		if err != nil || !strings.HasPrefix(portValue, ":") {
+			return "", 0, fmt.Errorf("'%s' does not match any known address", address)
+		}
+
+		return host, uint16(port), nil
+	}
+
 	if !hostRegEx.MatchString(address) {
 		return "", 0, fmt.Errorf("'%s' does not match any known address", address)
 	}
@@ -149,6 +405,36 @@ func ParseAddress(address string, defaultPort uint16) (string, uint16, error) {
 	return host, uint16(port), nil
 }
 
+// ParseTargetAddress parses the address of a server of the given edition, and reports where the port was derived from.
+// The configured port overrides are consulted before the edition's default port when the address omits a port.
+func ParseTargetAddress(address, edition string) (string, uint16, string, error) {
+	var (
+		defaultPort uint16 = util.DefaultJavaPort
+		overrides          = config.Lookup.JavaPortOverrides
+	)
+
+	if edition == "bedrock" {
+		defaultPort = util.DefaultBedrockPort
+		overrides = config.Lookup.BedrockPortOverrides
+	}
+
+	hostname, port, err := ParseAddress(address, defaultPort)
+
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	if strings.Contains(address[strings.LastIndex(address, "]")+1:], ":") {
+		return hostname, port, PortSourceExplicit, nil
+	}
+
+	if override, ok := overrides[hostname]; ok {
+		return hostname, override, PortSourceOverride, nil
+	}
+
+	return hostname, port, PortSourceDefault, nil
+}
+
 // GetVoteOptions parses the vote options from the provided query parameters.
 func GetVoteOptions(ctx *fiber.Ctx) (*VoteOptions, error) {
 	result := VoteOptions{}
@@ -241,14 +527,62 @@ func GetVoteOptions(ctx *fiber.Ctx) (*VoteOptions, error) {
 func GetStatusOptions(ctx *fiber.Ctx) (*StatusOptions, error) {
 	result := &StatusOptions{}
 
+	body, _ := ctx.Locals("request-options").(*StatusRequestOptions)
+
 	// Query
 	{
 		result.Query = ctx.QueryBool("query", true)
+
+		if body != nil && body.Query != nil {
+			result.Query = *body.Query
+		}
 	}
 
 	// Timeout
 	{
-		result.Timeout = time.Duration(math.Max(float64(time.Second)*ctx.QueryFloat("timeout", 5.0), float64(time.Millisecond*500)))
+		timeout := ctx.QueryFloat("timeout", 5.0)
+
+		if body != nil && body.Timeout != nil {
+			timeout = *body.Timeout
+		}
+
+		result.Timeout = time.Duration(math.Max(float64(time.Second)*timeout, float64(time.Millisecond*500)))
+	}
+
+	// Trigger
+	{
+		result.Trigger = "request"
+	}
+
+	// Bypass cache
+	{
+		result.BypassCache = ctx.QueryBool("bypass_cache", false)
+
+		if body != nil && body.BypassCache != nil {
+			result.BypassCache = *body.BypassCache
+		}
+
+		if result.BypassCache {
+			if !CanBypassCache(ctx) {
+				return nil, fiber.ErrForbidden
+			}
+
+			result.SkipProbeInterval = true
+		}
+	}
+
+	// Include raw
+	{
+		result.IncludeRaw = ctx.QueryBool("include_raw", false)
+
+		if body != nil && body.IncludeRaw != nil {
+			result.IncludeRaw = *body.IncludeRaw
+		}
+	}
+
+	// Tenant
+	{
+		result.Tenant = GetTenant(ctx)
 	}
 
 	return result, nil
@@ -347,6 +681,248 @@ func Authenticate(ctx *fiber.Ctx) (bool, error) {
 	return true, nil
 }
 
+// RequestContext is a middleware that gives every request its own context, which is cancelled as soon as the
+// request has been handled, or as soon as the client closes the connection with ErrClientDisconnected as the cause, so
+// that any upstream work still running on its behalf is abandoned.
+func RequestContext(ctx *fiber.Ctx) error {
+	c, cancel := context.WithCancelCause(context.Background())
+
+	defer cancel(nil)
+
+	if conn, ok := ctx.Context().Conn().(*ClientConn); ok {
+		stop := conn.Watch(func() {
+			cancel(ErrClientDisconnected)
+		})
+
+		defer stop()
+	}
+
+	ctx.SetUserContext(c)
+
+	return ctx.Next()
+}
+
+// RequireAdmin is a middleware that only allows requests carrying the configured admin token.
+func RequireAdmin(ctx *fiber.Ctx) error {
+	if config.AdminToken == nil {
+		return ctx.SendStatus(http.StatusNotFound)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(ctx.Get("Authorization")), []byte(*config.AdminToken)) != 1 {
+		return ctx.Status(http.StatusUnauthorized).SendString("Invalid or missing admin token")
+	}
+
+	return ctx.Next()
+}
+
+// CanBypassCache checks whether the request may force a fresh status, which is limited to requests made with the
+// admin token or a valid API key so that it cannot be used to flood servers with probes.
+func CanBypassCache(ctx *fiber.Ctx) bool {
+	if config.AdminToken != nil && subtle.ConstantTimeCompare([]byte(ctx.Get("Authorization")), []byte(*config.AdminToken)) == 1 {
+		return true
+	}
+
+	if key, ok := ctx.Locals("api-key").(*APIKey); ok && key != nil {
+		return true
+	}
+
+	return GetTenantByAPIKey(ctx.Get("X-API-Key")) != nil
+}
+
+// SetStatusHeaders exposes the most commonly polled status properties as headers, so HEAD requests can be used for
+// lightweight liveness checks.
+func SetStatusHeaders(ctx *fiber.Ctx, online bool, playersOnline, playersMax *int64) {
+	ctx.Set("X-Online", strconv.FormatBool(online))
+
+	if playersOnline != nil {
+		ctx.Set("X-Players-Online", strconv.FormatInt(*playersOnline, 10))
+	}
+
+	if playersMax != nil {
+		ctx.Set("X-Players-Max", strconv.FormatInt(*playersMax, 10))
+	}
+}
+
+// SendContent writes the body with validators, and honors conditional and single range requests.
+func SendContent(ctx *fiber.Ctx, contentType string, body []byte, lastModified time.Time) error {
+	etag := fmt.Sprintf("\"%s\"", SHA256(string(body)))
+	lastModified = lastModified.UTC().Truncate(time.Second)
+
+	ctx.Type(contentType)
+	ctx.Set(fiber.HeaderETag, etag)
+	ctx.Set(fiber.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	ctx.Set(fiber.HeaderAcceptRanges, "bytes")
+
+	if match := ctx.Get(fiber.HeaderIfNoneMatch); len(match) > 0 {
+		if match == "*" || Contains(Map(strings.Split(match, ","), strings.TrimSpace), etag) {
+			return ctx.SendStatus(http.StatusNotModified)
+		}
+	} else if since, err := http.ParseTime(ctx.Get(fiber.HeaderIfModifiedSince)); err == nil && !lastModified.After(since) {
+		return ctx.SendStatus(http.StatusNotModified)
+	}
+
+	if len(ctx.Get(fiber.HeaderRange)) < 1 || !IsIfRangeFresh(ctx, etag, lastModified) {
+		return ctx.Send(body)
+	}
+
+	byteRange, err := ctx.Range(len(body))
+
+	if err != nil || byteRange.Type != "bytes" || len(byteRange.Ranges) != 1 {
+		if errors.Is(err, fiber.ErrRangeUnsatisfiable) {
+			ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", len(body)))
+
+			return ctx.SendStatus(http.StatusRequestedRangeNotSatisfiable)
+		}
+
+		return ctx.Send(body)
+	}
+
+	start, end := byteRange.Ranges[0].Start, byteRange.Ranges[0].End
+
+	ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+
+	return ctx.Status(http.StatusPartialContent).Send(body[start : end+1])
+}
+
+// SendStatusResponse writes the status response in the media type negotiated with the client along with a weak ETag,
+// and answers requests whose If-None-Match header matches the ETag with 304 Not Modified. The cache properties are
+// left out of the ETag, as they change with every request even though the status they describe does not. Only the
+// fields selected by the 'fields' query parameter are sent, if any.
+func SendStatusResponse(ctx *fiber.Ctx, response interface{ Base() *BaseStatus }) error {
+	fields, err := ParseFields(ctx.Query("fields"))
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString(fmt.Sprintf("Invalid 'fields' query parameter, must be at most %d comma-separated field paths such as 'players.online'", maxFields))
+	}
+
+	mediaType, err := NegotiateMediaType(ctx)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'format' query parameter, must be one of 'json', 'msgpack', 'cbor' or 'xml'")
+	}
+
+	callback, err := ParseJSONPCallback(ctx)
+
+	if err != nil {
+		return ctx.Status(http.StatusBadRequest).SendString("Invalid 'callback' query parameter, must be a JavaScript function name")
+	}
+
+	// Script tags cannot set the Accept header, so JSONP responses are JSON unless another format is explicitly requested
+	if len(callback) > 0 {
+		if len(ctx.Query("format")) > 0 && mediaType != fiber.MIMEApplicationJSON {
+			return ctx.Status(http.StatusBadRequest).SendString("The 'callback' query parameter can only be used with the 'json' format")
+		}
+
+		mediaType = fiber.MIMEApplicationJSON
+	}
+
+	encode := func() ([]byte, error) {
+		value, err := SelectFields(response, fields)
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := EncodeResponse(value, mediaType)
+
+		if err != nil || len(callback) < 1 {
+			return data, err
+		}
+
+		return WrapJSONP(data, callback), nil
+	}
+
+	base := response.Base()
+	cacheHit, expiresAt := base.CacheHit, base.ExpiresAt
+
+	base.CacheHit, base.ExpiresAt = false, 0
+
+	data, err := encode()
+
+	base.CacheHit, base.ExpiresAt = cacheHit, expiresAt
+
+	if err != nil {
+		return err
+	}
+
+	etag := fmt.Sprintf("W/\"%s\"", SHA256(string(data)))
+
+	ctx.Set(fiber.HeaderETag, etag)
+
+	if match := ctx.Get(fiber.HeaderIfNoneMatch); len(match) > 0 {
+		for _, value := range strings.Split(match, ",") {
+			if value = strings.TrimSpace(value); value == "*" || strings.TrimPrefix(value, "W/") == strings.TrimPrefix(etag, "W/") {
+				return ctx.SendStatus(http.StatusNotModified)
+			}
+		}
+	}
+
+	if len(callback) > 0 {
+		ctx.Set(fiber.HeaderContentType, mimeApplicationJavaScript)
+		ctx.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	} else {
+		ctx.Set(fiber.HeaderContentType, mediaType)
+	}
+
+	if ctx.Method() == fiber.MethodHead {
+		return ctx.Send(nil)
+	}
+
+	if data, err = encode(); err != nil {
+		return err
+	}
+
+	return ctx.Send(data)
+}
+
+// IsIfRangeFresh returns whether the If-Range header, if any, still matches the representation being sent.
+func IsIfRangeFresh(ctx *fiber.Ctx, etag string, lastModified time.Time) bool {
+	value := ctx.Get(fiber.HeaderIfRange)
+
+	if len(value) < 1 {
+		return true
+	}
+
+	if strings.HasPrefix(value, "\"") {
+		return value == etag
+	}
+
+	since, err := http.ParseTime(value)
+
+	return err == nil && !lastModified.After(since)
+}
+
+// MarshalCanonicalJSON encodes the value as JSON with the keys of every object sorted, no insignificant whitespace and
+// no HTML escaping, so that equal values always produce identical bytes regardless of struct field order.
+func MarshalCanonicalJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoding into generic values makes the encoder sort object keys, numbers are kept as written
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+
+	if err = decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+
+	if err = encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
 // SHA256 returns the result of hashing the input value using SHA256 algorithm.
 func SHA256(input string) string {
 	result := sha1.Sum([]byte(input))